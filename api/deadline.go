@@ -0,0 +1,33 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultRequestTimeout is how long a request may spend in the stores
+const DefaultRequestTimeout = 5 * time.Second
+
+// RequestDeadline gives every request a context of parent that is done after
+// timeout, handlers pass it to the stores as c.UserContext(). A timeout of 0
+// leaves requests without a deadline. A store that runs out of time is
+// answered with 504. Canceling parent abandons every request in flight; the
+// context of fasthttp is not used since it is canceled as soon as a shutdown
+// starts, before requests had a chance to drain.
+func RequestDeadline(parent context.Context, timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(parent, timeout)
+		} else {
+			ctx, cancel = context.WithCancel(parent)
+		}
+		defer cancel()
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
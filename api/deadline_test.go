@@ -0,0 +1,51 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abhi2687/voter-api/api"
+	"github.com/abhi2687/voter-api/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingVoters is a store that waits on every GetVoter until the request
+// gives up
+type blockingVoters struct {
+	*db.VoterList
+}
+
+func (b blockingVoters) GetVoter(ctx context.Context, voterId uint) (db.Voter, error) {
+	<-ctx.Done()
+	return db.Voter{}, ctx.Err()
+}
+
+// testing a store that outlives the request deadline is answered with 504
+func TestRequestDeadline(t *testing.T) {
+	voters, _ := db.New()
+	handler, err := api.NewWithStore(blockingVoters{VoterList: voters})
+	assert.Nil(t, err)
+
+	deadlineApp := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	deadlineApp.Use(api.RequestDeadline(context.Background(), 50*time.Millisecond))
+	deadlineApp.Get("/voters/:id", handler.GetVoter)
+
+	start := time.Now()
+	resp, err := deadlineApp.Test(httptest.NewRequest("GET", "/voters/1", nil), int(time.Second/time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+	assert.Less(t, time.Since(start), time.Second)
+
+	var problem api.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Equal(t, "timeout", problem.Code)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errBadIfMatch = errors.New("If-Match must be * or a single ETag of a voter")
+
+// voterETag is the strong ETag a voter is served with, its quoted revision
+func voterETag(voter db.Voter) string {
+	return `"` + strconv.FormatUint(voter.Revision, 10) + `"`
+}
+
+// ifMatch is the precondition the If-Match header of a write sets
+type ifMatch struct {
+	// present is set when the header was sent, * included
+	present bool
+	// revision is the revision the header names, 0 for * or no header
+	// which the stores take as no precondition
+	revision uint64
+}
+
+// ifMatchRevision reads the If-Match header of a write. A weak ETag never
+// matches since If-Match compares strongly, neither does revision 0 as no
+// voter is ever at it.
+func ifMatchRevision(c *fiber.Ctx) (ifMatch, error) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" {
+		return ifMatch{}, nil
+	}
+	if header == "*" {
+		return ifMatch{present: true}, nil
+	}
+	if strings.HasPrefix(header, "W/") {
+		return ifMatch{}, db.ErrRevisionMismatch
+	}
+
+	revision, err := strconv.ParseUint(strings.Trim(header, `"`), 10, 64)
+	if err != nil || len(header) < 2 || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		return ifMatch{}, errBadIfMatch
+	}
+	if revision < db.FirstRevision {
+		return ifMatch{}, db.ErrRevisionMismatch
+	}
+	return ifMatch{present: true, revision: revision}, nil
+}
+
+// storeError is err of the write the precondition was given to, a missing
+// voter fails If-Match as there is nothing for it to match
+func (m ifMatch) storeError(err error) error {
+	if m.present && errors.Is(err, db.ErrVoterNotFound) {
+		return db.ErrRevisionMismatch
+	}
+	return err
+}
+
+// sendIfMatchError answers a write whose If-Match could not be read
+func sendIfMatchError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errBadIfMatch) {
+		return sendBadRequest(c, err)
+	}
+
+	return sendError(c, err)
+}
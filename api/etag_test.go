@@ -0,0 +1,136 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/abhi2687/voter-api/api"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// doConditional serves a request for /voters/1 with the conditional header
+// set
+func doConditional(t *testing.T, method string, header string, etag string, contentType string, body interface{}) *http.Response {
+	reqBody := bytes.NewBuffer(nil)
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reqBody = bytes.NewBufferString(body)
+	default:
+		bodyJSON, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to marshal body to JSON: %v", err)
+		}
+		reqBody = bytes.NewBuffer(bodyJSON)
+	}
+
+	req, err := http.NewRequest(method, "/voters/1", reqBody)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Add("Content-Type", contentType)
+	}
+	if etag != "" {
+		req.Header.Add(header, etag)
+	}
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+	return resp
+}
+
+// testing voters are served with their revision as ETag
+func TestVoterETag(t *testing.T) {
+	// clean up existing voters
+	deleteAllVoters()
+
+	voterJSON, _ := json.Marshal(testutils.NewRandVoter(1))
+	req, _ := http.NewRequest("POST", "/voters", bytes.NewBuffer(voterJSON))
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, `"1"`, resp.Header.Get(fiber.HeaderETag))
+
+	resp = doConditional(t, "GET", fiber.HeaderIfNoneMatch, "", "", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"1"`, resp.Header.Get(fiber.HeaderETag))
+
+	// the current revision is not sent again, weak or in a list
+	for _, etag := range []string{`"1"`, `W/"1"`, `"7", "1"`, "*"} {
+		resp = doConditional(t, "GET", fiber.HeaderIfNoneMatch, etag, "", nil)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode, etag)
+		assert.Equal(t, `"1"`, resp.Header.Get(fiber.HeaderETag), etag)
+	}
+
+	resp = doConditional(t, "PATCH", fiber.HeaderIfMatch, `"1"`, api.MergePatchMediaType, `{"name": "Jo"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get(fiber.HeaderETag))
+
+	resp = doConditional(t, "GET", fiber.HeaderIfNoneMatch, `"1"`, "", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get(fiber.HeaderETag))
+
+	resp = doConditional(t, "PUT", fiber.HeaderIfMatch, `"2"`, "application/json", testutils.NewRandVoter(1))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"3"`, resp.Header.Get(fiber.HeaderETag))
+}
+
+// testing If-Match makes writes fail on a stale revision
+func TestVoterIfMatch(t *testing.T) {
+	// clean up existing voters
+	deleteAllVoters()
+
+	addVoters(t, 1)
+	update := testutils.NewRandVoter(1)
+
+	tests := []struct {
+		name        string
+		method      string
+		etag        string
+		contentType string
+		body        interface{}
+		status      int
+	}{
+		{"StalePut", "PUT", `"9"`, "application/json", update, http.StatusPreconditionFailed},
+		{"StalePatch", "PATCH", `"9"`, api.MergePatchMediaType, `{"name": "Jo"}`, http.StatusPreconditionFailed},
+		{"StaleDelete", "DELETE", `"9"`, "", nil, http.StatusPreconditionFailed},
+		{"WeakPut", "PUT", `W/"1"`, "application/json", update, http.StatusPreconditionFailed},
+		{"ZeroPut", "PUT", `"0"`, "application/json", update, http.StatusPreconditionFailed},
+		{"MalformedPut", "PUT", "1", "application/json", update, http.StatusBadRequest},
+		{"ListPut", "PUT", `"1", "2"`, "application/json", update, http.StatusBadRequest},
+		{"Put", "PUT", `"1"`, "application/json", update, http.StatusOK},
+		{"AnyPatch", "PATCH", "*", api.MergePatchMediaType, `{"name": "Jo"}`, http.StatusOK},
+		{"StaleAfterPatch", "DELETE", `"2"`, "", nil, http.StatusPreconditionFailed},
+		{"Delete", "DELETE", `"3"`, "", nil, http.StatusOK},
+		// there is no voter left to match
+		{"AnyPatchMissing", "PATCH", "*", api.MergePatchMediaType, `{"name": "Jo"}`, http.StatusPreconditionFailed},
+		{"DeleteMissing", "DELETE", `"3"`, "", nil, http.StatusPreconditionFailed},
+		{"UnconditionalDeleteMissing", "DELETE", "", "", nil, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		resp := doConditional(t, tt.method, fiber.HeaderIfMatch, tt.etag, tt.contentType, tt.body)
+		assert.Equal(t, tt.status, resp.StatusCode, tt.name)
+
+		if tt.status == http.StatusPreconditionFailed {
+			var problem api.Problem
+			if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+				t.Fatalf("Failed to unmarshal response body: %v", err)
+			}
+			assert.Equal(t, "revision-mismatch", problem.Code, tt.name)
+		}
+	}
+
+	_, err := voterList.GetVoter(ctx, 1)
+	assert.NotNil(t, err)
+}
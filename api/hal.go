@@ -0,0 +1,382 @@
+package api
+
+import (
+	"github.com/abhi2687/voter-api/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HALMediaType is asked for through the Accept header to get HAL responses,
+// any other client keeps getting plain JSON
+const HALMediaType = "application/hal+json"
+
+// Names of the routes HAL links are built from, routes are registered under
+// them with fiber's Route.Name
+const (
+	RouteVoters       = "voters"
+	RouteVoter        = "voter"
+	RouteVoterHistory = "voterHistory"
+	RouteVoterPolls   = "voterPolls"
+	RouteVoterPoll    = "voterPoll"
+	RouteVoterVote    = "voterVote"
+	RoutePolls        = "polls"
+	RoutePoll         = "poll"
+	RoutePollOptions  = "pollOptions"
+	RoutePollOption   = "pollOption"
+	RoutePollResults  = "pollResults"
+	RouteVotes        = "votes"
+	RouteVote         = "vote"
+)
+
+type Link struct {
+	Href string `json:"href"`
+}
+
+// Links maps a relation to its link, relations whose route is not
+// registered are left out
+type Links map[string]Link
+
+type TemplateProperty struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+}
+
+// Template is an affordance describing how to create a resource
+type Template struct {
+	Title      string                      `json:"title"`
+	Method     string                      `json:"method"`
+	Href       string                      `json:"href"`
+	Properties map[string]TemplateProperty `json:"properties"`
+}
+
+type Templates map[string]Template
+
+type HALStatus struct {
+	Status string `json:"status"`
+	Links  Links  `json:"_links"`
+}
+
+type HALVoterHistory struct {
+	db.VoterHistory
+	Links Links `json:"_links"`
+}
+
+type HALVoter struct {
+	VoterId  uint   `json:"voterId"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Revision uint64 `json:"revision"`
+	Links    Links  `json:"_links"`
+	Embedded struct {
+		VoteHistory []HALVoterHistory `json:"voteHistory"`
+	} `json:"_embedded"`
+	Templates Templates `json:"_templates,omitempty"`
+}
+
+type HALVoterCollection struct {
+	Total    int   `json:"total"`
+	Links    Links `json:"_links"`
+	Embedded struct {
+		Voters []HALVoter `json:"voters"`
+	} `json:"_embedded"`
+	Templates Templates `json:"_templates"`
+}
+
+type HALVoterHistoryCollection struct {
+	Links    Links `json:"_links"`
+	Embedded struct {
+		VoteHistory []HALVoterHistory `json:"voteHistory"`
+	} `json:"_embedded"`
+}
+
+type HALPollOption struct {
+	db.PollOption
+	Links Links `json:"_links"`
+}
+
+type HALPoll struct {
+	PollId   uint   `json:"pollId"`
+	Title    string `json:"title"`
+	Question string `json:"question"`
+	Links    Links  `json:"_links"`
+	Embedded struct {
+		Options []HALPollOption `json:"options"`
+	} `json:"_embedded"`
+	Templates Templates `json:"_templates,omitempty"`
+}
+
+type HALPollCollection struct {
+	Links    Links `json:"_links"`
+	Embedded struct {
+		Polls []HALPoll `json:"polls"`
+	} `json:"_embedded"`
+	Templates Templates `json:"_templates"`
+}
+
+type HALPollOptionCollection struct {
+	Links    Links `json:"_links"`
+	Embedded struct {
+		Options []HALPollOption `json:"options"`
+	} `json:"_embedded"`
+	Templates Templates `json:"_templates"`
+}
+
+type HALPollResults struct {
+	db.PollResults
+	Links Links `json:"_links"`
+}
+
+type HALVote struct {
+	db.Vote
+	Links Links `json:"_links"`
+}
+
+type HALVoteCollection struct {
+	Links    Links `json:"_links"`
+	Embedded struct {
+		Votes []HALVote `json:"votes"`
+	} `json:"_embedded"`
+	Templates Templates `json:"_templates"`
+}
+
+// wantsHAL reports whether the client prefers HAL over plain JSON
+func wantsHAL(c *fiber.Ctx) bool {
+	return c.Accepts(fiber.MIMEApplicationJSON, HALMediaType) == HALMediaType
+}
+
+func sendHAL(c *fiber.Ctx, status int, resource interface{}) error {
+	return c.Status(status).JSON(resource, HALMediaType)
+}
+
+// routeURL builds the path of a named route, it is empty when no route of
+// that name is registered
+func routeURL(c *fiber.Ctx, routeName string, params fiber.Map) string {
+	href, err := c.GetRouteURL(routeName, params)
+	if err != nil {
+		return ""
+	}
+
+	return href
+}
+
+func (l Links) add(c *fiber.Ctx, rel string, routeName string, params fiber.Map) Links {
+	if href := routeURL(c, routeName, params); href != "" {
+		l[rel] = Link{Href: href}
+	}
+
+	return l
+}
+
+func (t Templates) add(c *fiber.Ctx, name string, title string, routeName string, params fiber.Map, properties map[string]TemplateProperty) Templates {
+	if href := routeURL(c, routeName, params); href != "" {
+		t[name] = Template{Title: title, Method: fiber.MethodPost, Href: href, Properties: properties}
+	}
+
+	return t
+}
+
+var (
+	voterProperties = map[string]TemplateProperty{
+		"voterId": {Type: "number", Title: "Voter ID"},
+		"name":    {Type: "string", Title: "Name"},
+		"email":   {Type: "string", Title: "Email"},
+	}
+	pollProperties = map[string]TemplateProperty{
+		"pollId":   {Type: "number", Title: "Poll ID"},
+		"title":    {Type: "string", Title: "Title"},
+		"question": {Type: "string", Title: "Question"},
+	}
+	pollOptionProperties = map[string]TemplateProperty{
+		"optionId": {Type: "number", Title: "Option ID"},
+		"text":     {Type: "string", Title: "Text"},
+	}
+	voteProperties = map[string]TemplateProperty{
+		"voterId":  {Type: "number", Title: "Voter ID"},
+		"pollId":   {Type: "number", Title: "Poll ID"},
+		"optionId": {Type: "number", Title: "Option ID"},
+		"value":    {Type: "string", Title: "Value"},
+	}
+	voterVoteProperties = map[string]TemplateProperty{
+		"pollId":   {Type: "number", Title: "Poll ID"},
+		"optionId": {Type: "number", Title: "Option ID"},
+		"value":    {Type: "string", Title: "Value"},
+	}
+)
+
+// newHALStatus answers a change that has no resource to return
+func newHALStatus(links Links) HALStatus {
+	return HALStatus{Status: "ok", Links: links}
+}
+
+func newHALVoterHistory(c *fiber.Ctx, voterId uint, vh db.VoterHistory) HALVoterHistory {
+	links := Links{}.add(c, "self", RouteVoterPoll, fiber.Map{"id": voterId, "pollid": vh.PollId}).
+		add(c, "poll", RoutePoll, fiber.Map{"id": vh.PollId})
+	if vh.VoteId != 0 {
+		links.add(c, "vote", RouteVote, fiber.Map{"id": vh.VoteId})
+	}
+
+	return HALVoterHistory{VoterHistory: vh, Links: links}
+}
+
+func newHALVoter(c *fiber.Ctx, voter db.Voter) HALVoter {
+	params := fiber.Map{"id": voter.VoterId}
+	resource := HALVoter{
+		VoterId:  voter.VoterId,
+		Name:     voter.Name,
+		Email:    voter.Email,
+		Revision: voter.Revision,
+		Links: Links{}.add(c, "self", RouteVoter, params).
+			add(c, "history", RouteVoterHistory, params).
+			add(c, "polls", RouteVoterPolls, params).
+			add(c, "vote", RouteVoterVote, params),
+	}
+
+	resource.Embedded.VoteHistory = []HALVoterHistory{}
+	for _, vh := range voter.VoteHistory {
+		resource.Embedded.VoteHistory = append(resource.Embedded.VoteHistory, newHALVoterHistory(c, voter.VoterId, vh))
+	}
+
+	return resource
+}
+
+// newHALVoterResource is a voter on its own, it carries the cast-vote
+// affordance
+func newHALVoterResource(c *fiber.Ctx, voter db.Voter) HALVoter {
+	resource := newHALVoter(c, voter)
+	resource.Templates = Templates{}.add(c, "cast-vote", "Cast Vote", RouteVoterVote, fiber.Map{"id": voter.VoterId}, voterVoteProperties)
+	return resource
+}
+
+func newHALVoterCollection(c *fiber.Ctx, page db.VoterPage) HALVoterCollection {
+	collection := HALVoterCollection{
+		Total:     page.Total,
+		Links:     Links{"self": {Href: c.OriginalURL()}},
+		Templates: Templates{}.add(c, "create-voter", "Create Voter", RouteVoters, nil, voterProperties),
+	}
+
+	next, prev := pageCursors(page)
+	if next != "" {
+		collection.Links["next"] = Link{Href: pageURL(c, next)}
+	}
+	if prev != "" {
+		collection.Links["prev"] = Link{Href: pageURL(c, prev)}
+	}
+
+	collection.Embedded.Voters = []HALVoter{}
+	for _, voter := range page.Voters {
+		collection.Embedded.Voters = append(collection.Embedded.Voters, newHALVoter(c, voter))
+	}
+
+	return collection
+}
+
+func newHALVoterHistoryCollection(c *fiber.Ctx, voterId uint, voterPolls []db.VoterHistory) HALVoterHistoryCollection {
+	collection := HALVoterHistoryCollection{
+		Links: Links{"self": {Href: c.OriginalURL()}}.add(c, "voter", RouteVoter, fiber.Map{"id": voterId}),
+	}
+
+	collection.Embedded.VoteHistory = []HALVoterHistory{}
+	for _, vh := range voterPolls {
+		collection.Embedded.VoteHistory = append(collection.Embedded.VoteHistory, newHALVoterHistory(c, voterId, vh))
+	}
+
+	return collection
+}
+
+func newHALPollOption(c *fiber.Ctx, pollId uint, option db.PollOption) HALPollOption {
+	return HALPollOption{
+		PollOption: option,
+		Links:      Links{}.add(c, "self", RoutePollOption, fiber.Map{"id": pollId, "optionid": option.OptionId}),
+	}
+}
+
+func newHALPoll(c *fiber.Ctx, poll db.Poll) HALPoll {
+	params := fiber.Map{"id": poll.PollId}
+	resource := HALPoll{
+		PollId:   poll.PollId,
+		Title:    poll.Title,
+		Question: poll.Question,
+		Links: Links{}.add(c, "self", RoutePoll, params).
+			add(c, "options", RoutePollOptions, params).
+			add(c, "results", RoutePollResults, params).
+			add(c, "vote", RouteVotes, nil),
+	}
+
+	resource.Embedded.Options = []HALPollOption{}
+	for _, option := range poll.Options {
+		resource.Embedded.Options = append(resource.Embedded.Options, newHALPollOption(c, poll.PollId, option))
+	}
+
+	return resource
+}
+
+// newHALPollResource is a poll on its own, it carries the affordances to add
+// options and to vote
+func newHALPollResource(c *fiber.Ctx, poll db.Poll) HALPoll {
+	resource := newHALPoll(c, poll)
+	resource.Templates = Templates{}.
+		add(c, "create-poll-option", "Create Poll Option", RoutePollOptions, fiber.Map{"id": poll.PollId}, pollOptionProperties).
+		add(c, "create-vote", "Create Vote", RouteVotes, nil, voteProperties)
+	return resource
+}
+
+func newHALPollCollection(c *fiber.Ctx, polls []db.Poll) HALPollCollection {
+	collection := HALPollCollection{
+		Links:     Links{"self": {Href: c.OriginalURL()}},
+		Templates: Templates{}.add(c, "create-poll", "Create Poll", RoutePolls, nil, pollProperties),
+	}
+
+	collection.Embedded.Polls = []HALPoll{}
+	for _, poll := range polls {
+		collection.Embedded.Polls = append(collection.Embedded.Polls, newHALPoll(c, poll))
+	}
+
+	return collection
+}
+
+func newHALPollOptionCollection(c *fiber.Ctx, pollId uint, options []db.PollOption) HALPollOptionCollection {
+	params := fiber.Map{"id": pollId}
+	collection := HALPollOptionCollection{
+		Links:     Links{"self": {Href: c.OriginalURL()}}.add(c, "poll", RoutePoll, params),
+		Templates: Templates{}.add(c, "create-poll-option", "Create Poll Option", RoutePollOptions, params, pollOptionProperties),
+	}
+
+	collection.Embedded.Options = []HALPollOption{}
+	for _, option := range options {
+		collection.Embedded.Options = append(collection.Embedded.Options, newHALPollOption(c, pollId, option))
+	}
+
+	return collection
+}
+
+func newHALPollResults(c *fiber.Ctx, results db.PollResults) HALPollResults {
+	params := fiber.Map{"id": results.PollId}
+	return HALPollResults{
+		PollResults: results,
+		Links: Links{}.add(c, "self", RoutePollResults, params).
+			add(c, "poll", RoutePoll, params),
+	}
+}
+
+func newHALVote(c *fiber.Ctx, vote db.Vote) HALVote {
+	return HALVote{
+		Vote: vote,
+		Links: Links{}.add(c, "self", RouteVote, fiber.Map{"id": vote.VoteId}).
+			add(c, "voter", RouteVoter, fiber.Map{"id": vote.VoterId}).
+			add(c, "poll", RoutePoll, fiber.Map{"id": vote.PollId}).
+			add(c, "results", RoutePollResults, fiber.Map{"id": vote.PollId}),
+	}
+}
+
+func newHALVoteCollection(c *fiber.Ctx, votes []db.Vote) HALVoteCollection {
+	collection := HALVoteCollection{
+		Links:     Links{"self": {Href: c.OriginalURL()}},
+		Templates: Templates{}.add(c, "create-vote", "Create Vote", RouteVotes, nil, voteProperties),
+	}
+
+	collection.Embedded.Votes = []HALVote{}
+	for _, vote := range votes {
+		collection.Embedded.Votes = append(collection.Embedded.Votes, newHALVote(c, vote))
+	}
+
+	return collection
+}
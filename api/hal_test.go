@@ -0,0 +1,190 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/abhi2687/voter-api/api"
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// getHAL fetches path asking for HAL and decodes the body into resource
+func getHAL(t *testing.T, path string, resource interface{}) *http.Response {
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+	req.Header.Add("Accept", api.HALMediaType)
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(resource); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	return resp
+}
+
+// testing HAL voter resource
+func TestHALVoter(t *testing.T) {
+	// clean up existing voters, polls and votes
+	deleteAllVoters()
+	deleteAllPolls()
+	deleteAllVotes()
+
+	addVoters(t, 1)
+	addPolls(t, 1)
+	_, vote := castVote(t, "/voters/1/vote", fiber.Map{"pollId": 1, "optionId": 1})
+
+	var voter api.HALVoter
+	resp := getHAL(t, "/voters/1", &voter)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, api.HALMediaType, resp.Header.Get("Content-Type"))
+
+	assert.Equal(t, uint(1), voter.VoterId)
+	// casting the vote moved the revision on
+	assert.Equal(t, db.FirstRevision+1, voter.Revision)
+	assert.Equal(t, api.Links{
+		"self":    {Href: "/voters/1"},
+		"history": {Href: "/voters/1/history"},
+		"polls":   {Href: "/voters/1/polls"},
+		"vote":    {Href: "/voters/1/vote"},
+	}, voter.Links)
+
+	if assert.Len(t, voter.Embedded.VoteHistory, 1) {
+		vh := voter.Embedded.VoteHistory[0]
+		assert.Equal(t, vote.VoteId, vh.VoteId)
+		assert.Equal(t, api.Links{
+			"self": {Href: "/voters/1/polls/1"},
+			"poll": {Href: "/polls/1"},
+			"vote": {Href: fmt.Sprintf("/votes/%d", vote.VoteId)},
+		}, vh.Links)
+	}
+
+	if assert.Contains(t, voter.Templates, "cast-vote") {
+		assert.Equal(t, "POST", voter.Templates["cast-vote"].Method)
+		assert.Equal(t, "/voters/1/vote", voter.Templates["cast-vote"].Href)
+	}
+}
+
+// testing HAL voter collection keeps the page links in the body
+func TestHALVoterCollection(t *testing.T) {
+	// clean up existing voters
+	deleteAllVoters()
+
+	addVoters(t, 1, 2, 3)
+
+	var voters api.HALVoterCollection
+	resp := getHAL(t, "/voters?limit=1&offset=1", &voters)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, 3, voters.Total)
+	if assert.Len(t, voters.Embedded.Voters, 1) {
+		assert.Equal(t, uint(2), voters.Embedded.Voters[0].VoterId)
+		assert.Equal(t, "/voters/2", voters.Embedded.Voters[0].Links["self"].Href)
+	}
+	assert.Equal(t, "/voters?limit=1&offset=1", voters.Links["self"].Href)
+	assert.Contains(t, voters.Links, "next")
+	assert.Contains(t, voters.Links, "prev")
+
+	if assert.Contains(t, voters.Templates, "create-voter") {
+		assert.Equal(t, "/voters", voters.Templates["create-voter"].Href)
+		assert.Contains(t, voters.Templates["create-voter"].Properties, "name")
+	}
+}
+
+// testing HAL poll resource embeds its options
+func TestHALPoll(t *testing.T) {
+	// clean up existing polls
+	deleteAllPolls()
+
+	addPolls(t, 1)
+
+	var poll api.HALPoll
+	resp := getHAL(t, "/polls/1", &poll)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, api.Links{
+		"self":    {Href: "/polls/1"},
+		"options": {Href: "/polls/1/options"},
+		"results": {Href: "/polls/1/results"},
+		"vote":    {Href: "/votes"},
+	}, poll.Links)
+
+	if assert.Len(t, poll.Embedded.Options, 2) {
+		assert.Equal(t, "/polls/1/options/2", poll.Embedded.Options[1].Links["self"].Href)
+	}
+
+	assert.Equal(t, "/polls/1/options", poll.Templates["create-poll-option"].Href)
+	assert.Equal(t, "/votes", poll.Templates["create-vote"].Href)
+
+	var polls api.HALPollCollection
+	getHAL(t, "/polls", &polls)
+	assert.Len(t, polls.Embedded.Polls, 1)
+	assert.Equal(t, "/polls", polls.Templates["create-poll"].Href)
+}
+
+// testing HAL vote resource links back to voter and poll
+func TestHALVote(t *testing.T) {
+	// clean up existing voters, polls and votes
+	deleteAllVoters()
+	deleteAllPolls()
+	deleteAllVotes()
+
+	addVoters(t, 1)
+	addPolls(t, 1)
+	_, vote := castVote(t, "/voters/1/vote", fiber.Map{"pollId": 1, "optionId": 2})
+
+	var halVote api.HALVote
+	getHAL(t, fmt.Sprintf("/votes/%d", vote.VoteId), &halVote)
+	assert.Equal(t, vote, halVote.Vote)
+	assert.Equal(t, api.Links{
+		"self":    {Href: fmt.Sprintf("/votes/%d", vote.VoteId)},
+		"voter":   {Href: "/voters/1"},
+		"poll":    {Href: "/polls/1"},
+		"results": {Href: "/polls/1/results"},
+	}, halVote.Links)
+
+	var votes api.HALVoteCollection
+	getHAL(t, "/votes", &votes)
+	assert.Len(t, votes.Embedded.Votes, 1)
+	assert.Equal(t, "/votes", votes.Templates["create-vote"].Href)
+}
+
+// testing plain JSON stays the default
+func TestHALNotRequested(t *testing.T) {
+	// clean up existing voters
+	deleteAllVoters()
+
+	voter1 := testutils.NewRandVoter(1)
+	addVoters(t, voter1.VoterId)
+
+	for _, accept := range []string{"", "application/json", "*/*"} {
+		req, err := http.NewRequest("GET", "/voters/1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create HTTP request: %v", err)
+		}
+		if accept != "" {
+			req.Header.Add("Accept", accept)
+		}
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to serve request: %v", err)
+		}
+		assert.Equal(t, fiber.MIMEApplicationJSON, resp.Header.Get("Content-Type"), accept)
+
+		var voter db.Voter
+		if err := json.NewDecoder(resp.Body).Decode(&voter); err != nil {
+			t.Fatalf("Failed to unmarshal response body: %v", err)
+		}
+		assert.Equal(t, voter1.VoterId, voter.VoterId, accept)
+	}
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+type PollAPI struct {
+	db db.PollStore
+}
+
+// NewPollAPI returns a PollAPI backed by any PollStore
+func NewPollAPI(store db.PollStore) (*PollAPI, error) {
+	if store == nil {
+		return nil, errors.New("poll store is required")
+	}
+
+	return &PollAPI{db: store}, nil
+}
+
+func (p *PollAPI) AddPoll(c *fiber.Ctx) error {
+	var poll db.Poll
+	if err := c.BodyParser(&poll); err != nil {
+		slog.DebugContext(c.UserContext(), "parsing request body failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	err := p.db.AddPoll(c.UserContext(), poll)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "adding poll failed", "err", err)
+		return sendError(c, err)
+	}
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusCreated, newHALPollResource(c, poll))
+	}
+	return c.Status(http.StatusCreated).JSON(poll)
+}
+
+func (p *PollAPI) GetPoll(c *fiber.Ctx) error {
+	pollIdStr := c.Params("id")
+	pollId, err := strconv.ParseUint(pollIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing pollId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	poll, err := p.db.GetPoll(c.UserContext(), uint(pollId))
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "getting poll failed", "err", err)
+		return sendError(c, err)
+	}
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALPollResource(c, poll))
+	}
+	return c.Status(http.StatusOK).JSON(poll)
+}
+
+func (p *PollAPI) GetAllPolls(c *fiber.Ctx) error {
+	polls := p.db.GetAllPolls(c.UserContext())
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALPollCollection(c, polls))
+	}
+	return c.Status(http.StatusOK).JSON(polls)
+}
+
+func (p *PollAPI) DeleteAllPolls(c *fiber.Ctx) error {
+	p.db.DeleteAllPolls(c.UserContext())
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALStatus(Links{}.add(c, "polls", RoutePolls, nil)))
+	}
+	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
+}
+
+func (p *PollAPI) UpdatePoll(c *fiber.Ctx) error {
+	var poll db.Poll
+	pollIdStr := c.Params("id")
+	pollId, err := strconv.ParseUint(pollIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing pollId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	if err := c.BodyParser(&poll); err != nil {
+		slog.DebugContext(c.UserContext(), "parsing request body failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	err = p.db.UpdatePoll(c.UserContext(), poll, uint(pollId))
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "updating poll failed", "err", err)
+		return sendError(c, err)
+	}
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALStatus(Links{}.add(c, "poll", RoutePoll, fiber.Map{"id": pollId})))
+	}
+	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
+}
+
+func (p *PollAPI) DeletePoll(c *fiber.Ctx) error {
+	pollIdStr := c.Params("id")
+	pollId, err := strconv.ParseUint(pollIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing pollId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	err = p.db.DeletePoll(c.UserContext(), uint(pollId))
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "deleting poll failed", "err", err)
+		return sendError(c, err)
+	}
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALStatus(Links{}.add(c, "polls", RoutePolls, nil)))
+	}
+	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
+}
+
+func (p *PollAPI) GetPollOptions(c *fiber.Ctx) error {
+	pollIdStr := c.Params("id")
+	pollId, err := strconv.ParseUint(pollIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing pollId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	options, err := p.db.GetPollOptions(c.UserContext(), uint(pollId))
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "getting poll options failed", "err", err)
+		return sendError(c, err)
+	}
+
+	if options == nil {
+		options = []db.PollOption{}
+	}
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALPollOptionCollection(c, uint(pollId), options))
+	}
+	return c.Status(http.StatusOK).JSON(options)
+}
+
+func (p *PollAPI) AddPollOption(c *fiber.Ctx) error {
+	var option db.PollOption
+	pollIdStr := c.Params("id")
+	pollId, err := strconv.ParseUint(pollIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing pollId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	if err := c.BodyParser(&option); err != nil {
+		slog.DebugContext(c.UserContext(), "parsing request body failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	err = p.db.AddPollOption(c.UserContext(), option, uint(pollId))
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "adding poll option failed", "err", err)
+		return sendError(c, err)
+	}
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusCreated, newHALPollOption(c, uint(pollId), option))
+	}
+	return c.Status(http.StatusCreated).JSON(option)
+}
+
+func (p *PollAPI) GetPollOption(c *fiber.Ctx) error {
+	pollIdStr := c.Params("id")
+	pollId, err := strconv.ParseUint(pollIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing pollId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	optionIdStr := c.Params("optionid")
+	optionId, err := strconv.ParseUint(optionIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing optionId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	option, err := p.db.GetPollOption(c.UserContext(), uint(pollId), uint(optionId))
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "getting poll option failed", "err", err)
+		return sendError(c, err)
+	}
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALPollOption(c, uint(pollId), option))
+	}
+	return c.Status(http.StatusOK).JSON(option)
+}
+
+func (p *PollAPI) DeletePollOption(c *fiber.Ctx) error {
+	pollIdStr := c.Params("id")
+	pollId, err := strconv.ParseUint(pollIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing pollId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	optionIdStr := c.Params("optionid")
+	optionId, err := strconv.ParseUint(optionIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing optionId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	err = p.db.DeletePollOption(c.UserContext(), uint(pollId), uint(optionId))
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "deleting poll option failed", "err", err)
+		return sendError(c, err)
+	}
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALStatus(Links{}.add(c, "options", RoutePollOptions, fiber.Map{"id": pollId})))
+	}
+	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
+}
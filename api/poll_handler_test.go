@@ -0,0 +1,360 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/abhi2687/voter-api/api"
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// testing poll handler NewPollAPI function
+func TestNewPollAPI(t *testing.T) {
+	pollList, _ := db.NewPollList(nil)
+	pollHandler, err := api.NewPollAPI(pollList)
+	assert.Nil(t, err)
+	assert.NotNil(t, pollHandler)
+
+	// a store is required
+	pollHandler, err = api.NewPollAPI(nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, pollHandler)
+}
+
+// testing poll handler AddPoll - Success case
+func TestAddPoll(t *testing.T) {
+	// clean up existing polls
+	deleteAllPolls()
+
+	// Create a new Poll
+	poll := testutils.NewRandPoll(1, 1, 2)
+
+	// Marshal the Poll to JSON
+	pollJSON, err := json.Marshal(poll)
+	if err != nil {
+		t.Fatalf("Failed to marshal poll to JSON: %v", err)
+	}
+
+	// Create a new HTTP request
+	req, err := http.NewRequest("POST", "/polls", bytes.NewBuffer(pollJSON))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	// Serve the request
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	// Check the status code
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// Serve the request again - Poll exists
+	req, err = http.NewRequest("POST", "/polls", bytes.NewBuffer(pollJSON))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+// testing poll handler AddPoll - Invalid body
+func TestAddPollBadRequest(t *testing.T) {
+	// clean up existing polls
+	deleteAllPolls()
+
+	// Create a new HTTP request without content type
+	req, err := http.NewRequest("POST", "/polls", bytes.NewBufferString("{}"))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	// Serve the request
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	// Check the status code
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// testing poll handler GetPoll and GetAllPolls - Success case
+func TestGetPoll(t *testing.T) {
+	// clean up existing polls
+	deleteAllPolls()
+	addPolls(t, 2, 1)
+
+	// Create a new HTTP request
+	req, err := http.NewRequest("GET", "/polls/1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	// Serve the request
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	// Check the status code
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Read the response body
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response body: %v", err)
+	}
+
+	// Unmarshal the response body
+	var poll db.Poll
+	err = json.Unmarshal(body, &poll)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	// Check the response body
+	storedPoll, _ := pollList.GetPoll(ctx, 1)
+	assert.Equal(t, storedPoll, poll)
+
+	// Create a new HTTP request - Get all polls
+	req, err = http.NewRequest("GET", "/polls", nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var polls []db.Poll
+	err = json.NewDecoder(resp.Body).Decode(&polls)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	// Check polls come ordered by pollId
+	assert.Equal(t, 2, len(polls))
+	assert.Equal(t, uint(1), polls[0].PollId)
+	assert.Equal(t, uint(2), polls[1].PollId)
+}
+
+// testing poll handler GetPoll - Poll doesnt exist
+func TestGetPollNotExists(t *testing.T) {
+	// clean up existing polls
+	deleteAllPolls()
+
+	for _, url := range []string{"/polls/1", "/polls/1/options", "/polls/1/options/1"} {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatalf("Failed to create HTTP request: %v", err)
+		}
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to serve request: %v", err)
+		}
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, url)
+	}
+
+	// Invalid id
+	req, err := http.NewRequest("GET", "/polls/abc", nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// testing poll handler UpdatePoll - Success case
+func TestUpdatePoll(t *testing.T) {
+	// clean up existing polls
+	deleteAllPolls()
+	addPolls(t, 1)
+	existingPoll, _ := pollList.GetPoll(ctx, 1)
+
+	// Marshal the update to JSON
+	update := testutils.NewRandPoll(1)
+	updateJSON, err := json.Marshal(update)
+	if err != nil {
+		t.Fatalf("Failed to marshal poll to JSON: %v", err)
+	}
+
+	// Create a new HTTP request
+	req, err := http.NewRequest("PUT", "/polls/1", bytes.NewBuffer(updateJSON))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	// Serve the request
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	// Check the status code
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Check title and question changed, options did not
+	poll, _ := pollList.GetPoll(ctx, 1)
+	assert.Equal(t, update.Title, poll.Title)
+	assert.Equal(t, update.Question, poll.Question)
+	assert.Equal(t, existingPoll.Options, poll.Options)
+
+	// Updating a poll that does not exist
+	req, err = http.NewRequest("PUT", "/polls/2", bytes.NewBuffer(updateJSON))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// testing poll handler DeletePoll - Success case
+func TestDeletePoll(t *testing.T) {
+	// clean up existing polls
+	deleteAllPolls()
+	addPolls(t, 1)
+
+	for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+		req, err := http.NewRequest("DELETE", "/polls/1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create HTTP request: %v", err)
+		}
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to serve request: %v", err)
+		}
+
+		assert.Equal(t, status, resp.StatusCode)
+	}
+
+	assert.Empty(t, pollList.GetAllPolls(ctx))
+}
+
+// testing poll handler options - add, get and delete
+func TestPollOptions(t *testing.T) {
+	// clean up existing polls
+	deleteAllPolls()
+	addPolls(t, 1)
+
+	// Marshal the Option to JSON
+	option := testutils.NewRandPollOption(3)
+	optionJSON, err := json.Marshal(option)
+	if err != nil {
+		t.Fatalf("Failed to marshal option to JSON: %v", err)
+	}
+
+	// Add option, then add it again
+	for _, status := range []int{http.StatusCreated, http.StatusConflict} {
+		req, err := http.NewRequest("POST", "/polls/1/options", bytes.NewBuffer(optionJSON))
+		if err != nil {
+			t.Fatalf("Failed to create HTTP request: %v", err)
+		}
+
+		req.Header.Add("Content-Type", "application/json")
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to serve request: %v", err)
+		}
+
+		assert.Equal(t, status, resp.StatusCode)
+	}
+
+	// Get all options
+	req, err := http.NewRequest("GET", "/polls/1/options", nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var options []db.PollOption
+	err = json.NewDecoder(resp.Body).Decode(&options)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	assert.Equal(t, 3, len(options))
+	assert.Equal(t, option, options[2])
+
+	// Get the new option
+	req, err = http.NewRequest("GET", fmt.Sprintf("/polls/1/options/%d", option.OptionId), nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var storedOption db.PollOption
+	err = json.NewDecoder(resp.Body).Decode(&storedOption)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	assert.Equal(t, option, storedOption)
+
+	// Delete the new option, then delete it again
+	for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("/polls/1/options/%d", option.OptionId), nil)
+		if err != nil {
+			t.Fatalf("Failed to create HTTP request: %v", err)
+		}
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to serve request: %v", err)
+		}
+
+		assert.Equal(t, status, resp.StatusCode)
+	}
+
+	options, _ = pollList.GetPollOptions(ctx, 1)
+	assert.Equal(t, 2, len(options))
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ProblemMediaType is the content type of every error response
+const ProblemMediaType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body. Code is the machine readable
+// form of Type and RequestId is the X-Request-ID of the failed request.
+// Errors lists the fields of the body that failed validation.
+type Problem struct {
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Status    int             `json:"status"`
+	Detail    string          `json:"detail,omitempty"`
+	Instance  string          `json:"instance,omitempty"`
+	Code      string          `json:"code"`
+	RequestId string          `json:"requestId,omitempty"`
+	Errors    []db.FieldError `json:"errors,omitempty"`
+}
+
+// Problem codes that do not come from a db error
+const (
+	CodeBadRequest    = "bad-request"
+	CodeInternalError = "internal-error"
+)
+
+// problemCodes maps the errors of db and of reading patches to their status
+// and code, errors that are not listed are internal errors
+var problemCodes = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{db.ErrVoterNotFound, http.StatusNotFound, "voter-not-found"},
+	{db.ErrPollNotFound, http.StatusNotFound, "poll-not-found"},
+	{db.ErrOptionNotFound, http.StatusNotFound, "option-not-found"},
+	{db.ErrVoteNotFound, http.StatusNotFound, "vote-not-found"},
+	{db.ErrVoterExists, http.StatusConflict, "voter-exists"},
+	{db.ErrPollExists, http.StatusConflict, "poll-exists"},
+	{db.ErrOptionExists, http.StatusConflict, "option-exists"},
+	{db.ErrAlreadyVoted, http.StatusConflict, "already-voted"},
+	{db.ErrVoteRecorded, http.StatusConflict, "vote-recorded"},
+	{db.ErrValidation, http.StatusUnprocessableEntity, "validation-failed"},
+	{db.ErrVoterIdMismatch, http.StatusBadRequest, "voter-id-mismatch"},
+	{db.ErrRevisionMismatch, http.StatusPreconditionFailed, "revision-mismatch"},
+	{errUnsupportedPatch, http.StatusUnsupportedMediaType, "unsupported-media-type"},
+	{errPatchFailed, http.StatusUnprocessableEntity, "patch-failed"},
+	{db.ErrUnavailable, http.StatusServiceUnavailable, "store-unavailable"},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, "timeout"},
+	{context.Canceled, http.StatusServiceUnavailable, "canceled"},
+}
+
+func problemFor(err error) (int, string) {
+	for _, problem := range problemCodes {
+		if errors.Is(err, problem.err) {
+			return problem.status, problem.code
+		}
+	}
+
+	return http.StatusInternalServerError, CodeInternalError
+}
+
+// sendProblem answers err as a problem, server errors are logged since the
+// client can not do anything about them
+func sendProblem(c *fiber.Ctx, status int, code string, err error) error {
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(c.UserContext(), "answering with a server error", "status", status, "code", code, "err", err)
+	}
+
+	problem := Problem{
+		Type:      "urn:voter-api:problem:" + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    err.Error(),
+		Instance:  c.OriginalURL(),
+		Code:      code,
+		RequestId: c.GetRespHeader(fiber.HeaderXRequestID),
+	}
+
+	var validationErr *db.ValidationError
+	if errors.As(err, &validationErr) {
+		problem.Errors = validationErr.Fields
+	}
+	var unavailableErr *db.UnavailableError
+	if errors.As(err, &unavailableErr) {
+		c.Set(fiber.HeaderRetryAfter, retryAfterSeconds(unavailableErr.RetryAfter))
+	}
+
+	return c.Status(status).JSON(problem, ProblemMediaType)
+}
+
+// retryAfterSeconds rounds up to whole seconds, Retry-After can not say less
+// than one
+func retryAfterSeconds(d time.Duration) string {
+	seconds := int64(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
+
+// sendError answers an error of a store, its status and code come from
+// problemCodes
+func sendError(c *fiber.Ctx, err error) error {
+	status, code := problemFor(err)
+	return sendProblem(c, status, code, err)
+}
+
+// sendBadRequest answers a request that could not be read, a path id that is
+// not a number or a body that is not JSON
+func sendBadRequest(c *fiber.Ctx, err error) error {
+	return sendProblem(c, http.StatusBadRequest, CodeBadRequest, err)
+}
+
+// sendUnprocessable answers a well formed body that refers to something that
+// does not exist, the code still names what was missing. Any other error is
+// answered like sendError.
+func sendUnprocessable(c *fiber.Ctx, err error) error {
+	status, code := problemFor(err)
+	if status != http.StatusNotFound {
+		return sendProblem(c, status, code, err)
+	}
+
+	return sendProblem(c, http.StatusUnprocessableEntity, code, err)
+}
+
+// ErrorHandler is the fiber error handler, errors handlers return instead of
+// answering them, unknown routes and recovered panics become problems too
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		code := strings.ReplaceAll(strings.ToLower(http.StatusText(fiberErr.Code)), " ", "-")
+		if code == "" {
+			code = CodeInternalError
+		}
+		return sendProblem(c, fiberErr.Code, code, err)
+	}
+
+	return sendError(c, err)
+}
@@ -0,0 +1,193 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abhi2687/voter-api/api"
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// doProblem serves a request that is expected to fail and decodes the
+// problem in the response
+func doProblem(t *testing.T, method string, path string, body interface{}) (*http.Response, api.Problem) {
+	reqBody := bytes.NewBuffer(nil)
+	if body != nil {
+		bodyJSON, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to marshal body to JSON: %v", err)
+		}
+		reqBody = bytes.NewBuffer(bodyJSON)
+	}
+
+	req, err := http.NewRequest(method, path, reqBody)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+	assert.Equal(t, api.ProblemMediaType, resp.Header.Get("Content-Type"))
+
+	var problem api.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	return resp, problem
+}
+
+// testing errors are answered as problem details
+func TestProblemDetails(t *testing.T) {
+	// clean up existing voters, polls and votes
+	deleteAllVoters()
+	deleteAllPolls()
+	deleteAllVotes()
+
+	voter1 := testutils.NewRandVoter(1)
+	addVoters(t, voter1.VoterId)
+	addPolls(t, 1)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{"VoterNotFound", "GET", "/voters/9", nil, http.StatusNotFound, "voter-not-found"},
+		{"VoterExists", "POST", "/voters", voter1, http.StatusConflict, "voter-exists"},
+		{"PollNotFound", "GET", "/polls/9", nil, http.StatusNotFound, "poll-not-found"},
+		{"PollExists", "POST", "/polls", testutils.NewRandPoll(1), http.StatusConflict, "poll-exists"},
+		{"OptionNotFound", "GET", "/polls/1/options/9", nil, http.StatusNotFound, "option-not-found"},
+		{"VoteNotFound", "GET", "/votes/9", nil, http.StatusNotFound, "vote-not-found"},
+		{"HistoryForMissingVoter", "POST", "/voters/9/polls", testutils.NewRandPollVoteRecord(1), http.StatusNotFound, "voter-not-found"},
+		{"HistoryForMissingPoll", "POST", "/voters/1/polls", testutils.NewRandPollVoteRecord(9), http.StatusUnprocessableEntity, "poll-not-found"},
+		{"VoteForMissingOption", "POST", "/voters/1/vote", fiber.Map{"pollId": 1, "optionId": 9}, http.StatusUnprocessableEntity, "option-not-found"},
+		{"InvalidVoter", "POST", "/voters", fiber.Map{"voterId": 2, "name": "", "email": "x"}, http.StatusUnprocessableEntity, "validation-failed"},
+		{"InvalidHistory", "POST", "/voters/1/polls", fiber.Map{"pollId": 0}, http.StatusUnprocessableEntity, "validation-failed"},
+		{"BadVoterId", "GET", "/voters/abc", nil, http.StatusBadRequest, "bad-request"},
+		{"UnknownRoute", "GET", "/nothing-here", nil, http.StatusNotFound, "not-found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, problem := doProblem(t, tt.method, tt.path, tt.body)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.status, problem.Status)
+			assert.Equal(t, tt.code, problem.Code)
+			assert.Equal(t, "urn:voter-api:problem:"+tt.code, problem.Type)
+			assert.Equal(t, http.StatusText(tt.status), problem.Title)
+			assert.Equal(t, tt.path, problem.Instance)
+			assert.NotEmpty(t, problem.Detail)
+
+			// the request id ties the problem to the request
+			assert.NotEmpty(t, problem.RequestId)
+			assert.Equal(t, resp.Header.Get(fiber.HeaderXRequestID), problem.RequestId)
+		})
+	}
+}
+
+// testing a request id sent by the client is echoed in the problem
+func TestProblemKeepsRequestId(t *testing.T) {
+	req, err := http.NewRequest("GET", "/voters/999", nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+	req.Header.Add(fiber.HeaderXRequestID, "req-123")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	var problem api.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	assert.Equal(t, "req-123", problem.RequestId)
+}
+
+// testing validation problems list every field that failed
+func TestValidationProblem(t *testing.T) {
+	// clean up existing voters
+	deleteAllVoters()
+
+	voterPoll := testutils.NewRandPollVoteRecord(1)
+	voterPoll.VoteDate = time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name   string
+		path   string
+		body   interface{}
+		errors []db.FieldError
+	}{
+		{"Voter", "/voters", fiber.Map{"name": "Jo", "email": "jo@", "voteHistory": []fiber.Map{{"pollId": 1}}}, []db.FieldError{
+			{Field: "voterId", Rule: "required", Message: "must be greater than 0"},
+			{Field: "email", Rule: "email", Message: "must be a valid email address"},
+			{Field: "voteHistory", Rule: "empty", Message: "must be empty"},
+		}},
+		{"VoterHistory", "/voters/1/polls", voterPoll, []db.FieldError{
+			{Field: "voteDate", Rule: "past", Message: "must not be in the future"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, problem := doProblem(t, "POST", tt.path, tt.body)
+			assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+			assert.Equal(t, "validation-failed", problem.Code)
+			assert.Equal(t, tt.errors, problem.Errors)
+		})
+	}
+}
+
+// testing an unreachable store is answered with 503 and a Retry-After
+func TestUnavailableProblem(t *testing.T) {
+	standIn := testutils.StartRedisStandIn(t)
+	voterCache, err := db.NewWithCacheInstance(standIn.Addr())
+	assert.Nil(t, err)
+	handler, err := api.NewWithStore(voterCache)
+	assert.Nil(t, err)
+
+	unavailableApp := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	unavailableApp.Get("/voters/:id", handler.GetVoter)
+	unavailableApp.Post("/voters", handler.AddVoter)
+	standIn.Close()
+
+	assertUnavailable := func(req *http.Request) {
+		resp, err := unavailableApp.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to serve request: %v", err)
+		}
+
+		var problem api.Problem
+		if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+			t.Fatalf("Failed to unmarshal response body: %v", err)
+		}
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, "store-unavailable", problem.Code)
+		assert.NotEmpty(t, resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+
+	for i := 0; i < db.RedisBreakerFailures; i++ {
+		assertUnavailable(httptest.NewRequest("GET", "/voters/1", nil))
+	}
+	assert.Equal(t, db.BreakerOpen, voterCache.BreakerState())
+
+	// writes fail fast once the breaker is open
+	bodyJSON, _ := json.Marshal(testutils.NewRandVoter(1))
+	req := httptest.NewRequest("POST", "/voters", bytes.NewBuffer(bodyJSON))
+	req.Header.Add("Content-Type", "application/json")
+	assertUnavailable(req)
+}
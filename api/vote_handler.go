@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+type VoteAPI struct {
+	db     db.VoteStore
+	polls  db.PollStore
+	voters db.VoterStore
+}
+
+// NewVoteAPI returns a VoteAPI backed by any VoteStore, ballots are checked
+// against the options of polls and turnout is measured against voters
+func NewVoteAPI(store db.VoteStore, polls db.PollStore, voters db.VoterStore) (*VoteAPI, error) {
+	if store == nil {
+		return nil, errors.New("vote store is required")
+	}
+	if polls == nil {
+		return nil, errors.New("poll store is required")
+	}
+	if voters == nil {
+		return nil, errors.New("voter store is required")
+	}
+
+	return &VoteAPI{db: store, polls: polls, voters: voters}, nil
+}
+
+// resolveOption finds the option the ballot is for, by optionId or else by
+// its text in value, and fills in both
+func (v *VoteAPI) resolveOption(ctx context.Context, vote db.Vote) (db.Vote, error) {
+	poll, err := v.polls.GetPoll(ctx, vote.PollId)
+	if err != nil {
+		return db.Vote{}, err
+	}
+
+	for _, option := range poll.Options {
+		if (vote.OptionId != 0 && option.OptionId == vote.OptionId) ||
+			(vote.OptionId == 0 && vote.Value != "" && option.Text == vote.Value) {
+			vote.OptionId = option.OptionId
+			vote.Value = option.Text
+			return vote, nil
+		}
+	}
+
+	return db.Vote{}, db.ErrOptionNotFound
+}
+
+// castVote checks the ballot against the poll and stores it
+func (v *VoteAPI) castVote(c *fiber.Ctx, vote db.Vote) error {
+	vote, err := v.resolveOption(c.UserContext(), vote)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "checking ballot failed", "err", err)
+		return sendUnprocessable(c, err)
+	}
+
+	vote, err = v.db.CastVote(c.UserContext(), vote)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "casting vote failed", "err", err)
+		// the poll or option went away since it was resolved
+		if errors.Is(err, db.ErrPollNotFound) || errors.Is(err, db.ErrOptionNotFound) {
+			return sendUnprocessable(c, err)
+		}
+		return sendError(c, err)
+	}
+
+	c.Location(fmt.Sprintf("/votes/%d", vote.VoteId))
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusCreated, newHALVote(c, vote))
+	}
+	return c.Status(http.StatusCreated).JSON(vote)
+}
+
+func (v *VoteAPI) CastVote(c *fiber.Ctx) error {
+	var vote db.Vote
+	if err := c.BodyParser(&vote); err != nil {
+		slog.DebugContext(c.UserContext(), "parsing request body failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	return v.castVote(c, vote)
+}
+
+// CastVoterVote casts a ballot for the voter in the path, a voterId in the
+// body must match it
+func (v *VoteAPI) CastVoterVote(c *fiber.Ctx) error {
+	var vote db.Vote
+	voterIdStr := c.Params("id")
+	voterId, err := strconv.ParseUint(voterIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing voterId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	if err := c.BodyParser(&vote); err != nil {
+		slog.DebugContext(c.UserContext(), "parsing request body failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	if vote.VoterId != 0 && vote.VoterId != uint(voterId) {
+		slog.DebugContext(c.UserContext(), "casting vote failed", "err", db.ErrVoterIdMismatch)
+		return sendError(c, db.ErrVoterIdMismatch)
+	}
+	vote.VoterId = uint(voterId)
+
+	return v.castVote(c, vote)
+}
+
+func (v *VoteAPI) GetVote(c *fiber.Ctx) error {
+	voteIdStr := c.Params("id")
+	voteId, err := strconv.ParseUint(voteIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing voteId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	vote, err := v.db.GetVote(c.UserContext(), uint(voteId))
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "getting vote failed", "err", err)
+		return sendError(c, err)
+	}
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALVote(c, vote))
+	}
+	return c.Status(http.StatusOK).JSON(vote)
+}
+
+func (v *VoteAPI) GetAllVotes(c *fiber.Ctx) error {
+	votes := v.db.GetAllVotes(c.UserContext())
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALVoteCollection(c, votes))
+	}
+	return c.Status(http.StatusOK).JSON(votes)
+}
+
+func (v *VoteAPI) DeleteAllVotes(c *fiber.Ctx) error {
+	v.db.DeleteAllVotes(c.UserContext())
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALStatus(Links{}.add(c, "votes", RouteVotes, nil)))
+	}
+	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
+}
+
+// GetPollResults reports the running tally of the poll against the count of
+// registered voters, it never walks the votes or the voters
+func (v *VoteAPI) GetPollResults(c *fiber.Ctx) error {
+	pollIdStr := c.Params("id")
+	pollId, err := strconv.ParseUint(pollIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing pollId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	poll, err := v.polls.GetPoll(c.UserContext(), uint(pollId))
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "getting poll failed", "err", err)
+		return sendError(c, err)
+	}
+
+	tally, err := v.db.GetTally(c.UserContext(), uint(pollId))
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "getting tally failed", "err", err)
+		return sendError(c, err)
+	}
+
+	registered, err := v.voters.CountVoters(c.UserContext())
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "counting voters failed", "err", err)
+		return sendError(c, err)
+	}
+
+	results := db.NewPollResults(poll, tally, registered)
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALPollResults(c, results))
+	}
+	return c.Status(http.StatusOK).JSON(results)
+}
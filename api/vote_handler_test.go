@@ -0,0 +1,335 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/abhi2687/voter-api/api"
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func deleteAllVotes() {
+	req, err := http.NewRequest("DELETE", "/votes", nil)
+	if err != nil {
+		fmt.Printf("failed to create HTTP request to delete all votes: %v", err)
+		return
+	}
+
+	// Serve the request
+	_, err = app.Test(req)
+	if err != nil {
+		fmt.Printf("failed to delete all votes: %v", err)
+	}
+}
+
+// addVoters registers a voter for every voterId
+func addVoters(t *testing.T, voterIds ...uint) {
+	for _, voterId := range voterIds {
+		if err := voterList.AddVoter(ctx, testutils.NewRandVoter(voterId)); err != nil {
+			t.Fatalf("Failed to add voter %d: %v", voterId, err)
+		}
+	}
+}
+
+// addVoterPolls records vote history straight in the store, voters can not
+// be created with history. Polls it names that do not exist yet are added.
+func addVoterPolls(t *testing.T, voterId uint, voterPolls ...db.VoterHistory) {
+	for _, voterPoll := range voterPolls {
+		err := pollList.AddPoll(ctx, testutils.NewRandPoll(voterPoll.PollId))
+		if err != nil && !errors.Is(err, db.ErrPollExists) {
+			t.Fatalf("Failed to add poll %d: %v", voterPoll.PollId, err)
+		}
+		if err := voterList.AddVoterPoll(ctx, voterPoll, voterId); err != nil {
+			t.Fatalf("Failed to add poll %d to voter %d: %v", voterPoll.PollId, voterId, err)
+		}
+	}
+}
+
+// castVote posts body to path and decodes the vote in the response
+func castVote(t *testing.T, path string, body interface{}) (*http.Response, db.Vote) {
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal vote to JSON: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", path, bytes.NewBuffer(bodyJSON))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	var vote db.Vote
+	if resp.StatusCode == http.StatusCreated {
+		if err := json.NewDecoder(resp.Body).Decode(&vote); err != nil {
+			t.Fatalf("Failed to unmarshal response body: %v", err)
+		}
+	}
+
+	return resp, vote
+}
+
+// testing vote handler NewVoteAPI function
+func TestNewVoteAPI(t *testing.T) {
+	voterList, _ := db.New()
+	pollList, _ := db.NewPollList(voterList)
+	voteList, _ := db.NewVoteList(voterList)
+
+	voteHandler, err := api.NewVoteAPI(voteList, pollList, voterList)
+	assert.Nil(t, err)
+	assert.NotNil(t, voteHandler)
+
+	// every store is required
+	voteHandler, err = api.NewVoteAPI(nil, pollList, voterList)
+	assert.NotNil(t, err)
+	assert.Nil(t, voteHandler)
+
+	voteHandler, err = api.NewVoteAPI(voteList, nil, voterList)
+	assert.NotNil(t, err)
+	assert.Nil(t, voteHandler)
+
+	voteHandler, err = api.NewVoteAPI(voteList, pollList, nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, voteHandler)
+}
+
+// testing vote handler CastVoterVote - Success case
+func TestCastVoterVote(t *testing.T) {
+	// clean up existing voters, polls and votes
+	deleteAllVoters()
+	deleteAllPolls()
+	deleteAllVotes()
+
+	addVoters(t, 1)
+	addPolls(t, 1)
+	poll, _ := pollList.GetPoll(ctx, 1)
+
+	resp, vote := castVote(t, "/voters/1/vote", fiber.Map{"pollId": 1, "optionId": 2})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.NotZero(t, vote.VoteId)
+	assert.Equal(t, uint(1), vote.VoterId)
+	assert.Equal(t, uint(1), vote.PollId)
+	assert.Equal(t, uint(2), vote.OptionId)
+	assert.Equal(t, poll.Options[1].Text, vote.Value)
+	assert.Equal(t, fmt.Sprintf("/votes/%d", vote.VoteId), resp.Header.Get("Location"))
+
+	// the vote can be read back
+	req, err := http.NewRequest("GET", fmt.Sprintf("/votes/%d", vote.VoteId), nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response body: %v", err)
+	}
+
+	var storedVote db.Vote
+	if err := json.Unmarshal(body, &storedVote); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	assert.Equal(t, vote, storedVote)
+
+	// the voter history points at the vote
+	voterPoll, err := voterList.GetVoterPoll(ctx, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, vote.VoteId, voterPoll.VoteId)
+
+	// a second ballot in the same poll is rejected
+	resp, _ = castVote(t, "/voters/1/vote", fiber.Map{"pollId": 1, "optionId": 1})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// the history entry of the ballot can not be deleted
+	req, err = http.NewRequest("DELETE", "/voters/1/polls/1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	var problem api.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, "vote-recorded", problem.Code)
+}
+
+// testing vote handler CastVote - option picked by its text
+func TestCastVoteByValue(t *testing.T) {
+	// clean up existing voters, polls and votes
+	deleteAllVoters()
+	deleteAllPolls()
+	deleteAllVotes()
+
+	addVoters(t, 1)
+	addPolls(t, 1)
+	poll, _ := pollList.GetPoll(ctx, 1)
+
+	resp, vote := castVote(t, "/votes", fiber.Map{"voterId": 1, "pollId": 1, "value": poll.Options[0].Text})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, poll.Options[0].OptionId, vote.OptionId)
+	assert.Equal(t, poll.Options[0].Text, vote.Value)
+}
+
+// testing vote handler CastVote - ballots that do not fit the poll or voter
+func TestCastVoteRejected(t *testing.T) {
+	// clean up existing voters, polls and votes
+	deleteAllVoters()
+	deleteAllPolls()
+	deleteAllVotes()
+
+	addVoters(t, 1)
+	addPolls(t, 1)
+
+	tests := []struct {
+		name   string
+		path   string
+		body   fiber.Map
+		status int
+	}{
+		{"UnknownPoll", "/voters/1/vote", fiber.Map{"pollId": 9, "optionId": 1}, http.StatusUnprocessableEntity},
+		{"UnknownOption", "/voters/1/vote", fiber.Map{"pollId": 1, "optionId": 9}, http.StatusUnprocessableEntity},
+		{"UnknownValue", "/voters/1/vote", fiber.Map{"pollId": 1, "value": "not an option"}, http.StatusUnprocessableEntity},
+		{"NoOption", "/voters/1/vote", fiber.Map{"pollId": 1}, http.StatusUnprocessableEntity},
+		{"VoterMismatch", "/voters/1/vote", fiber.Map{"voterId": 2, "pollId": 1, "optionId": 1}, http.StatusBadRequest},
+		{"BadVoterId", "/voters/abc/vote", fiber.Map{"pollId": 1, "optionId": 1}, http.StatusBadRequest},
+		{"UnknownVoter", "/votes", fiber.Map{"voterId": 9, "pollId": 1, "optionId": 1}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := castVote(t, tt.path, tt.body)
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+
+	// nothing was stored
+	voterPolls, _ := voterList.GetVoterPolls(ctx, 1)
+	assert.Empty(t, voterPolls)
+	assert.Empty(t, voteList.GetAllVotes(ctx))
+}
+
+// testing vote handler GetVote - Vote does not exist
+func TestGetVoteNotExists(t *testing.T) {
+	deleteAllVotes()
+
+	req, err := http.NewRequest("GET", "/votes/999", nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// testing vote handler GetAllVotes
+func TestGetAllVotes(t *testing.T) {
+	// clean up existing voters, polls and votes
+	deleteAllVoters()
+	deleteAllPolls()
+	deleteAllVotes()
+
+	addVoters(t, 1, 2)
+	addPolls(t, 1)
+
+	_, vote1 := castVote(t, "/voters/1/vote", fiber.Map{"pollId": 1, "optionId": 1})
+	_, vote2 := castVote(t, "/voters/2/vote", fiber.Map{"pollId": 1, "optionId": 2})
+
+	req, err := http.NewRequest("GET", "/votes", nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var votes []db.Vote
+	if err := json.NewDecoder(resp.Body).Decode(&votes); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	assert.Equal(t, []db.Vote{vote1, vote2}, votes)
+}
+
+// testing vote handler GetPollResults
+func TestGetPollResults(t *testing.T) {
+	// clean up existing voters, polls and votes
+	deleteAllVoters()
+	deleteAllPolls()
+	deleteAllVotes()
+
+	addVoters(t, 1, 2, 3, 4)
+	addPolls(t, 1)
+	poll, _ := pollList.GetPoll(ctx, 1)
+
+	castVote(t, "/voters/1/vote", fiber.Map{"pollId": 1, "optionId": 1})
+	castVote(t, "/voters/2/vote", fiber.Map{"pollId": 1, "optionId": 2})
+	castVote(t, "/voters/3/vote", fiber.Map{"pollId": 1, "optionId": 2})
+
+	req, err := http.NewRequest("GET", "/polls/1/results", nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var results db.PollResults
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	assert.Equal(t, db.PollResults{
+		PollId:   1,
+		Title:    poll.Title,
+		Question: poll.Question,
+		Options: []db.OptionResult{
+			{OptionId: 1, Text: poll.Options[0].Text, Votes: 1, Percentage: 33.33},
+			{OptionId: 2, Text: poll.Options[1].Text, Votes: 2, Percentage: 66.67},
+		},
+		TotalBallots:     3,
+		RegisteredVoters: 4,
+		Turnout:          75,
+	}, results)
+
+	// unknown poll
+	req, err = http.NewRequest("GET", "/polls/9/results", nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
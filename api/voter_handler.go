@@ -1,8 +1,8 @@
 package api
 
 import (
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strconv"
 
@@ -11,32 +11,49 @@ import (
 )
 
 type VoterAPI struct {
-	db *db.VoterList
+	db db.VoterStore
 }
 
+// New returns a VoterAPI backed by the in-memory stores
 func New() (*VoterAPI, error) {
 	dbHandler, err := db.New()
 	if err != nil {
 		return nil, err
 	}
 
-	return &VoterAPI{db: dbHandler}, nil
+	return NewWithStore(dbHandler)
+}
+
+// NewWithStore returns a VoterAPI backed by any VoterStore, the store checks
+// the polls referenced by vote history exist
+func NewWithStore(store db.VoterStore) (*VoterAPI, error) {
+	if store == nil {
+		return nil, errors.New("voter store is required")
+	}
+
+	return &VoterAPI{db: store}, nil
 }
 
 func (v *VoterAPI) AddVoter(c *fiber.Ctx) error {
 	var voter db.Voter
-	fmt.Println("Request body: ", string(c.Body()))
 	if err := c.BodyParser(&voter); err != nil {
-		log.Println("Error parsing request body: ", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing request body failed", "err", err)
+		return sendBadRequest(c, err)
 	}
+	slog.DebugContext(c.UserContext(), "adding voter", "voter", voter)
 
-	err := v.db.AddVoter(voter)
+	err := v.db.AddVoter(c.UserContext(), voter)
 	if err != nil {
-		log.Println("Error adding voter: ", err)
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "adding voter failed", "err", err)
+		return sendError(c, err)
 	}
 
+	voter.Revision = db.FirstRevision
+	c.Set(fiber.HeaderETag, voterETag(voter))
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusCreated, newHALVoterResource(c, voter))
+	}
 	return c.Status(http.StatusCreated).JSON(voter)
 }
 
@@ -44,65 +61,160 @@ func (v *VoterAPI) GetVoter(c *fiber.Ctx) error {
 	voterIdStr := c.Params("id")
 	voterId, err := strconv.ParseUint(voterIdStr, 10, 32)
 	if err != nil {
-		log.Println("Error parsing voterId", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing voterId failed", "err", err)
+		return sendBadRequest(c, err)
 	}
-	voter, err := v.db.GetVoter(uint(voterId))
+	voter, err := v.db.GetVoter(c.UserContext(), uint(voterId))
 	if err != nil {
-		log.Println("Error getting voter: ", err)
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "getting voter failed", "err", err)
+		return sendError(c, err)
 	}
 
+	// If-None-Match naming the current revision is answered without a body
+	c.Set(fiber.HeaderETag, voterETag(voter))
+	if c.Fresh() {
+		return c.SendStatus(http.StatusNotModified)
+	}
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALVoterResource(c, voter))
+	}
 	return c.Status(http.StatusOK).JSON(voter)
 }
 
+// GetAllVoters lists voters ordered by voterId unless sort says otherwise.
+// limit, offset or cursor select a page and name~, email and votedInPoll
+// filter it, see parseVoterQuery.
 func (v *VoterAPI) GetAllVoters(c *fiber.Ctx) error {
-	voters := v.db.GetAllVoters()
-	return c.Status(http.StatusOK).JSON(voters)
+	query, err := parseVoterQuery(c)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing voter query failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	page, err := v.db.QueryVoters(c.UserContext(), query)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "getting voters failed", "err", err)
+		return sendError(c, err)
+	}
+
+	setPageHeaders(c, page)
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALVoterCollection(c, page))
+	}
+	return c.Status(http.StatusOK).JSON(page.Voters)
 }
 
 func (v *VoterAPI) DeleteAllVoters(c *fiber.Ctx) error {
-	v.db.DeleteAllVoters()
+	v.db.DeleteAllVoters(c.UserContext())
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALStatus(Links{}.add(c, "voters", RouteVoters, nil)))
+	}
 	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
 }
 
+// UpdateVoter replaces name and email of the voter, a voterId in the body
+// must match the path and the vote history is kept. If-Match makes the
+// update conditional on the revision, as it does for PatchVoter and
+// DeleteVoter.
 func (v *VoterAPI) UpdateVoter(c *fiber.Ctx) error {
 	var voter db.Voter
 	voterIdStr := c.Params("id")
 	voterId, err := strconv.ParseUint(voterIdStr, 10, 32)
 	if err != nil {
-		log.Println("Error parsing voterId", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing voterId failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
 	if err := c.BodyParser(&voter); err != nil {
-		log.Println("Error parsing request body", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing request body failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
-	err = v.db.UpdateVoter(voter, uint(voterId))
+	precondition, err := ifMatchRevision(c)
 	if err != nil {
-		log.Println("Error updating voter: ", err)
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing If-Match failed", "err", err)
+		return sendIfMatchError(c, err)
+	}
+
+	updated, err := v.db.UpdateVoter(c.UserContext(), voter, uint(voterId), precondition.revision)
+	if err = precondition.storeError(err); err != nil {
+		slog.DebugContext(c.UserContext(), "updating voter failed", "err", err)
+		return sendError(c, err)
 	}
 
+	c.Set(fiber.HeaderETag, voterETag(updated))
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALStatus(Links{}.add(c, "voter", RouteVoter, fiber.Map{"id": voterId})))
+	}
 	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
 }
 
+// PatchVoter applies the patch in the body to the voter and answers the
+// patched voter, the Content-Type says which kind of patch it is
+func (v *VoterAPI) PatchVoter(c *fiber.Ctx) error {
+	voterIdStr := c.Params("id")
+	voterId, err := strconv.ParseUint(voterIdStr, 10, 32)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing voterId failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	patch, err := newVoterPatch(c.Get(fiber.HeaderContentType), c.Body())
+	if errors.Is(err, errUnsupportedPatch) {
+		slog.DebugContext(c.UserContext(), "reading patch failed", "err", err)
+		c.Set("Accept-Patch", MergePatchMediaType+", "+JSONPatchMediaType)
+		return sendError(c, err)
+	}
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "reading patch failed", "err", err)
+		return sendBadRequest(c, err)
+	}
+
+	precondition, err := ifMatchRevision(c)
+	if err != nil {
+		slog.DebugContext(c.UserContext(), "parsing If-Match failed", "err", err)
+		return sendIfMatchError(c, err)
+	}
+
+	voter, err := v.db.PatchVoter(c.UserContext(), uint(voterId), precondition.revision, patch)
+	if err = precondition.storeError(err); err != nil {
+		slog.DebugContext(c.UserContext(), "patching voter failed", "err", err)
+		return sendError(c, err)
+	}
+
+	c.Set(fiber.HeaderETag, voterETag(voter))
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALVoterResource(c, voter))
+	}
+	return c.Status(http.StatusOK).JSON(voter)
+}
+
 func (v *VoterAPI) DeleteVoter(c *fiber.Ctx) error {
 	voterIdStr := c.Params("id")
 	voterId, err := strconv.ParseUint(voterIdStr, 10, 32)
 	if err != nil {
-		log.Println("Error parsing voterId", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing voterId failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
-	err = v.db.DeleteVoter(uint(voterId))
+	precondition, err := ifMatchRevision(c)
 	if err != nil {
-		log.Println("Error deleting voter: ", err)
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing If-Match failed", "err", err)
+		return sendIfMatchError(c, err)
 	}
 
+	err = v.db.DeleteVoter(c.UserContext(), uint(voterId), precondition.revision)
+	if err = precondition.storeError(err); err != nil {
+		slog.DebugContext(c.UserContext(), "deleting voter failed", "err", err)
+		return sendError(c, err)
+	}
+
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALStatus(Links{}.add(c, "voters", RouteVoters, nil)))
+	}
 	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
 }
 
@@ -110,15 +222,18 @@ func (v *VoterAPI) GetVoterPolls(c *fiber.Ctx) error {
 	voterIdStr := c.Params("id")
 	voterId, err := strconv.ParseUint(voterIdStr, 10, 32)
 	if err != nil {
-		log.Println("Error parsing voterId", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing voterId failed", "err", err)
+		return sendBadRequest(c, err)
 	}
-	voterPolls, err := v.db.GetVoterPolls(uint(voterId))
+	voterPolls, err := v.db.GetVoterPolls(c.UserContext(), uint(voterId))
 	if err != nil {
-		log.Println("Error getting voter: ", err)
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "getting voter failed", "err", err)
+		return sendError(c, err)
 	}
 
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALVoterHistoryCollection(c, uint(voterId), voterPolls))
+	}
 	return c.Status(http.StatusOK).JSON(voterPolls)
 }
 
@@ -127,21 +242,32 @@ func (v *VoterAPI) AddVoterPoll(c *fiber.Ctx) error {
 	voterIdStr := c.Params("id")
 	voterId, err := strconv.ParseUint(voterIdStr, 10, 32)
 	if err != nil {
-		log.Println("Error parsing voterId", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing voterId failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
 	if err := c.BodyParser(&voterPoll); err != nil {
-		log.Println("Error parsing request body: ", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing request body failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
-	err = v.db.AddVoterPoll(voterPoll, uint(voterId))
+	// the voter is in the path and the poll in the body, only a missing
+	// poll makes the body unprocessable
+	err = v.db.AddVoterPoll(c.UserContext(), voterPoll, uint(voterId))
+	if errors.Is(err, db.ErrPollNotFound) {
+		slog.DebugContext(c.UserContext(), "adding voter poll failed", "err", err)
+		return sendUnprocessable(c, err)
+	}
 	if err != nil {
-		log.Println("Error adding voter poll: ", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "adding voter poll failed", "err", err)
+		return sendError(c, err)
 	}
 
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusCreated, newHALStatus(Links{}.
+			add(c, "voterPoll", RouteVoterPoll, fiber.Map{"id": voterId, "pollid": voterPoll.PollId}).
+			add(c, "voter", RouteVoter, fiber.Map{"id": voterId})))
+	}
 	return c.Status(http.StatusCreated).JSON(fiber.Map{"status": "ok"})
 }
 
@@ -149,23 +275,26 @@ func (v *VoterAPI) GetVoterPoll(c *fiber.Ctx) error {
 	voterIdStr := c.Params("id")
 	voterId, err := strconv.ParseUint(voterIdStr, 10, 32)
 	if err != nil {
-		log.Println("Error parsing voterId", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing voterId failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
 	pollIdStr := c.Params("pollid")
 	pollId, err := strconv.ParseUint(pollIdStr, 10, 32)
 	if err != nil {
-		log.Println("Error parsing pollId", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing pollId failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
-	voterPoll, err := v.db.GetVoterPoll(uint(voterId), uint(pollId))
+	voterPoll, err := v.db.GetVoterPoll(c.UserContext(), uint(voterId), uint(pollId))
 	if err != nil {
-		log.Println("Error getting voter poll: ", err)
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "getting voter poll failed", "err", err)
+		return sendError(c, err)
 	}
 
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALVoterHistory(c, uint(voterId), voterPoll))
+	}
 	return c.Status(http.StatusOK).JSON(voterPoll)
 }
 
@@ -174,28 +303,33 @@ func (v *VoterAPI) UpdateVoterPoll(c *fiber.Ctx) error {
 	voterIdStr := c.Params("id")
 	voterId, err := strconv.ParseUint(voterIdStr, 10, 32)
 	if err != nil {
-		log.Println("Error parsing voterId", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing voterId failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
 	pollIdStr := c.Params("pollid")
 	pollId, err := strconv.ParseUint(pollIdStr, 10, 32)
 	if err != nil {
-		log.Println("Error parsing pollId", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing pollId failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
 	if err := c.BodyParser(&voterPoll); err != nil {
-		log.Println("Error parsing request body: ", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing request body failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
-	err = v.db.UpdateVoterPoll(voterPoll, uint(voterId), uint(pollId))
+	err = v.db.UpdateVoterPoll(c.UserContext(), voterPoll, uint(voterId), uint(pollId))
 	if err != nil {
-		log.Println("Error updating voter poll: ", err)
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "updating voter poll failed", "err", err)
+		return sendError(c, err)
 	}
 
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALStatus(Links{}.
+			add(c, "voterPoll", RouteVoterPoll, fiber.Map{"id": voterId, "pollid": pollId}).
+			add(c, "voter", RouteVoter, fiber.Map{"id": voterId})))
+	}
 	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
 }
 
@@ -203,22 +337,25 @@ func (v *VoterAPI) DeleteVoterPoll(c *fiber.Ctx) error {
 	voterIdStr := c.Params("id")
 	voterId, err := strconv.ParseUint(voterIdStr, 10, 32)
 	if err != nil {
-		log.Println("Error parsing voterId", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing voterId failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
 	pollIdStr := c.Params("pollid")
 	pollId, err := strconv.ParseUint(pollIdStr, 10, 32)
 	if err != nil {
-		log.Println("Error parsing pollId", err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "parsing pollId failed", "err", err)
+		return sendBadRequest(c, err)
 	}
 
-	err = v.db.DeleteVoterPoll(uint(voterId), uint(pollId))
+	err = v.db.DeleteVoterPoll(c.UserContext(), uint(voterId), uint(pollId))
 	if err != nil {
-		log.Println("Error deleting voter poll: ", err)
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		slog.DebugContext(c.UserContext(), "deleting voter poll failed", "err", err)
+		return sendError(c, err)
 	}
 
+	if wantsHAL(c) {
+		return sendHAL(c, http.StatusOK, newHALStatus(Links{}.add(c, "voter", RouteVoter, fiber.Map{"id": voterId})))
+	}
 	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
 }
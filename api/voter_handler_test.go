@@ -2,16 +2,19 @@ package api_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"testing"
 
 	"github.com/abhi2687/voter-api/api"
 	"github.com/abhi2687/voter-api/db"
 	"github.com/abhi2687/voter-api/testutils"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,25 +22,57 @@ var (
 	// BASE_API = "http://localhost:1080"
 
 	// cli         = resty.New()
-	app             = fiber.New()
-	voterHandler, _ = api.New()
+	app             = fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	voterList, _    = db.New()
+	pollList, _     = db.NewPollList(voterList)
+	voterHandler, _ = api.NewWithStore(voterList)
+	pollHandler, _  = api.NewPollAPI(pollList)
+	voteList, _     = db.NewVoteList(voterList)
+	voteHandler, _  = api.NewVoteAPI(voteList, pollList, voterList)
+	ctx             = context.Background()
 )
 
 func init() {
+	app.Use(requestid.New())
+
 	app.Post("/voters", voterHandler.AddVoter)
 	app.Delete("/voters", voterHandler.DeleteAllVoters)
-	app.Get("/voters/:id", voterHandler.GetVoter)
-	app.Get("/voters", voterHandler.GetAllVoters)
+	app.Get("/voters/:id", voterHandler.GetVoter).Name(api.RouteVoter)
+	app.Get("/voters", voterHandler.GetAllVoters).Name(api.RouteVoters)
 	app.Put("/voters/:id", voterHandler.UpdateVoter)
+	app.Patch("/voters/:id", voterHandler.PatchVoter)
 	app.Delete("/voters/:id", voterHandler.DeleteVoter)
-	app.Get("/voters/:id/polls", voterHandler.GetVoterPolls)
+	app.Get("/voters/:id/polls", voterHandler.GetVoterPolls).Name(api.RouteVoterPolls)
+	app.Get("/voters/:id/history", voterHandler.GetVoterPolls).Name(api.RouteVoterHistory)
 	app.Post("/voters/:id/polls", voterHandler.AddVoterPoll)
-	app.Get("/voters/:id/polls/:pollid", voterHandler.GetVoterPoll)
+	app.Get("/voters/:id/polls/:pollid", voterHandler.GetVoterPoll).Name(api.RouteVoterPoll)
 	app.Put("/voters/:id/polls/:pollid", voterHandler.UpdateVoterPoll)
 	app.Delete("/voters/:id/polls/:pollid", voterHandler.DeleteVoterPoll)
+	app.Post("/voters/:id/vote", voteHandler.CastVoterVote).Name(api.RouteVoterVote)
+
+	app.Post("/polls", pollHandler.AddPoll)
+	app.Delete("/polls", pollHandler.DeleteAllPolls)
+	app.Get("/polls/:id", pollHandler.GetPoll).Name(api.RoutePoll)
+	app.Get("/polls", pollHandler.GetAllPolls).Name(api.RoutePolls)
+	app.Put("/polls/:id", pollHandler.UpdatePoll)
+	app.Delete("/polls/:id", pollHandler.DeletePoll)
+	app.Get("/polls/:id/options", pollHandler.GetPollOptions).Name(api.RoutePollOptions)
+	app.Post("/polls/:id/options", pollHandler.AddPollOption)
+	app.Get("/polls/:id/options/:optionid", pollHandler.GetPollOption).Name(api.RoutePollOption)
+	app.Delete("/polls/:id/options/:optionid", pollHandler.DeletePollOption)
+	app.Get("/polls/:id/results", voteHandler.GetPollResults).Name(api.RoutePollResults)
+
+	app.Post("/votes", voteHandler.CastVote)
+	app.Delete("/votes", voteHandler.DeleteAllVotes)
+	app.Get("/votes/:id", voteHandler.GetVote).Name(api.RouteVote)
+	app.Get("/votes", voteHandler.GetAllVotes).Name(api.RouteVotes)
 }
 
+// deleteAllVoters drops the votes too, a vote left behind could match the
+// random voteId of vote history a test records by hand
 func deleteAllVoters() {
+	deleteAllVotes()
+
 	req, err := http.NewRequest("DELETE", "/voters", nil)
 	if err != nil {
 		fmt.Printf("failed to create HTTP request to delete all voters: %v", err)
@@ -51,6 +86,44 @@ func deleteAllVoters() {
 	}
 }
 
+func deleteAllPolls() {
+	req, err := http.NewRequest("DELETE", "/polls", nil)
+	if err != nil {
+		fmt.Printf("failed to create HTTP request to delete all polls: %v", err)
+		return
+	}
+
+	// Serve the request
+	_, err = app.Test(req)
+	if err != nil {
+		fmt.Printf("failed to delete all polls: %v", err)
+	}
+}
+
+// addPolls creates a poll for every pollId so vote history can reference it
+func addPolls(t *testing.T, pollIds ...uint) {
+	for _, pollId := range pollIds {
+		pollJSON, err := json.Marshal(testutils.NewRandPoll(pollId, 1, 2))
+		if err != nil {
+			t.Fatalf("Failed to marshal poll to JSON: %v", err)
+		}
+
+		req, err := http.NewRequest("POST", "/polls", bytes.NewBuffer(pollJSON))
+		if err != nil {
+			t.Fatalf("Failed to create HTTP request: %v", err)
+		}
+		req.Header.Add("Content-Type", "application/json")
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to serve request: %v", err)
+		}
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Failed to add poll %d: %d", pollId, resp.StatusCode)
+		}
+	}
+}
+
 // testing voter handler New function
 func TestNew(t *testing.T) {
 	voterHandler, err := api.New()
@@ -62,6 +135,19 @@ func TestNew(t *testing.T) {
 	}
 }
 
+// testing voter handler NewWithStore function
+func TestNewWithStore(t *testing.T) {
+	voterList, _ := db.New()
+	voterHandler, err := api.NewWithStore(voterList)
+	assert.Nil(t, err)
+	assert.NotNil(t, voterHandler)
+
+	// the store is required
+	voterHandler, err = api.NewWithStore(nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, voterHandler)
+}
+
 // testing voter handler AddVoter - Invalid body
 func TestAddVoterBadRequest(t *testing.T) {
 	// clean up existing voters
@@ -128,7 +214,7 @@ func TestAddVoterVoterExists(t *testing.T) {
 		t.Fatalf("failed to serve request: %v", err)
 	}
 
-	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
 }
 
 // testing voter handler AddVoter - Success case
@@ -176,7 +262,7 @@ func TestAddVoterSuccessful(t *testing.T) {
 	}
 
 	// Check the response body
-	assert.Equal(t, voter, responseVoter)
+	assert.Equal(t, testutils.AsAdded(voter), responseVoter)
 }
 
 // testing voter handler GetVoter -  Success case
@@ -236,7 +322,7 @@ func TestGetVoter(t *testing.T) {
 	}
 
 	// Check the response body
-	assert.Equal(t, voter, responseVoter)
+	assert.Equal(t, testutils.AsAdded(voter), responseVoter)
 }
 
 // testing voter handler GetAllVoters - Success case
@@ -316,8 +402,8 @@ func TestGetAllVoter(t *testing.T) {
 	}
 
 	// Check the response body
-	assert.Contains(t, voters, voter1)
-	assert.Contains(t, voters, voter2)
+	assert.Contains(t, voters, testutils.AsAdded(voter1))
+	assert.Contains(t, voters, testutils.AsAdded(voter2))
 }
 
 // testing voter handler UpdateVoter - Success case
@@ -402,6 +488,8 @@ func TestUpdateVoter(t *testing.T) {
 	}
 
 	// Check the response body
+	// added and updated once
+	updateVoter.Revision = 2
 	assert.Equal(t, updateVoter, responseVoter)
 }
 
@@ -672,7 +760,6 @@ func TestGetVoterPolls(t *testing.T) {
 	// Create a new Voter
 	voter := testutils.NewRandVoter(1)
 	poll := testutils.NewRandPollVoteRecord(1)
-	voter.VoteHistory = append(voter.VoteHistory, poll)
 
 	// Marshal the Voter to JSON
 	voterJSON, err := json.Marshal(voter)
@@ -694,6 +781,9 @@ func TestGetVoterPolls(t *testing.T) {
 		t.Fatalf("Failed to serve request: %v", err)
 	}
 
+	// Record the poll in the vote history
+	addVoterPolls(t, voter.VoterId, poll)
+
 	// Create a new HTTP request
 	req, err = http.NewRequest("GET", fmt.Sprintf("/voters/%d/polls", voter.VoterId), nil)
 	if err != nil {
@@ -749,8 +839,10 @@ func TestGetVoterPollsNotExists(t *testing.T) {
 
 // testing voter handler AddVoterPoll - Success case
 func TestAddVoterPoll(t *testing.T) {
-	// clean up existing voters
+	// clean up existing voters and polls
 	deleteAllVoters()
+	deleteAllPolls()
+	addPolls(t, 1)
 
 	// Create a new Voter
 	voter := testutils.NewRandVoter(1)
@@ -884,13 +976,14 @@ func TestAddVoterPollBadRequest(t *testing.T) {
 
 // testing voter handler AddVoterPoll - Poll already exists
 func TestAddVoterPollExists(t *testing.T) {
-	// clean up existing voters
+	// clean up existing voters and polls
 	deleteAllVoters()
+	deleteAllPolls()
+	addPolls(t, 1)
 
 	// Create a new Voter
 	voter := testutils.NewRandVoter(1)
 	poll := testutils.NewRandPollVoteRecord(1)
-	voter.VoteHistory = append(voter.VoteHistory, poll)
 
 	// Marshal the Voter to JSON
 	voterJSON, err := json.Marshal(voter)
@@ -912,6 +1005,9 @@ func TestAddVoterPollExists(t *testing.T) {
 		t.Fatalf("Failed to serve request: %v", err)
 	}
 
+	// Record the poll in the vote history
+	addVoterPolls(t, voter.VoterId, poll)
+
 	// Marshal the Poll to JSON
 	pollJSON, err := json.Marshal(poll)
 	if err != nil {
@@ -933,7 +1029,7 @@ func TestAddVoterPollExists(t *testing.T) {
 	}
 
 	// Check the status code
-	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
 }
 
 func TestGetVoterPoll(t *testing.T) {
@@ -943,7 +1039,6 @@ func TestGetVoterPoll(t *testing.T) {
 	// Create a new Voter
 	voter := testutils.NewRandVoter(1)
 	poll := testutils.NewRandPollVoteRecord(1)
-	voter.VoteHistory = append(voter.VoteHistory, poll)
 
 	// Marshal the Voter to JSON
 	voterJSON, err := json.Marshal(voter)
@@ -965,6 +1060,9 @@ func TestGetVoterPoll(t *testing.T) {
 		t.Fatalf("Failed to serve request: %v", err)
 	}
 
+	// Record the poll in the vote history
+	addVoterPolls(t, voter.VoterId, poll)
+
 	// Create a new HTTP request - Get voter poll and verify
 	req, err = http.NewRequest("GET", fmt.Sprintf("/voters/%d/polls/%d", voter.VoterId, poll.PollId), nil)
 	if err != nil {
@@ -1005,7 +1103,6 @@ func TestUpdateVoterPoll(t *testing.T) {
 	// Create a new Voter
 	voter := testutils.NewRandVoter(1)
 	poll := testutils.NewRandPollVoteRecord(1)
-	voter.VoteHistory = append(voter.VoteHistory, poll)
 
 	// Marshal the Voter to JSON
 	voterJSON, err := json.Marshal(voter)
@@ -1027,6 +1124,9 @@ func TestUpdateVoterPoll(t *testing.T) {
 		t.Fatalf("Failed to serve request: %v", err)
 	}
 
+	// Record the poll in the vote history
+	addVoterPolls(t, voter.VoterId, poll)
+
 	updatePoll := testutils.NewRandPollVoteRecord(1)
 
 	// Marshal the Poll to JSON
@@ -1092,7 +1192,6 @@ func TestUpdateVoterPollBadRequest(t *testing.T) {
 	// Create a new Voter
 	voter := testutils.NewRandVoter(1)
 	poll := testutils.NewRandPollVoteRecord(1)
-	voter.VoteHistory = append(voter.VoteHistory, poll)
 
 	// Marshal the Voter to JSON
 	voterJSON, err := json.Marshal(voter)
@@ -1114,6 +1213,9 @@ func TestUpdateVoterPollBadRequest(t *testing.T) {
 		t.Fatalf("Failed to serve request: %v", err)
 	}
 
+	// Record the poll in the vote history
+	addVoterPolls(t, voter.VoterId, poll)
+
 	updatePoll := testutils.NewRandPollVoteRecord(1)
 
 	// Marshal the Poll to JSON
@@ -1200,7 +1302,6 @@ func TestDeleteVoterPoll(t *testing.T) {
 	// Create a new Voter
 	voter := testutils.NewRandVoter(1)
 	poll := testutils.NewRandPollVoteRecord(1)
-	voter.VoteHistory = append(voter.VoteHistory, poll)
 
 	// Marshal the Voter to JSON
 	voterJSON, err := json.Marshal(voter)
@@ -1222,6 +1323,9 @@ func TestDeleteVoterPoll(t *testing.T) {
 		t.Fatalf("Failed to serve request: %v", err)
 	}
 
+	// Record the poll in the vote history
+	addVoterPolls(t, voter.VoterId, poll)
+
 	// Create a new HTTP request
 	req, err = http.NewRequest("DELETE", fmt.Sprintf("/voters/%d/polls/%d", voter.VoterId, poll.PollId), nil)
 	if err != nil {
@@ -1359,3 +1463,191 @@ func TestDeleteVoterPollNotExists(t *testing.T) {
 // 	assert.Contains(t, voters, voter1)
 // 	assert.Contains(t, voters, voter2)
 // }
+
+// testing voter handler GetAllVoters - paging, sorting and filtering
+func TestGetAllVotersQuery(t *testing.T) {
+	// clean up existing voters
+	deleteAllVoters()
+
+	// Create voters 1..5, odd voters took part in poll 101
+	for voterId := uint(1); voterId <= 5; voterId++ {
+		voter := testutils.NewRandVoter(voterId)
+		voter.Name = fmt.Sprintf("Voter %d", 6-voterId)
+
+		voterJSON, err := json.Marshal(voter)
+		if err != nil {
+			t.Fatalf("Failed to marshal voter to JSON: %v", err)
+		}
+
+		req, err := http.NewRequest("POST", "/voters", bytes.NewBuffer(voterJSON))
+		if err != nil {
+			t.Fatalf("Failed to create HTTP request: %v", err)
+		}
+		req.Header.Add("Content-Type", "application/json")
+
+		_, err = app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to serve request: %v", err)
+		}
+		if voterId%2 == 1 {
+			addVoterPolls(t, voterId, testutils.NewRandPollVoteRecord(101))
+		}
+	}
+
+	// getVoterIds serves url and returns the voterIds in the response
+	getVoterIds := func(url string) (*http.Response, []uint) {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatalf("Failed to create HTTP request: %v", err)
+		}
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to serve request: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return resp, nil
+		}
+
+		var voters []db.Voter
+		if err := json.NewDecoder(resp.Body).Decode(&voters); err != nil {
+			t.Fatalf("Failed to unmarshal response body: %v", err)
+		}
+
+		voterIds := []uint{}
+		for _, voter := range voters {
+			voterIds = append(voterIds, voter.VoterId)
+		}
+		return resp, voterIds
+	}
+
+	// First page links to the next page only
+	resp, voterIds := getVoterIds("/voters?limit=2")
+	assert.Equal(t, []uint{1, 2}, voterIds)
+	assert.Equal(t, "5", resp.Header.Get("X-Total-Count"))
+	assert.Empty(t, resp.Header.Get("X-Prev-Cursor"))
+	assert.Contains(t, resp.Header.Get("Link"), `rel="next"`)
+
+	// Following the next cursor
+	resp, voterIds = getVoterIds("/voters?limit=2&cursor=" + resp.Header.Get("X-Next-Cursor"))
+	assert.Equal(t, []uint{3, 4}, voterIds)
+	assert.NotEmpty(t, resp.Header.Get("X-Prev-Cursor"))
+
+	// Last page links back only
+	resp, voterIds = getVoterIds("/voters?limit=2&offset=4")
+	assert.Equal(t, []uint{5}, voterIds)
+	assert.Empty(t, resp.Header.Get("X-Next-Cursor"))
+	assert.Contains(t, resp.Header.Get("Link"), `rel="prev"`)
+
+	// Sorting
+	_, voterIds = getVoterIds("/voters?sort=name")
+	assert.Equal(t, []uint{5, 4, 3, 2, 1}, voterIds)
+	_, voterIds = getVoterIds("/voters?sort=-voterId&limit=1")
+	assert.Equal(t, []uint{5}, voterIds)
+
+	// Filtering
+	resp, voterIds = getVoterIds("/voters?votedInPoll=101&sort=-voterId")
+	assert.Equal(t, []uint{5, 3, 1}, voterIds)
+	assert.Equal(t, "3", resp.Header.Get("X-Total-Count"))
+	_, voterIds = getVoterIds("/voters?name~=voter%202")
+	assert.Equal(t, []uint{4}, voterIds)
+
+	// Asking for more than the largest page gets the largest page
+	resp, voterIds = getVoterIds("/voters?limit=5000")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []uint{1, 2, 3, 4, 5}, voterIds)
+
+	// Invalid queries
+	for _, url := range []string{"/voters?limit=abc", "/voters?limit=0", "/voters?limit=-1", "/voters?sort=age", "/voters?cursor=%%%", "/voters?offset=1&cursor=MQ", "/voters?votedInPoll=-1"} {
+		resp, _ = getVoterIds(url)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, url)
+	}
+}
+
+// testing voter handler GetAllVoters - Pages without a limit
+func TestGetAllVotersDefaultLimit(t *testing.T) {
+	// clean up existing voters
+	deleteAllVoters()
+
+	voterIds := make([]uint, db.DefaultVoterQueryLimit+1)
+	for i := range voterIds {
+		voterIds[i] = uint(i + 1)
+	}
+	addVoters(t, voterIds...)
+
+	req, err := http.NewRequest("GET", "/voters", nil)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	var voters []db.Voter
+	if err := json.NewDecoder(resp.Body).Decode(&voters); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	assert.Len(t, voters, db.DefaultVoterQueryLimit)
+	assert.Equal(t, strconv.Itoa(db.DefaultVoterQueryLimit+1), resp.Header.Get("X-Total-Count"))
+	assert.NotEmpty(t, resp.Header.Get("X-Next-Cursor"))
+}
+
+// testing voter handler AddVoterPoll - Poll is not a known poll
+func TestAddVoterPollUnknownPoll(t *testing.T) {
+	// clean up existing voters and polls
+	deleteAllVoters()
+	deleteAllPolls()
+
+	// Create a new Voter
+	voter := testutils.NewRandVoter(1)
+	poll := testutils.NewRandPollVoteRecord(1)
+
+	// Marshal the Voter to JSON
+	voterJSON, err := json.Marshal(voter)
+	if err != nil {
+		t.Fatalf("Failed to marshal voter to JSON: %v", err)
+	}
+
+	// Create a new HTTP request
+	req, err := http.NewRequest("POST", "/voters", bytes.NewBuffer(voterJSON))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	// Serve the request - Add voter
+	_, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	// Marshal the Poll to JSON
+	pollJSON, err := json.Marshal(poll)
+	if err != nil {
+		t.Fatalf("Failed to marshal poll to JSON: %v", err)
+	}
+
+	// Create a new HTTP request
+	req, err = http.NewRequest("POST", fmt.Sprintf("/voters/%d/polls", voter.VoterId), bytes.NewBuffer(pollJSON))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	// Serve the request - Add voter poll for a poll that was never created
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	// Check the status code
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	// Check nothing was added
+	voterPolls, err := voterList.GetVoterPolls(ctx, voter.VoterId)
+	assert.Nil(t, err)
+	assert.Empty(t, voterPolls)
+}
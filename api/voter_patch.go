@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/abhi2687/voter-api/db"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// Media types PATCH /voters/:id accepts, the Content-Type of the request
+// says which kind of patch the body is
+const (
+	MergePatchMediaType = "application/merge-patch+json"
+	JSONPatchMediaType  = "application/json-patch+json"
+)
+
+var (
+	errUnsupportedPatch = errors.New("patch must be sent as " + MergePatchMediaType + " or " + JSONPatchMediaType)
+	// errPatchFailed is a well formed patch that can not be applied to the
+	// voter, a test operation that fails or a path that does not exist
+	errPatchFailed = errors.New("patch could not be applied")
+)
+
+// newVoterPatch reads a JSON Merge Patch (RFC 7396) or a JSON Patch
+// (RFC 6902) into a db.VoterPatch, the patch is applied to the JSON the
+// voter is served as
+func newVoterPatch(contentType string, body []byte) (db.VoterPatch, error) {
+	var applyPatch func(document []byte) ([]byte, error)
+
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case MergePatchMediaType:
+		if !json.Valid(body) {
+			return nil, errors.New("merge patch is not valid JSON")
+		}
+		applyPatch = func(document []byte) ([]byte, error) {
+			return jsonpatch.MergePatch(document, body)
+		}
+	case JSONPatchMediaType:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return nil, err
+		}
+		applyPatch = patch.Apply
+	default:
+		return nil, errUnsupportedPatch
+	}
+
+	return func(voter db.Voter) (db.Voter, error) {
+		document, err := json.Marshal(voter)
+		if err != nil {
+			return db.Voter{}, err
+		}
+
+		patched, err := applyPatch(document)
+		if err != nil {
+			return db.Voter{}, fmt.Errorf("%w: %v", errPatchFailed, err)
+		}
+
+		var patchedVoter db.Voter
+		if err := json.Unmarshal(patched, &patchedVoter); err != nil {
+			return db.Voter{}, fmt.Errorf("%w: %v", errPatchFailed, err)
+		}
+		return patchedVoter, nil
+	}, nil
+}
@@ -0,0 +1,162 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/abhi2687/voter-api/api"
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// patchVoter sends body as a PATCH of the voter with contentType
+func patchVoter(t *testing.T, voterId uint, contentType string, body string) *http.Response {
+	req, err := http.NewRequest("PATCH", fmt.Sprintf("/voters/%d", voterId), bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP request: %v", err)
+	}
+	req.Header.Add("Content-Type", contentType)
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+	return resp
+}
+
+// testing PUT replaces name and email and keeps the vote history
+func TestUpdateVoterKeepsHistory(t *testing.T) {
+	// clean up existing voters
+	deleteAllVoters()
+
+	addVoters(t, 1)
+	poll1 := testutils.NewRandPollVoteRecord(1)
+	addVoterPolls(t, 1, poll1)
+
+	// the body of a GET can be sent back with its history and without an id
+	update := testutils.NewRandVoter(0)
+	update.VoteHistory = []db.VoterHistory{testutils.NewRandPollVoteRecord(2)}
+	updateJSON, _ := json.Marshal(update)
+
+	req, _ := http.NewRequest("PUT", "/voters/1", bytes.NewBuffer(updateJSON))
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	voter, err := voterList.GetVoter(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, db.Voter{VoterId: 1, Name: update.Name, Email: update.Email, VoteHistory: []db.VoterHistory{poll1}, Revision: 3}, voter)
+
+	// leaving a mutable field out replaces it too
+	resp, problem := doProblem(t, "PUT", "/voters/1", fiber.Map{"name": "Jo"})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "validation-failed", problem.Code)
+
+	// and a body for another voter is refused
+	resp, problem = doProblem(t, "PUT", "/voters/1", testutils.NewRandVoter(2))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "voter-id-mismatch", problem.Code)
+}
+
+// testing PATCH with a JSON Merge Patch
+func TestPatchVoterMergePatch(t *testing.T) {
+	// clean up existing voters
+	deleteAllVoters()
+
+	voter1 := testutils.NewRandVoter(1)
+	if err := voterList.AddVoter(ctx, voter1); err != nil {
+		t.Fatalf("Failed to add voter: %v", err)
+	}
+
+	resp := patchVoter(t, 1, api.MergePatchMediaType, `{"name": "Jo Patched"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var voter db.Voter
+	if err := json.NewDecoder(resp.Body).Decode(&voter); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	assert.Equal(t, db.Voter{VoterId: 1, Name: "Jo Patched", Email: voter1.Email, Revision: 2}, voter)
+
+	stored, _ := voterList.GetVoter(ctx, 1)
+	assert.Equal(t, voter, stored)
+}
+
+// testing PATCH with a JSON Patch
+func TestPatchVoterJSONPatch(t *testing.T) {
+	// clean up existing voters
+	deleteAllVoters()
+
+	voter1 := testutils.NewRandVoter(1)
+	if err := voterList.AddVoter(ctx, voter1); err != nil {
+		t.Fatalf("Failed to add voter: %v", err)
+	}
+
+	patch := fmt.Sprintf(`[
+		{"op": "test", "path": "/email", "value": %q},
+		{"op": "replace", "path": "/email", "value": "jo@example.com"}
+	]`, voter1.Email)
+	resp := patchVoter(t, 1, api.JSONPatchMediaType+"; charset=utf-8", patch)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	stored, _ := voterList.GetVoter(ctx, 1)
+	assert.Equal(t, db.Voter{VoterId: 1, Name: voter1.Name, Email: "jo@example.com", Revision: 2}, stored)
+}
+
+// testing PATCH failures are answered as problems
+func TestPatchVoterProblems(t *testing.T) {
+	// clean up existing voters
+	deleteAllVoters()
+
+	voter1 := testutils.NewRandVoter(1)
+	if err := voterList.AddVoter(ctx, voter1); err != nil {
+		t.Fatalf("Failed to add voter: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		voterId     uint
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{"UnsupportedMediaType", 1, "application/json", `{"name": "Jo"}`, http.StatusUnsupportedMediaType, "unsupported-media-type"},
+		{"MalformedMergePatch", 1, api.MergePatchMediaType, `{"name":`, http.StatusBadRequest, "bad-request"},
+		{"MalformedJSONPatch", 1, api.JSONPatchMediaType, `{"op": "replace"}`, http.StatusBadRequest, "bad-request"},
+		{"FailedTest", 1, api.JSONPatchMediaType, `[{"op": "test", "path": "/name", "value": "Nobody"}]`, http.StatusUnprocessableEntity, "patch-failed"},
+		{"MissingPath", 1, api.JSONPatchMediaType, `[{"op": "replace", "path": "/nothing/here", "value": 1}]`, http.StatusUnprocessableEntity, "patch-failed"},
+		{"WrongType", 1, api.MergePatchMediaType, `{"name": 5}`, http.StatusUnprocessableEntity, "patch-failed"},
+		{"Invalid", 1, api.MergePatchMediaType, `{"email": "not-an-email"}`, http.StatusUnprocessableEntity, "validation-failed"},
+		{"VoterIdMismatch", 1, api.MergePatchMediaType, `{"voterId": 2}`, http.StatusBadRequest, "voter-id-mismatch"},
+		{"VoterNotFound", 9, api.MergePatchMediaType, `{"name": "Jo"}`, http.StatusNotFound, "voter-not-found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := patchVoter(t, tt.voterId, tt.contentType, tt.body)
+			assert.Equal(t, tt.status, resp.StatusCode)
+
+			var problem api.Problem
+			if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+				t.Fatalf("Failed to unmarshal response body: %v", err)
+			}
+			assert.Equal(t, tt.code, problem.Code)
+
+			if tt.status == http.StatusUnsupportedMediaType {
+				assert.Equal(t, api.MergePatchMediaType+", "+api.JSONPatchMediaType, resp.Header.Get("Accept-Patch"))
+			}
+		})
+	}
+
+	// none of them changed the voter
+	voter, _ := voterList.GetVoter(ctx, 1)
+	assert.Equal(t, testutils.AsAdded(voter1), voter)
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// encodeCursor turns a page offset into the opaque cursor handed to clients
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+
+	return offset, nil
+}
+
+// parseVoterQuery reads limit, offset or cursor, sort and the name~, email
+// and votedInPoll filters from the query string. Pages are always limited,
+// to DefaultVoterQueryLimit voters when limit is left out and to
+// MaxVoterQueryLimit when it asks for more.
+func parseVoterQuery(c *fiber.Ctx) (db.VoterQuery, error) {
+	query := db.VoterQuery{Limit: db.DefaultVoterQueryLimit}
+	var err error
+
+	if limit := c.Query("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil {
+			return db.VoterQuery{}, errors.New("limit must be a number")
+		}
+		if query.Limit < 1 {
+			return db.VoterQuery{}, errors.New("limit must be at least 1")
+		}
+		if query.Limit > db.MaxVoterQueryLimit {
+			query.Limit = db.MaxVoterQueryLimit
+		}
+	}
+
+	offset, cursor := c.Query("offset"), c.Query("cursor")
+	if offset != "" && cursor != "" {
+		return db.VoterQuery{}, errors.New("use either offset or cursor")
+	}
+	if offset != "" {
+		if query.Offset, err = strconv.Atoi(offset); err != nil {
+			return db.VoterQuery{}, errors.New("offset must be a number")
+		}
+	}
+	if cursor != "" {
+		if query.Offset, err = decodeCursor(cursor); err != nil {
+			return db.VoterQuery{}, err
+		}
+	}
+
+	// sort=-name sorts descending
+	sortBy := c.Query("sort")
+	query.Descending = strings.HasPrefix(sortBy, "-")
+	query.SortBy = strings.TrimPrefix(sortBy, "-")
+
+	query.NameContains = c.Query("name~")
+	query.Email = c.Query("email")
+
+	if pollId := c.Query("votedInPoll"); pollId != "" {
+		votedInPoll, err := strconv.ParseUint(pollId, 10, 32)
+		if err != nil {
+			return db.VoterQuery{}, errors.New("votedInPoll must be a poll id")
+		}
+		query.VotedInPoll = uint(votedInPoll)
+	}
+
+	return query, query.Validate()
+}
+
+// pageCursors returns the cursors of the pages around page, empty when there
+// is no such page. The page has a limit, parseVoterQuery always sets one.
+func pageCursors(page db.VoterPage) (next string, prev string) {
+	if offset := page.Offset + page.Limit; offset < page.Total {
+		next = encodeCursor(offset)
+	}
+	if page.Offset > 0 {
+		offset := page.Offset - page.Limit
+		if offset < 0 {
+			offset = 0
+		}
+		prev = encodeCursor(offset)
+	}
+
+	return next, prev
+}
+
+// setPageHeaders reports the total count and the cursors of the neighbouring
+// pages as headers, so the body stays a plain array of voters
+func setPageHeaders(c *fiber.Ctx, page db.VoterPage) {
+	c.Set("X-Total-Count", strconv.Itoa(page.Total))
+
+	var links []string
+	next, prev := pageCursors(page)
+	if next != "" {
+		c.Set("X-Next-Cursor", next)
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(c, next)))
+	}
+	if prev != "" {
+		c.Set("X-Prev-Cursor", prev)
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(c, prev)))
+	}
+	if len(links) > 0 {
+		c.Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// pageURL is the current request URL pointing at another cursor
+func pageURL(c *fiber.Ctx, cursor string) string {
+	args := fasthttp.AcquireArgs()
+	defer fasthttp.ReleaseArgs(args)
+
+	c.Context().QueryArgs().CopyTo(args)
+	args.Del("offset")
+	args.Set("cursor", cursor)
+
+	return c.Path() + "?" + args.String()
+}
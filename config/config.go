@@ -0,0 +1,423 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Store backends
+const (
+	BackendMemory  = "memory"
+	BackendJournal = "journal"
+	BackendSQLite  = "sqlite"
+	BackendRedis   = "redis"
+)
+
+// Journal fsync policies, the values db.ParseFsyncPolicy reads
+const (
+	FsyncAlways   = "always"
+	FsyncInterval = "interval"
+	FsyncNever    = "never"
+)
+
+// Log formats, the values logging.Options takes
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// Timeouts that are not set, the request and ready ones match the defaults
+// of api and health
+const (
+	DefaultRequestTimeout  = 5 * time.Second
+	DefaultReadyTimeout    = time.Second
+	DefaultShutdownTimeout = 10 * time.Second
+)
+
+// EnvPrefix starts the name of every environment variable read, the config
+// file is named by VOTER_API_CONFIG
+const EnvPrefix = "VOTER_API_"
+
+// Redacted replaces secrets when a config is printed
+const Redacted = "REDACTED"
+
+// Config is everything the server can be configured with. It is loaded from
+// a YAML file, environment variables and flags, each overriding the one
+// before.
+type Config struct {
+	Host     string        `yaml:"host"`
+	Port     uint          `yaml:"port"`
+	Store    StoreConfig   `yaml:"store"`
+	Redis    RedisConfig   `yaml:"redis"`
+	Cache    CacheConfig   `yaml:"cache"`
+	Timeouts TimeoutConfig `yaml:"timeouts"`
+	CORS     CORSConfig    `yaml:"cors"`
+	Log      LogConfig     `yaml:"log"`
+	Features FeatureConfig `yaml:"features"`
+}
+
+// StoreConfig picks where voters, polls and votes are kept. An empty Backend
+// is resolved by Load: redis when an address is set, then sqlite when a
+// database is named, then journal when a data directory is, otherwise memory.
+type StoreConfig struct {
+	Backend string `yaml:"backend"`
+	SQLite  string `yaml:"sqlite"`
+	DataDir string `yaml:"dataDir"`
+	Fsync   string `yaml:"fsync"`
+}
+
+// RedisConfig is how the redis stores connect, a PoolSize of 0 leaves the
+// go-redis default of 10 connections per CPU
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	TLS      bool   `yaml:"tls"`
+	PoolSize int    `yaml:"poolSize"`
+	// DegradedRefresh is how often redis is snapshotted for reads while it
+	// is down, 0 turns degraded mode off
+	DegradedRefresh time.Duration `yaml:"degradedRefresh"`
+}
+
+// CacheConfig sizes the VoterLRU, a Size of 0 turns it off
+type CacheConfig struct {
+	Size int           `yaml:"size"`
+	TTL  time.Duration `yaml:"ttl"`
+}
+
+type TimeoutConfig struct {
+	Request    time.Duration `yaml:"request"`
+	Ready      time.Duration `yaml:"ready"`
+	DrainDelay time.Duration `yaml:"drainDelay"`
+	Shutdown   time.Duration `yaml:"shutdown"`
+}
+
+// CORSConfig lists the origins browsers may call the api from, * allows all
+type CORSConfig struct {
+	Origins []string `yaml:"origins"`
+}
+
+// LogConfig.Level is one of debug, info, warn or error and Format json or
+// text. Redact replaces the names and emails of voters in log lines.
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+	Redact bool   `yaml:"redact"`
+}
+
+type FeatureConfig struct {
+	// Metrics serves GET /metrics
+	Metrics bool `yaml:"metrics"`
+	// WatchVoterChanges drops voters other replicas changed from the
+	// VoterLRU through redis keyspace notifications
+	WatchVoterChanges bool `yaml:"watchVoterChanges"`
+}
+
+// Default is the config used for whatever is not set
+func Default() Config {
+	return Config{
+		Host:     "0.0.0.0",
+		Port:     1080,
+		Store:    StoreConfig{Fsync: FsyncAlways},
+		Cache:    CacheConfig{TTL: 30 * time.Second},
+		Timeouts: TimeoutConfig{Request: DefaultRequestTimeout, Ready: DefaultReadyTimeout, Shutdown: DefaultShutdownTimeout},
+		CORS:     CORSConfig{Origins: []string{"*"}},
+		Log:      LogConfig{Level: "info", Format: LogFormatJSON, Redact: true},
+		Features: FeatureConfig{Metrics: true, WatchVoterChanges: true},
+	}
+}
+
+// bind registers a flag for every setting, each pointing into c
+func bind(flags *flag.FlagSet, c *Config) {
+	flags.StringVar(&c.Host, "h", c.Host, "Address to listen on")
+	flags.UintVar(&c.Port, "p", c.Port, "Port to listen on")
+	flags.StringVar(&c.Store.Backend, "store", c.Store.Backend, "Store backend: memory, journal, sqlite or redis, picked from the other settings when empty")
+	flags.StringVar(&c.Store.SQLite, "sqlite", c.Store.SQLite, "SQLite database file, created and migrated when needed")
+	flags.StringVar(&c.Store.DataDir, "data-dir", c.Store.DataDir, "Directory the in-memory store is journaled to, nothing is kept when empty")
+	flags.StringVar(&c.Store.Fsync, "fsync", c.Store.Fsync, "When the journal is flushed to disk: always, interval or never")
+	flags.StringVar(&c.Redis.Addr, "r", c.Redis.Addr, "Redis address, in-memory store is used when empty")
+	flags.StringVar(&c.Redis.Password, "redis-password", c.Redis.Password, "Redis password")
+	flags.IntVar(&c.Redis.DB, "redis-db", c.Redis.DB, "Redis database number")
+	flags.BoolVar(&c.Redis.TLS, "redis-tls", c.Redis.TLS, "Connect to redis over TLS")
+	flags.IntVar(&c.Redis.PoolSize, "redis-pool-size", c.Redis.PoolSize, "Redis connections to keep, 0 uses 10 per CPU")
+	flags.DurationVar(&c.Redis.DegradedRefresh, "degraded-refresh", c.Redis.DegradedRefresh, "How often redis is snapshotted to answer reads from while it is down, 0 turns degraded mode off")
+	flags.IntVar(&c.Cache.Size, "cache-size", c.Cache.Size, "How many voters to cache in memory, 0 turns the cache off")
+	flags.DurationVar(&c.Cache.TTL, "cache-ttl", c.Cache.TTL, "How long a cached voter is served, 0 keeps it until it changes")
+	flags.DurationVar(&c.Timeouts.Request, "request-timeout", c.Timeouts.Request, "How long a request may wait on the store before it is answered with 504, 0 waits as long as it takes")
+	flags.DurationVar(&c.Timeouts.Ready, "ready-timeout", c.Timeouts.Ready, "How long GET /readyz waits on the store before it is reported down")
+	flags.DurationVar(&c.Timeouts.DrainDelay, "drain-delay", c.Timeouts.DrainDelay, "How long GET /readyz answers 503 on SIGINT or SIGTERM before the server stops taking connections")
+	flags.DurationVar(&c.Timeouts.Shutdown, "shutdown-timeout", c.Timeouts.Shutdown, "How long requests in flight are given to finish on SIGINT or SIGTERM before they are abandoned")
+	flags.Var((*listValue)(&c.CORS.Origins), "cors-origins", "Comma separated origins browsers may call the api from, * allows all")
+	flags.StringVar(&c.Log.Level, "log-level", c.Log.Level, "Least severe log level written: debug, info, warn or error")
+	flags.StringVar(&c.Log.Format, "log-format", c.Log.Format, "Format of log lines: json or text")
+	flags.BoolVar(&c.Log.Redact, "log-redact", c.Log.Redact, "Replace the names and emails of voters in log lines")
+	flags.BoolVar(&c.Features.Metrics, "metrics", c.Features.Metrics, "Serve Prometheus metrics on GET /metrics")
+	flags.BoolVar(&c.Features.WatchVoterChanges, "watch-voter-changes", c.Features.WatchVoterChanges, "Drop cached voters other replicas changed, needs redis keyspace notifications")
+}
+
+// envs names the environment variable of every flag, REDIS_URL is still read
+// for the redis address but VOTER_API_REDIS_ADDR wins
+var envs = []struct {
+	env  string
+	flag string
+}{
+	{EnvPrefix + "HOST", "h"},
+	{EnvPrefix + "PORT", "p"},
+	{EnvPrefix + "STORE_BACKEND", "store"},
+	{EnvPrefix + "STORE_SQLITE", "sqlite"},
+	{EnvPrefix + "STORE_DATA_DIR", "data-dir"},
+	{EnvPrefix + "STORE_FSYNC", "fsync"},
+	{"REDIS_URL", "r"},
+	{EnvPrefix + "REDIS_ADDR", "r"},
+	{EnvPrefix + "REDIS_PASSWORD", "redis-password"},
+	{EnvPrefix + "REDIS_DB", "redis-db"},
+	{EnvPrefix + "REDIS_TLS", "redis-tls"},
+	{EnvPrefix + "REDIS_POOL_SIZE", "redis-pool-size"},
+	{EnvPrefix + "REDIS_DEGRADED_REFRESH", "degraded-refresh"},
+	{EnvPrefix + "CACHE_SIZE", "cache-size"},
+	{EnvPrefix + "CACHE_TTL", "cache-ttl"},
+	{EnvPrefix + "TIMEOUTS_REQUEST", "request-timeout"},
+	{EnvPrefix + "TIMEOUTS_READY", "ready-timeout"},
+	{EnvPrefix + "TIMEOUTS_DRAIN_DELAY", "drain-delay"},
+	{EnvPrefix + "TIMEOUTS_SHUTDOWN", "shutdown-timeout"},
+	{EnvPrefix + "CORS_ORIGINS", "cors-origins"},
+	{EnvPrefix + "LOG_LEVEL", "log-level"},
+	{EnvPrefix + "LOG_FORMAT", "log-format"},
+	{EnvPrefix + "LOG_REDACT", "log-redact"},
+	{EnvPrefix + "FEATURES_METRICS", "metrics"},
+	{EnvPrefix + "FEATURES_WATCH_VOTER_CHANGES", "watch-voter-changes"},
+}
+
+// NewFlagSet returns the flags Load parses, for usage output
+func NewFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	c := Default()
+	bind(flags, &c)
+	flags.String("config", "", "YAML config file, settings in the environment and flags override it")
+	return flags
+}
+
+// Load reads the config file named by -config or VOTER_API_CONFIG, then the
+// environment through lookupEnv, then the flags set in args, and returns the
+// validated config with the arguments left after the flags. Every invalid
+// value is reported, not just the first.
+func Load(args []string, lookupEnv func(key string) (string, bool)) (Config, []string, error) {
+	flags := NewFlagSet("voter-api")
+	if err := flags.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	c := Default()
+	path := flags.Lookup("config").Value.String()
+	if path == "" {
+		path, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := c.readFile(path); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	// settings are applied through flags pointing into c so the
+	// environment and flags are parsed the same way
+	settings := flag.NewFlagSet("settings", flag.ContinueOnError)
+	bind(settings, &c)
+	var errs []error
+	for _, e := range envs {
+		if value, ok := lookupEnv(e.env); ok {
+			if err := settings.Set(e.flag, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", e.env, err))
+			}
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		if err := settings.Set(f.Name, f.Value.String()); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", f.Name, err))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, nil, err
+	}
+
+	c.resolveBackend()
+	if err := c.Validate(); err != nil {
+		return Config{}, nil, err
+	}
+	return c, flags.Args(), nil
+}
+
+// readFile decodes the YAML file at path over c, unknown keys are refused
+func (c *Config) readFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) resolveBackend() {
+	if c.Store.Backend != "" {
+		return
+	}
+
+	switch {
+	case c.Redis.Addr != "":
+		c.Store.Backend = BackendRedis
+	case c.Store.SQLite != "":
+		c.Store.Backend = BackendSQLite
+	case c.Store.DataDir != "":
+		c.Store.Backend = BackendJournal
+	default:
+		c.Store.Backend = BackendMemory
+	}
+}
+
+// Validate reports every setting that can not be used
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(setting string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", setting, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Port == 0 || c.Port > 65535 {
+		invalid("port", "%d is not between 1 and 65535", c.Port)
+	}
+
+	switch c.Store.Backend {
+	case BackendMemory:
+	case BackendJournal:
+		if c.Store.DataDir == "" {
+			invalid("store.dataDir", "is required by the journal backend")
+		}
+	case BackendSQLite:
+		if c.Store.SQLite == "" {
+			invalid("store.sqlite", "is required by the sqlite backend")
+		}
+	case BackendRedis:
+		if c.Redis.Addr == "" {
+			invalid("redis.addr", "is required by the redis backend")
+		}
+	default:
+		invalid("store.backend", "%q is not memory, journal, sqlite or redis", c.Store.Backend)
+	}
+	switch c.Store.Fsync {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		invalid("store.fsync", "%q is not always, interval or never", c.Store.Fsync)
+	}
+
+	if c.Redis.DB < 0 {
+		invalid("redis.db", "%d is negative", c.Redis.DB)
+	}
+	if c.Redis.PoolSize < 0 {
+		invalid("redis.poolSize", "%d is negative", c.Redis.PoolSize)
+	}
+	if c.Cache.Size < 0 {
+		invalid("cache.size", "%d is negative", c.Cache.Size)
+	}
+
+	for _, d := range []struct {
+		setting  string
+		duration time.Duration
+	}{
+		{"redis.degradedRefresh", c.Redis.DegradedRefresh},
+		{"cache.ttl", c.Cache.TTL},
+		{"timeouts.request", c.Timeouts.Request},
+		{"timeouts.ready", c.Timeouts.Ready},
+		{"timeouts.drainDelay", c.Timeouts.DrainDelay},
+		{"timeouts.shutdown", c.Timeouts.Shutdown},
+	} {
+		if d.duration < 0 {
+			invalid(d.setting, "%v is negative", d.duration)
+		}
+	}
+
+	if len(c.CORS.Origins) == 0 {
+		invalid("cors.origins", "is empty, use * to allow every origin")
+	}
+	for _, origin := range c.CORS.Origins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			invalid("cors.origins", "%q is not * or a scheme and host like https://example.com", origin)
+		}
+	}
+
+	if _, err := c.Log.SlogLevel(); err != nil {
+		invalid("log.level", "%q is not debug, info, warn or error", c.Log.Level)
+	}
+	if c.Log.Format != LogFormatJSON && c.Log.Format != LogFormatText {
+		invalid("log.format", "%q is not json or text", c.Log.Format)
+	}
+
+	return errors.Join(errs...)
+}
+
+// SlogLevel is the level as a slog.Level
+func (l LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(l.Level))
+	return level, err
+}
+
+// Redact returns c with its secrets replaced by Redacted
+func (c Config) Redact() Config {
+	if c.Redis.Password != "" {
+		c.Redis.Password = Redacted
+	}
+	return c
+}
+
+// YAML encodes c the way config files are written, secrets included
+func (c Config) YAML() ([]byte, error) {
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// listValue is a comma separated flag
+type listValue []string
+
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
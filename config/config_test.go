@@ -0,0 +1,230 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abhi2687/voter-api/api"
+	"github.com/abhi2687/voter-api/config"
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/health"
+	"github.com/abhi2687/voter-api/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// env returns a lookupEnv that only knows vars
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+// writeConfigFile writes content to a config file in a temporary directory
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "voter-api.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, args, err := config.Load([]string{"migrate", "-dry-run"}, env(nil))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"migrate", "-dry-run"}, args)
+
+	want := config.Default()
+	want.Store.Backend = config.BackendMemory
+	assert.Equal(t, want, cfg)
+}
+
+// config keeps its own copies of the defaults and names of the packages it
+// configures, they must not drift apart
+func TestDefaultsMatchPackages(t *testing.T) {
+	assert.Equal(t, api.DefaultRequestTimeout, config.DefaultRequestTimeout)
+	assert.Equal(t, health.DefaultTimeout, config.DefaultReadyTimeout)
+	assert.Equal(t, logging.FormatJSON, config.LogFormatJSON)
+	assert.Equal(t, logging.FormatText, config.LogFormatText)
+
+	for _, policy := range []string{config.FsyncAlways, config.FsyncInterval, config.FsyncNever} {
+		_, err := db.ParseFsyncPolicy(policy)
+		assert.Nil(t, err, policy)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+port: 2000
+store:
+  fsync: never
+redis:
+  addr: file:6379
+  poolSize: 20
+timeouts:
+  request: 2s
+cors:
+  origins: ["https://file.example.com"]
+`)
+
+	// the file overrides the defaults
+	cfg, _, err := config.Load([]string{"-config", path}, env(nil))
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2000), cfg.Port)
+	assert.Equal(t, "0.0.0.0", cfg.Host)
+	assert.Equal(t, "file:6379", cfg.Redis.Addr)
+	assert.Equal(t, 20, cfg.Redis.PoolSize)
+	assert.Equal(t, 2*time.Second, cfg.Timeouts.Request)
+	assert.Equal(t, []string{"https://file.example.com"}, cfg.CORS.Origins)
+	assert.Equal(t, config.BackendRedis, cfg.Store.Backend)
+
+	// the environment overrides the file, the file can be named there too
+	vars := map[string]string{
+		config.EnvPrefix + "CONFIG":           path,
+		config.EnvPrefix + "PORT":             "3000",
+		config.EnvPrefix + "REDIS_ADDR":       "env:6379",
+		config.EnvPrefix + "TIMEOUTS_REQUEST": "3s",
+		config.EnvPrefix + "CORS_ORIGINS":     "https://a.example.com, https://b.example.com",
+	}
+	cfg, _, err = config.Load(nil, env(vars))
+	assert.Nil(t, err)
+	assert.Equal(t, uint(3000), cfg.Port)
+	assert.Equal(t, "env:6379", cfg.Redis.Addr)
+	assert.Equal(t, 20, cfg.Redis.PoolSize)
+	assert.Equal(t, 3*time.Second, cfg.Timeouts.Request)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.CORS.Origins)
+
+	// flags override both
+	cfg, _, err = config.Load([]string{"-p", "4000", "-request-timeout", "4s", "-fsync", "interval"}, env(vars))
+	assert.Nil(t, err)
+	assert.Equal(t, uint(4000), cfg.Port)
+	assert.Equal(t, "env:6379", cfg.Redis.Addr)
+	assert.Equal(t, 4*time.Second, cfg.Timeouts.Request)
+	assert.Equal(t, "interval", cfg.Store.Fsync)
+}
+
+func TestLoadRedisURL(t *testing.T) {
+	cfg, _, err := config.Load(nil, env(map[string]string{"REDIS_URL": "legacy:6379"}))
+	assert.Nil(t, err)
+	assert.Equal(t, "legacy:6379", cfg.Redis.Addr)
+
+	cfg, _, err = config.Load(nil, env(map[string]string{
+		"REDIS_URL":                     "legacy:6379",
+		config.EnvPrefix + "REDIS_ADDR": "new:6379",
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, "new:6379", cfg.Redis.Addr)
+}
+
+func TestLoadBackend(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"Memory", nil, config.BackendMemory},
+		{"Journal", []string{"-data-dir", "data"}, config.BackendJournal},
+		{"SQLite", []string{"-sqlite", "voters.db", "-data-dir", "data"}, config.BackendSQLite},
+		{"Redis", []string{"-r", "localhost:6379", "-sqlite", "voters.db"}, config.BackendRedis},
+		{"Explicit", []string{"-store", "memory", "-r", "localhost:6379"}, config.BackendMemory},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := config.Load(tt.args, env(nil))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, cfg.Store.Backend)
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		vars  map[string]string
+		wants []string
+	}{
+		{
+			name: "Values",
+			args: []string{"-p", "70000", "-store", "sqlite", "-fsync", "sometimes", "-cache-size", "-1",
+				"-cache-ttl", "-1s", "-cors-origins", "example.com", "-log-level", "loud", "-log-format", "xml"},
+			wants: []string{
+				"port: 70000 is not between 1 and 65535",
+				"store.sqlite: is required by the sqlite backend",
+				"store.fsync:",
+				"cache.size: -1 is negative",
+				"cache.ttl: -1s is negative",
+				`cors.origins: "example.com" is not *`,
+				`log.level: "loud" is not debug, info, warn or error`,
+				`log.format: "xml" is not json or text`,
+			},
+		},
+		{
+			name:  "UnknownBackend",
+			args:  []string{"-store", "postgres"},
+			wants: []string{`store.backend: "postgres" is not memory, journal, sqlite or redis`},
+		},
+		{
+			name: "Unparsable",
+			vars: map[string]string{
+				config.EnvPrefix + "PORT":             "eighty",
+				config.EnvPrefix + "FEATURES_METRICS": "maybe",
+			},
+			wants: []string{config.EnvPrefix + "PORT:", config.EnvPrefix + "FEATURES_METRICS:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := config.Load(tt.args, env(tt.vars))
+			if assert.NotNil(t, err) {
+				for _, want := range tt.wants {
+					assert.Contains(t, err.Error(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	_, _, err := config.Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, env(nil))
+	assert.NotNil(t, err)
+
+	// misspelled keys are refused rather than ignored
+	path := writeConfigFile(t, "redis:\n  adress: localhost:6379\n")
+	_, _, err = config.Load([]string{"-config", path}, env(nil))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "adress")
+	}
+
+	// an empty file leaves the defaults
+	path = writeConfigFile(t, "")
+	cfg, _, err := config.Load([]string{"-config", path}, env(nil))
+	assert.Nil(t, err)
+	assert.Equal(t, config.Default().Port, cfg.Port)
+}
+
+func TestConfigYAML(t *testing.T) {
+	cfg, _, err := config.Load([]string{"-r", "localhost:6379", "-redis-password", "s3cret", "-redis-tls",
+		"-degraded-refresh", "30s", "-cors-origins", "https://example.com"}, env(nil))
+	assert.Nil(t, err)
+
+	redacted := cfg.Redact()
+	assert.Equal(t, config.Redacted, redacted.Redis.Password)
+	assert.Equal(t, "s3cret", cfg.Redis.Password)
+
+	out, err := redacted.YAML()
+	assert.Nil(t, err)
+	assert.NotContains(t, string(out), "s3cret")
+	assert.Contains(t, string(out), "degradedRefresh: 30s")
+
+	// what is printed can be loaded back as a config file
+	out, err = cfg.YAML()
+	assert.Nil(t, err)
+	loaded, _, err := config.Load([]string{"-config", writeConfigFile(t, string(out))}, env(nil))
+	assert.Nil(t, err)
+	assert.Equal(t, cfg, loaded)
+}
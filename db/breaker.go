@@ -0,0 +1,239 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// RedisBreakerFailures is how many redis calls in a row have to fail
+	// before the breaker opens and calls fail fast
+	RedisBreakerFailures = 5
+	// RedisBreakerCooldown is how long the breaker stays open before a
+	// single call is let through to probe the server
+	RedisBreakerCooldown = 5 * time.Second
+
+	// RedisCommandTimeout bounds every redis call including its retries
+	RedisCommandTimeout = 2 * time.Second
+	RedisDialTimeout    = time.Second
+	// RedisMaxRetries is how often the client retries a call that failed on
+	// the network, waiting between RedisMinRetryBackoff and
+	// RedisMaxRetryBackoff
+	RedisMaxRetries      = 2
+	RedisMinRetryBackoff = 8 * time.Millisecond
+	RedisMaxRetryBackoff = 256 * time.Millisecond
+
+	// redisRetryAfter is suggested to clients when a call failed while the
+	// breaker was still closed
+	redisRetryAfter = time.Second
+)
+
+// UnavailableError is returned while a store can not be reached, RetryAfter
+// is when it is worth trying again. It matches ErrUnavailable.
+type UnavailableError struct {
+	RetryAfter time.Duration
+	Cause      error
+}
+
+func (e *UnavailableError) Error() string {
+	if e.Cause == nil {
+		return ErrUnavailable.Error()
+	}
+	return fmt.Sprintf("%s: %v", ErrUnavailable.Error(), e.Cause)
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Cause
+}
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// circuitBreaker opens after failures calls in a row failed and fails every
+// call for cooldown. Then one call at a time probes the server, the first
+// that succeeds closes the breaker again.
+type circuitBreaker struct {
+	failures int
+	cooldown time.Duration
+
+	mu          sync.Mutex
+	consecutive int
+	openedAt    time.Time
+	lastErr     error
+	probing     bool
+}
+
+func newCircuitBreaker(failures int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{failures: failures, cooldown: cooldown}
+}
+
+// state is read with b.mu held
+func (b *circuitBreaker) state() BreakerState {
+	switch {
+	case b.consecutive < b.failures:
+		return BreakerClosed
+	case time.Since(b.openedAt) < b.cooldown:
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
+
+func (b *circuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state()
+}
+
+// allow returns an *UnavailableError when the call must not go through
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state() {
+	case BreakerOpen:
+		return &UnavailableError{RetryAfter: b.cooldown - time.Since(b.openedAt), Cause: b.lastErr}
+	case BreakerHalfOpen:
+		if b.probing {
+			return &UnavailableError{RetryAfter: redisRetryAfter, Cause: b.lastErr}
+		}
+		b.probing = true
+	}
+
+	return nil
+}
+
+// release lets the next call probe when a call allow let through ended
+// without telling anything about the server
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// record counts the outcome of a call allow let through
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasProbing := b.probing
+	b.probing = false
+	if !isRedisOutage(err) {
+		b.consecutive = 0
+		return
+	}
+
+	b.lastErr = err
+	b.consecutive++
+	if b.consecutive >= b.failures && (wasProbing || b.consecutive == b.failures) {
+		b.openedAt = time.Now()
+	}
+}
+
+// isRedisOutage tells a server that could not be reached apart from one that
+// answered, a missing key, an error reply or a transaction that lost its
+// WATCH are answers
+func isRedisOutage(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) || errors.Is(err, redis.TxFailedErr) {
+		return false
+	}
+
+	var reply redis.Error
+	return !errors.As(err, &reply)
+}
+
+// breakerHook runs every redis call through the breaker and bounds it by
+// RedisCommandTimeout. Calls that did not reach the server fail with an
+// *UnavailableError so callers can tell an outage from an answer, calls the
+// caller canceled or ran out of time for fail with the error of its context
+// and are not held against redis.
+type breakerHook struct {
+	breaker *circuitBreaker
+}
+
+var _ redis.Hook = breakerHook{}
+
+func (h breakerHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h breakerHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := ctx.Err(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		if err := h.breaker.allow(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, RedisCommandTimeout)
+		defer cancel()
+		err := next(callCtx, cmd)
+		if err != nil && ctx.Err() != nil {
+			h.breaker.release()
+			cmd.SetErr(ctx.Err())
+			return ctx.Err()
+		}
+		h.breaker.record(err)
+		if isRedisOutage(err) {
+			err = &UnavailableError{RetryAfter: redisRetryAfter, Cause: err}
+			cmd.SetErr(err)
+		}
+		return err
+	}
+}
+
+func (h breakerHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := ctx.Err()
+		if err == nil {
+			err = h.breaker.allow()
+		}
+		if err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, RedisCommandTimeout)
+		defer cancel()
+		err = next(callCtx, cmds)
+		if err != nil && ctx.Err() != nil {
+			h.breaker.release()
+			for _, cmd := range cmds {
+				if cmd.Err() != nil {
+					cmd.SetErr(ctx.Err())
+				}
+			}
+			return ctx.Err()
+		}
+		h.breaker.record(err)
+		if isRedisOutage(err) {
+			err = &UnavailableError{RetryAfter: redisRetryAfter, Cause: err}
+			for _, cmd := range cmds {
+				if isRedisOutage(cmd.Err()) {
+					cmd.SetErr(err)
+				}
+			}
+		}
+		return err
+	}
+}
@@ -0,0 +1,178 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVoterCacheBreaker(t *testing.T) {
+	standIn := testutils.StartRedisStandIn(t)
+	voterCache, err := db.NewWithCacheInstance(standIn.Addr())
+	assert.Nil(t, err)
+	voter1 := testutils.NewRandVoter(1)
+	assert.Nil(t, voterCache.AddVoter(ctx, voter1))
+
+	// answers, missing voters included, keep the breaker closed
+	for i := 0; i < db.RedisBreakerFailures; i++ {
+		_, err := voterCache.GetVoter(ctx, 9)
+		assert.ErrorIs(t, err, db.ErrVoterNotFound)
+	}
+	assert.Equal(t, db.BreakerClosed, voterCache.BreakerState())
+
+	standIn.Close()
+	for i := 0; i < db.RedisBreakerFailures; i++ {
+		_, err := voterCache.GetVoter(ctx, 1)
+		assert.ErrorIs(t, err, db.ErrUnavailable)
+	}
+	assert.Equal(t, db.BreakerOpen, voterCache.BreakerState())
+
+	// an open breaker fails without trying redis
+	start := time.Now()
+	err = voterCache.AddVoter(ctx, testutils.NewRandVoter(2))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	var unavailableErr *db.UnavailableError
+	if assert.True(t, errors.As(err, &unavailableErr)) {
+		assert.Greater(t, unavailableErr.RetryAfter, time.Duration(0))
+		assert.LessOrEqual(t, unavailableErr.RetryAfter, db.RedisBreakerCooldown)
+	}
+
+	// after the cooldown one probe finds redis back and closes the breaker
+	standIn.Restart()
+	time.Sleep(db.RedisBreakerCooldown)
+	assert.Equal(t, db.BreakerHalfOpen, voterCache.BreakerState())
+	voter, err := voterCache.GetVoter(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, testutils.AsAdded(voter1), voter)
+	assert.Equal(t, db.BreakerClosed, voterCache.BreakerState())
+}
+
+func TestDegradedServesSnapshot(t *testing.T) {
+	standIn := testutils.StartRedisStandIn(t)
+	voterCache, err := db.NewWithCacheInstance(standIn.Addr())
+	assert.Nil(t, err)
+	degraded := db.NewDegraded(voterCache)
+	voters, polls, votes := degraded.Stores()
+
+	voter1 := testutils.NewRandVoter(1)
+	poll1 := testutils.NewRandPoll(1, 1, 2)
+	assert.Nil(t, voters.AddVoter(ctx, voter1))
+	assert.Nil(t, polls.AddPoll(ctx, poll1))
+	vote, err := votes.CastVote(ctx, db.Vote{VoterId: 1, PollId: 1, OptionId: 2})
+	assert.Nil(t, err)
+
+	// without a snapshot an outage is reported as is
+	standIn.Close()
+	_, err = voters.GetVoter(ctx, 1)
+	assert.ErrorIs(t, err, db.ErrUnavailable)
+	standIn.Restart()
+
+	assert.Nil(t, degraded.Refresh(ctx))
+	status := degraded.Status()
+	assert.Equal(t, 1, status.Voters)
+	assert.Equal(t, 1, status.Polls)
+	assert.Equal(t, 1, status.Votes)
+	// written after the refresh, it is not in the snapshot
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(2)))
+
+	standIn.Close()
+	voter, err := voters.GetVoter(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), voter.Revision)
+	assert.Len(t, voter.VoteHistory, 1)
+	_, err = voters.GetVoter(ctx, 2)
+	assert.ErrorIs(t, err, db.ErrVoterNotFound)
+	assert.Len(t, voters.GetAllVoters(ctx), 1)
+
+	poll, err := polls.GetPoll(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, poll1, poll)
+	assert.Equal(t, []db.Poll{poll1}, polls.GetAllPolls(ctx))
+
+	storedVote, err := votes.GetVote(ctx, vote.VoteId)
+	assert.Nil(t, err)
+	assert.Equal(t, vote.VoteId, storedVote.VoteId)
+	tally, err := votes.GetTally(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, tally.Total)
+
+	// writes are not taken while degraded
+	assert.ErrorIs(t, voters.AddVoter(ctx, testutils.NewRandVoter(3)), db.ErrUnavailable)
+	_, err = votes.CastVote(ctx, db.Vote{VoterId: 1, PollId: 2, OptionId: 1})
+	assert.ErrorIs(t, err, db.ErrUnavailable)
+
+	// a failed refresh keeps the snapshot
+	assert.ErrorIs(t, degraded.Refresh(ctx), db.ErrUnavailable)
+	assert.Equal(t, status.SnapshotAt, degraded.Status().SnapshotAt)
+	assert.Greater(t, degraded.Status().StaleReads, uint64(0))
+}
+
+func TestVoterCacheCanceledCalls(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+	assert.Nil(t, voterCache.AddVoter(ctx, testutils.NewRandVoter(1)))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	expired, cancel := context.WithTimeout(ctx, time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+
+	// calls the caller gave up on fail with its error and say nothing about
+	// redis
+	for i := 0; i < db.RedisBreakerFailures; i++ {
+		_, err := voterCache.GetVoter(canceled, 1)
+		assert.ErrorIs(t, err, context.Canceled)
+		_, err = voterCache.PatchVoter(expired, 1, 0, func(voter db.Voter) (db.Voter, error) { return voter, nil })
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	assert.Equal(t, db.BreakerClosed, voterCache.BreakerState())
+
+	voter, err := voterCache.GetVoter(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, db.FirstRevision, voter.Revision)
+}
+
+func TestDegradedRefreshesChangedKeys(t *testing.T) {
+	standIn := testutils.StartRedisStandIn(t)
+	voterCache, err := db.NewWithCacheInstance(standIn.Addr())
+	assert.Nil(t, err)
+	degraded := db.NewDegraded(voterCache)
+	voters, _, _ := degraded.Stores()
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(1)))
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(2)))
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	assert.Nil(t, degraded.WatchChanges(watchCtx))
+	assert.Nil(t, degraded.Refresh(ctx))
+	assert.Equal(t, 2, degraded.Status().Voters)
+
+	// the stand-in sends no keyspace notifications, without one a change is
+	// not read
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(3)))
+	assert.Nil(t, degraded.Refresh(ctx))
+	assert.Equal(t, 2, degraded.Status().Voters)
+	assert.Nil(t, voters.DeleteVoter(ctx, 2, 0))
+
+	client := redis.NewClient(&redis.Options{Addr: standIn.Addr()})
+	defer client.Close()
+	client.Publish(ctx, fmt.Sprintf("__keyspace@0__:%s%d", db.RedisKeyPrefix, 2), "del")
+	client.Publish(ctx, fmt.Sprintf("__keyspace@0__:%s%d", db.RedisKeyPrefix, 3), "json.set")
+	// the notifications are taken in the background
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, degraded.Refresh(ctx))
+
+	standIn.Close()
+	_, err = voters.GetVoter(ctx, 3)
+	assert.Nil(t, err)
+	_, err = voters.GetVoter(ctx, 2)
+	assert.ErrorIs(t, err, db.ErrVoterNotFound)
+	assert.Equal(t, 2, degraded.Status().Voters)
+}
@@ -0,0 +1,32 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+)
+
+// ctx is what the tests call the stores with
+var ctx = context.Background()
+
+func TestVoterListConformance(t *testing.T) {
+	testutils.RunVoterStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore) {
+		voterList, err := db.New()
+		if err != nil {
+			t.Fatalf("failed to create voter list: %v", err)
+		}
+		pollList, _ := db.NewPollList(voterList)
+		return voterList, pollList
+	})
+}
+
+func TestVoterCacheConformance(t *testing.T) {
+	testutils.RunVoterStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore) {
+		voterCache := newTestVoterCache(t)
+		pollCache := db.NewPollCache(voterCache)
+		pollCache.DeleteAllPolls(ctx)
+		return voterCache, pollCache
+	})
+}
@@ -0,0 +1,464 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DegradedStatus tells what the Degraded stores have to fall back on
+type DegradedStatus struct {
+	// SnapshotAt is when the snapshot was taken, zero while there is none
+	SnapshotAt time.Time `json:"snapshotAt"`
+	Voters     int       `json:"voters"`
+	Polls      int       `json:"polls"`
+	Votes      int       `json:"votes"`
+	// StaleReads counts the reads answered from the snapshot
+	StaleReads uint64 `json:"staleReads"`
+}
+
+// degradedSnapshot is an in-memory copy of everything in redis
+type degradedSnapshot struct {
+	takenAt time.Time
+	voters  *VoterList
+	polls   *PollList
+	votes   *VoteList
+}
+
+// Degraded keeps a snapshot of the redis stores and answers reads from it
+// while redis can not be reached, writes still go to redis and fail. The
+// snapshot is only as fresh as the last Refresh.
+type Degraded struct {
+	voters *VoterCache
+	polls  *PollCache
+	votes  *VoteCache
+
+	mu         sync.RWMutex
+	snapshot   *degradedSnapshot
+	staleReads uint64
+
+	// changed holds the keys written since the last Refresh as told by the
+	// keyspace notifications, changedAll is set while there is no snapshot
+	// or notifications may have been missed
+	changesMu  sync.Mutex
+	changed    map[string]struct{}
+	changedAll bool
+}
+
+func NewDegraded(voterCache *VoterCache) *Degraded {
+	return &Degraded{
+		voters: voterCache,
+		polls:  NewPollCache(voterCache),
+		votes:  NewVoteCache(voterCache),
+		// changed stays nil until the changes are watched
+		changedAll: true,
+	}
+}
+
+// Stores returns the redis stores falling back to the snapshot
+func (d *Degraded) Stores() (VoterStore, PollStore, VoteStore) {
+	return degradedVoters{VoterCache: d.voters, d: d},
+		degradedPolls{PollCache: d.polls, d: d},
+		degradedVotes{VoteCache: d.votes, d: d}
+}
+
+// Refresh brings the snapshot up to what is in redis now. While the changes
+// are watched only the keys written since the last Refresh are read again,
+// otherwise everything is copied. The old snapshot is kept when redis could
+// not be read completely.
+func (d *Degraded) Refresh(ctx context.Context) error {
+	d.changesMu.Lock()
+	changed, changedAll := d.changed, d.changedAll
+	if changed != nil {
+		d.changed, d.changedAll = make(map[string]struct{}), false
+	}
+	d.changesMu.Unlock()
+
+	var err error
+	if changed == nil || changedAll {
+		err = d.refreshAll(ctx)
+	} else {
+		err = d.refreshChanged(ctx, changed)
+	}
+	if err != nil && changed != nil {
+		// read them again next time
+		d.changesMu.Lock()
+		for key := range changed {
+			d.changed[key] = struct{}{}
+		}
+		d.changedAll = d.changedAll || changedAll
+		d.changesMu.Unlock()
+	}
+	return err
+}
+
+// refreshAll replaces the snapshot with a copy of everything in redis
+func (d *Degraded) refreshAll(ctx context.Context) error {
+	voters := make(map[uint]Voter)
+	err := d.voters.forEachVoter(ctx, func(voter Voter) {
+		voters[voter.VoterId] = voter
+	})
+	if err != nil {
+		return err
+	}
+
+	polls, err := d.polls.allPolls(ctx)
+	if err != nil {
+		return err
+	}
+
+	votes := []Vote{}
+	err = d.votes.forEachVote(ctx, func(vote Vote) {
+		votes = append(votes, vote)
+	})
+	if err != nil {
+		return err
+	}
+
+	snapshot := &degradedSnapshot{
+		takenAt: time.Now(),
+		voters:  &VoterList{Voters: voters},
+		polls:   &PollList{Polls: make(map[uint]Poll, len(polls))},
+	}
+	for _, poll := range polls {
+		snapshot.polls.Polls[poll.PollId] = poll
+	}
+	snapshot.votes = &VoteList{
+		Votes:   make(map[uint]Vote, len(votes)),
+		tallies: tallyVotes(votes),
+		voters:  snapshot.voters,
+	}
+	for _, vote := range votes {
+		snapshot.votes.Votes[vote.VoteId] = vote
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.snapshot = snapshot
+	return nil
+}
+
+// refreshChanged replaces the snapshot with a copy that has the voters,
+// polls and votes under the changed keys read again from redis
+func (d *Degraded) refreshChanged(ctx context.Context, changed map[string]struct{}) error {
+	var voterIds, pollIds, voteIds []string
+	for key := range changed {
+		switch {
+		case strings.HasPrefix(key, RedisKeyPrefix):
+			voterIds = append(voterIds, strings.TrimPrefix(key, RedisKeyPrefix))
+		case strings.HasPrefix(key, RedisPollKeyPrefix):
+			pollIds = append(pollIds, strings.TrimPrefix(key, RedisPollKeyPrefix))
+		case strings.HasPrefix(key, RedisVoteKeyPrefix):
+			voteIds = append(voteIds, strings.TrimPrefix(key, RedisVoteKeyPrefix))
+		}
+	}
+
+	voters, err := d.voters.getVotersFromRedis(ctx, voterIds)
+	if err != nil {
+		return err
+	}
+	polls, err := d.polls.getPollsFromRedis(ctx, pollIds)
+	if err != nil {
+		return err
+	}
+	votes, err := d.votes.getVotesFromRedis(ctx, voteIds)
+	if err != nil {
+		return err
+	}
+
+	d.mu.RLock()
+	old := d.snapshot
+	d.mu.RUnlock()
+	if old == nil {
+		return d.refreshAll(ctx)
+	}
+
+	// what was changed and is not read back was removed
+	snapshot := &degradedSnapshot{
+		takenAt: time.Now(),
+		voters:  &VoterList{Voters: copyChanged(old.voters.Voters, voterIds, voters, func(voter Voter) uint { return voter.VoterId })},
+		polls:   &PollList{Polls: copyChanged(old.polls.Polls, pollIds, polls, func(poll Poll) uint { return poll.PollId })},
+	}
+	snapshot.votes = &VoteList{
+		Votes:  copyChanged(old.votes.Votes, voteIds, votes, func(vote Vote) uint { return vote.VoteId }),
+		voters: snapshot.voters,
+	}
+	snapshot.votes.tallies = old.votes.tallies
+	if len(voteIds) > 0 {
+		snapshot.votes.tallies = tallyVotes(snapshot.votes.GetAllVotes(ctx))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.snapshot = snapshot
+	return nil
+}
+
+// copyChanged copies items, drops the ids that were changed and adds what
+// was read back for them
+func copyChanged[T any](items map[uint]T, changedIds []string, readBack []T, idOf func(item T) uint) map[uint]T {
+	copied := make(map[uint]T, len(items))
+	for id, item := range items {
+		copied[id] = item
+	}
+	for _, changedId := range changedIds {
+		if id, err := strconv.ParseUint(changedId, 10, 32); err == nil {
+			delete(copied, uint(id))
+		}
+	}
+	for _, item := range readBack {
+		copied[idOf(item)] = item
+	}
+	return copied
+}
+
+// WatchChanges marks the voter, poll and vote keys redis reports written as
+// changed until ctx is done. Notifications can be missed while the
+// subscription reconnects, the next Refresh then copies everything again.
+func (d *Degraded) WatchChanges(ctx context.Context) error {
+	d.voters.enableKeyspaceEvents(ctx)
+
+	channelPrefix := fmt.Sprintf("__keyspace@%d__:", d.voters.cacheClient.Options().DB)
+	patterns := []string{channelPrefix + RedisKeyPrefix + "*", channelPrefix + RedisPollKeyPrefix + "*", channelPrefix + RedisVoteKeyPrefix + "*"}
+	pubsub := d.voters.cacheClient.PSubscribe(ctx, patterns...)
+	// wait for every subscription so no change after this call is missed
+	for range patterns {
+		if _, err := pubsub.Receive(ctx); err != nil {
+			pubsub.Close()
+			return err
+		}
+	}
+
+	d.changesMu.Lock()
+	d.changed = make(map[string]struct{})
+	d.changesMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		pubsub.Close()
+	}()
+	go func() {
+		for msg := range pubsub.ChannelWithSubscriptions() {
+			d.changesMu.Lock()
+			switch msg := msg.(type) {
+			case *redis.Message:
+				d.changed[strings.TrimPrefix(msg.Channel, channelPrefix)] = struct{}{}
+			case *redis.Subscription:
+				// subscribed again after a reconnect
+				d.changedAll = true
+			}
+			d.changesMu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// RefreshEvery refreshes the snapshot now and then every interval until the
+// returned func is called, which also cancels a refresh in flight. Failed
+// refreshes are passed to failed. The changes are watched so a refresh only
+// reads what changed, while they can not be every refresh copies everything
+// and watching is tried again.
+func (d *Degraded) RefreshEvery(interval time.Duration, failed func(err error)) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		watching := false
+		for {
+			if !watching {
+				if err := d.WatchChanges(ctx); err != nil {
+					slog.WarnContext(ctx, "watching redis changes failed, the snapshot is copied whole", "err", err)
+				} else {
+					watching = true
+				}
+			}
+			if err := d.Refresh(ctx); err != nil && ctx.Err() == nil {
+				failed(err)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (d *Degraded) Status() DegradedStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	status := DegradedStatus{StaleReads: d.staleReads}
+	if d.snapshot != nil {
+		status.SnapshotAt = d.snapshot.takenAt
+		status.Voters = len(d.snapshot.voters.Voters)
+		status.Polls = len(d.snapshot.polls.Polls)
+		status.Votes = len(d.snapshot.votes.Votes)
+	}
+	return status
+}
+
+// fallback returns the snapshot to answer from when err says redis could not
+// be reached and there is one
+func (d *Degraded) fallback(err error) *degradedSnapshot {
+	if !errors.Is(err, ErrUnavailable) {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.snapshot != nil {
+		d.staleReads++
+	}
+	return d.snapshot
+}
+
+// the reads of the Degraded stores, writes are those of the embedded store
+
+type degradedVoters struct {
+	*VoterCache
+	d *Degraded
+}
+
+func (v degradedVoters) GetVoter(ctx context.Context, voterId uint) (Voter, error) {
+	voter, err := v.VoterCache.GetVoter(ctx, voterId)
+	if snapshot := v.d.fallback(err); snapshot != nil {
+		return snapshot.voters.GetVoter(ctx, voterId)
+	}
+	return voter, err
+}
+
+func (v degradedVoters) GetAllVoters(ctx context.Context) []Voter {
+	var voters []Voter
+	err := v.forEachVoter(ctx, func(voter Voter) {
+		voters = append(voters, voter)
+	})
+	if snapshot := v.d.fallback(err); snapshot != nil {
+		return snapshot.voters.GetAllVoters(ctx)
+	}
+	return voters
+}
+
+func (v degradedVoters) QueryVoters(ctx context.Context, query VoterQuery) (VoterPage, error) {
+	page, err := v.VoterCache.QueryVoters(ctx, query)
+	if snapshot := v.d.fallback(err); snapshot != nil {
+		return snapshot.voters.QueryVoters(ctx, query)
+	}
+	return page, err
+}
+
+func (v degradedVoters) CountVoters(ctx context.Context) (int, error) {
+	count, err := v.VoterCache.CountVoters(ctx)
+	if snapshot := v.d.fallback(err); snapshot != nil {
+		return snapshot.voters.CountVoters(ctx)
+	}
+	return count, err
+}
+
+func (v degradedVoters) GetVoterPolls(ctx context.Context, voterId uint) ([]VoterHistory, error) {
+	voterPolls, err := v.VoterCache.GetVoterPolls(ctx, voterId)
+	if snapshot := v.d.fallback(err); snapshot != nil {
+		return snapshot.voters.GetVoterPolls(ctx, voterId)
+	}
+	return voterPolls, err
+}
+
+func (v degradedVoters) GetVoterPoll(ctx context.Context, voterId uint, pollId uint) (VoterHistory, error) {
+	voterPoll, err := v.VoterCache.GetVoterPoll(ctx, voterId, pollId)
+	if snapshot := v.d.fallback(err); snapshot != nil {
+		return snapshot.voters.GetVoterPoll(ctx, voterId, pollId)
+	}
+	return voterPoll, err
+}
+
+type degradedPolls struct {
+	*PollCache
+	d *Degraded
+}
+
+func (p degradedPolls) GetPoll(ctx context.Context, pollId uint) (Poll, error) {
+	poll, err := p.PollCache.GetPoll(ctx, pollId)
+	if snapshot := p.d.fallback(err); snapshot != nil {
+		return snapshot.polls.GetPoll(ctx, pollId)
+	}
+	return poll, err
+}
+
+func (p degradedPolls) GetAllPolls(ctx context.Context) []Poll {
+	polls, err := p.allPolls(ctx)
+	if snapshot := p.d.fallback(err); snapshot != nil {
+		return snapshot.polls.GetAllPolls(ctx)
+	}
+	return polls
+}
+
+func (p degradedPolls) GetPollOptions(ctx context.Context, pollId uint) ([]PollOption, error) {
+	options, err := p.PollCache.GetPollOptions(ctx, pollId)
+	if snapshot := p.d.fallback(err); snapshot != nil {
+		return snapshot.polls.GetPollOptions(ctx, pollId)
+	}
+	return options, err
+}
+
+func (p degradedPolls) GetPollOption(ctx context.Context, pollId uint, optionId uint) (PollOption, error) {
+	option, err := p.PollCache.GetPollOption(ctx, pollId, optionId)
+	if snapshot := p.d.fallback(err); snapshot != nil {
+		return snapshot.polls.GetPollOption(ctx, pollId, optionId)
+	}
+	return option, err
+}
+
+type degradedVotes struct {
+	*VoteCache
+	d *Degraded
+}
+
+func (v degradedVotes) GetVote(ctx context.Context, voteId uint) (Vote, error) {
+	vote, err := v.VoteCache.GetVote(ctx, voteId)
+	if snapshot := v.d.fallback(err); snapshot != nil {
+		return snapshot.votes.GetVote(ctx, voteId)
+	}
+	return vote, err
+}
+
+func (v degradedVotes) GetAllVotes(ctx context.Context) []Vote {
+	votes := []Vote{}
+	err := v.forEachVote(ctx, func(vote Vote) {
+		votes = append(votes, vote)
+	})
+	if snapshot := v.d.fallback(err); snapshot != nil {
+		return snapshot.votes.GetAllVotes(ctx)
+	}
+	return votes
+}
+
+func (v degradedVotes) CountVotes(ctx context.Context) (int, error) {
+	count, err := v.VoteCache.CountVotes(ctx)
+	if snapshot := v.d.fallback(err); snapshot != nil {
+		return snapshot.votes.CountVotes(ctx)
+	}
+	return count, err
+}
+
+func (v degradedVotes) GetTally(ctx context.Context, pollId uint) (Tally, error) {
+	tally, err := v.VoteCache.GetTally(ctx, pollId)
+	if snapshot := v.d.fallback(err); snapshot != nil {
+		return snapshot.votes.GetTally(ctx, pollId)
+	}
+	return tally, err
+}
@@ -0,0 +1,34 @@
+package db
+
+import "errors"
+
+// Errors returned by every store, match them with errors.Is. Their messages
+// are part of the API, clients have been reading them from error bodies.
+var (
+	ErrVoterNotFound  = errors.New("voter does not exist")
+	ErrVoterExists    = errors.New("voter already exists")
+	ErrPollNotFound   = errors.New("poll does not exist")
+	ErrPollExists     = errors.New("poll already exists")
+	ErrOptionNotFound = errors.New("option does not exist")
+	ErrOptionExists   = errors.New("option already exists")
+	ErrVoteNotFound   = errors.New("vote does not exist")
+	// ErrVoterIdMismatch is returned when a body names another voter than
+	// the path it was sent to
+	ErrVoterIdMismatch = errors.New("voterId does not match the path")
+	// ErrRevisionMismatch is returned when a write names a revision of the
+	// voter that is no longer the stored one
+	ErrRevisionMismatch = errors.New("voter was changed since the given revision")
+	// ErrAlreadyVoted is returned by CastVote when the voter already has a
+	// vote history entry for the poll
+	ErrAlreadyVoted = errors.New("voter already voted in this poll")
+	// ErrVoteRecorded is returned by UpdateVoterPoll and DeleteVoterPoll for
+	// a history entry that was written by casting a vote, the vote is
+	// counted in the tally
+	ErrVoteRecorded = errors.New("vote history entry records a cast vote")
+	// ErrValidation is matched by every *ValidationError, the fields that
+	// failed are in the ValidationError
+	ErrValidation = errors.New("validation failed")
+	// ErrUnavailable is matched by every *UnavailableError, the store could
+	// not be reached and the call may work when it is retried later
+	ErrUnavailable = errors.New("store is unavailable")
+)
@@ -0,0 +1,486 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	JournalLogFile      = "wal.log"
+	JournalSnapshotFile = "snapshot.json"
+	// JournalSnapshotEvery is how many records go into the log before it is
+	// compacted into a new snapshot
+	JournalSnapshotEvery = 10000
+	// JournalFsyncInterval is how often FsyncInterval flushes the log
+	JournalFsyncInterval = time.Second
+)
+
+// FsyncPolicy says when the journal flushes its log to disk
+type FsyncPolicy string
+
+const (
+	// FsyncAlways flushes every record before the write returns
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncInterval flushes every JournalFsyncInterval, a machine crash can
+	// lose the writes of the last interval
+	FsyncInterval FsyncPolicy = "interval"
+	// FsyncNever leaves flushing to the operating system
+	FsyncNever FsyncPolicy = "never"
+)
+
+var errJournalClosed = errors.New("journal is closed")
+
+func ParseFsyncPolicy(policy string) (FsyncPolicy, error) {
+	switch FsyncPolicy(policy) {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+		return FsyncPolicy(policy), nil
+	}
+
+	return "", fmt.Errorf("fsync policy must be one of %s, %s or %s", FsyncAlways, FsyncInterval, FsyncNever)
+}
+
+// journal record ops, a record carries the state a write left behind rather
+// than the write itself so replaying a record twice does no harm
+const (
+	opPutVoter        = "putVoter"
+	opDeleteVoter     = "deleteVoter"
+	opDeleteAllVoters = "deleteAllVoters"
+	opPutPoll         = "putPoll"
+	opDeletePoll      = "deletePoll"
+	opDeleteAllPolls  = "deleteAllPolls"
+	// opPutVote carries the voter whose history the vote was recorded in
+	opPutVote = "putVote"
+	// opDeleteAllVotes carries the last voteId handed out in Id
+	opDeleteAllVotes = "deleteAllVotes"
+)
+
+type journalRecord struct {
+	Seq   uint64 `json:"seq"`
+	Op    string `json:"op"`
+	Id    uint   `json:"id,omitempty"`
+	Voter *Voter `json:"voter,omitempty"`
+	Poll  *Poll  `json:"poll,omitempty"`
+	Vote  *Vote  `json:"vote,omitempty"`
+}
+
+// journalSnapshot is everything the stores hold after record Seq, tallies
+// are counted again from the votes
+type journalSnapshot struct {
+	Seq        uint64  `json:"seq"`
+	Voters     []Voter `json:"voters"`
+	Polls      []Poll  `json:"polls"`
+	Votes      []Vote  `json:"votes"`
+	LastVoteId uint    `json:"lastVoteId"`
+}
+
+// Journal keeps the in-memory stores on disk. Every write is logged to an
+// append-only log in dir before it returns, the log is compacted into a
+// snapshot every JournalSnapshotEvery records and both are read back when
+// the journal is opened again. Use the stores returned by Stores, writes to
+// the underlying lists are not logged.
+//
+// A write that could not be logged leaves the journal refusing every later
+// write, the in-memory state is then ahead of the disk until a restart.
+type Journal struct {
+	dir   string
+	fsync FsyncPolicy
+
+	voters *VoterList
+	polls  *PollList
+	votes  *VoteList
+
+	mu            sync.Mutex
+	log           *os.File
+	seq           uint64
+	sinceSnapshot int
+	dirty         bool
+	err           error
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	// closeOnce runs the shutdown once, every Close returns closeErr
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// OpenJournal recovers the stores kept in dir, creating it when needed. A
+// record that was only partly written when the process died is cut off the
+// log.
+func OpenJournal(dir string, fsync FsyncPolicy) (*Journal, error) {
+	if _, err := ParseFsyncPolicy(string(fsync)); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	voters, _ := New()
+	polls, _ := NewPollList(voters)
+	votes, _ := NewVoteList(voters)
+	j := &Journal{
+		dir:    dir,
+		fsync:  fsync,
+		voters: voters,
+		polls:  polls,
+		votes:  votes,
+		done:   make(chan struct{}),
+	}
+
+	if err := j.recover(); err != nil {
+		return nil, err
+	}
+
+	if fsync == FsyncInterval {
+		j.wg.Add(1)
+		go j.syncEvery(JournalFsyncInterval)
+	}
+	return j, nil
+}
+
+// Stores returns the stores whose writes are logged
+func (j *Journal) Stores() (VoterStore, PollStore, VoteStore) {
+	return journalVoters{VoterList: j.voters, j: j},
+		journalPolls{PollList: j.polls, j: j},
+		journalVotes{VoteList: j.votes, j: j}
+}
+
+// Snapshot compacts the log into a new snapshot right away
+func (j *Journal) Snapshot() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.err != nil {
+		return j.err
+	}
+	return j.snapshot()
+}
+
+// Close compacts and flushes the log, the stores refuse writes afterwards.
+// It is safe to call more than once and from several goroutines, later calls
+// wait for the first and return its error.
+func (j *Journal) Close() error {
+	j.closeOnce.Do(func() {
+		j.closeErr = j.close()
+	})
+	return j.closeErr
+}
+
+func (j *Journal) close() error {
+	close(j.done)
+	j.wg.Wait()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var err error
+	if j.err == nil && j.sinceSnapshot > 0 {
+		err = j.snapshot()
+	}
+	if j.err == nil {
+		err = errors.Join(err, j.log.Sync())
+	}
+	err = errors.Join(err, j.log.Close())
+	j.err = errJournalClosed
+	return err
+}
+
+// write runs change holding the journal lock and logs the record it returns,
+// so records are logged in the order the changes were made
+func (j *Journal) write(change func() (journalRecord, error)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.err != nil {
+		return j.err
+	}
+
+	record, err := change()
+	if err != nil {
+		return err
+	}
+	return j.append(record)
+}
+
+// append logs record, j.mu is held
+func (j *Journal) append(record journalRecord) error {
+	record.Seq = j.seq + 1
+	line, err := encodeRecord(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := j.log.Write(line); err != nil {
+		return j.fail(err)
+	}
+	if j.fsync == FsyncAlways {
+		if err := j.log.Sync(); err != nil {
+			return j.fail(err)
+		}
+	} else {
+		j.dirty = true
+	}
+	j.seq = record.Seq
+
+	// a failed snapshot loses nothing, the log still has every record
+	j.sinceSnapshot++
+	if j.sinceSnapshot >= JournalSnapshotEvery {
+		if err := j.snapshot(); err != nil {
+			slog.Error("writing journal snapshot failed", "err", err)
+		}
+	}
+	return nil
+}
+
+func (j *Journal) fail(err error) error {
+	j.err = fmt.Errorf("journal stopped taking writes: %w", err)
+	return j.err
+}
+
+func (j *Journal) syncEvery(interval time.Duration) {
+	defer j.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.done:
+			return
+		case <-ticker.C:
+			j.mu.Lock()
+			if j.dirty && j.err == nil {
+				if err := j.log.Sync(); err != nil {
+					slog.Error("flushing journal failed", "err", j.fail(err))
+				}
+				j.dirty = false
+			}
+			j.mu.Unlock()
+		}
+	}
+}
+
+// snapshot writes the stores to a new snapshot and empties the log. The
+// snapshot is renamed into place only once it is on disk, if the process
+// dies before the log is emptied its records are skipped by seq on replay.
+func (j *Journal) snapshot() error {
+	j.votes.mu.RLock()
+	lastVoteId := j.votes.lastVoteId
+	j.votes.mu.RUnlock()
+
+	data, err := json.Marshal(journalSnapshot{
+		Seq:        j.seq,
+		Voters:     j.voters.GetAllVoters(context.Background()),
+		Polls:      j.polls.GetAllPolls(context.Background()),
+		Votes:      j.votes.GetAllVotes(context.Background()),
+		LastVoteId: lastVoteId,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileSynced(filepath.Join(j.dir, JournalSnapshotFile), data); err != nil {
+		return err
+	}
+
+	if err := j.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := j.log.Sync(); err != nil {
+		return err
+	}
+
+	j.sinceSnapshot = 0
+	j.dirty = false
+	return nil
+}
+
+// recover loads the snapshot and replays the log records that came after it
+func (j *Journal) recover() error {
+	snapshotPath := filepath.Join(j.dir, JournalSnapshotFile)
+	// a snapshot that was being written when the process died is incomplete
+	os.Remove(snapshotPath + ".tmp")
+
+	data, err := os.ReadFile(snapshotPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var snapshot journalSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return fmt.Errorf("reading %s: %w", snapshotPath, err)
+		}
+		j.restore(snapshot)
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(j.dir, JournalLogFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	end, err := j.replay(logFile)
+	if err == nil {
+		err = logFile.Truncate(end)
+	}
+	if err == nil {
+		_, err = logFile.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		logFile.Close()
+		return err
+	}
+
+	j.votes.tallies = tallyVotes(j.votes.GetAllVotes(context.Background()))
+	j.log = logFile
+	return nil
+}
+
+func (j *Journal) restore(snapshot journalSnapshot) {
+	j.seq = snapshot.Seq
+	for _, voter := range snapshot.Voters {
+		j.voters.Voters[voter.VoterId] = voter
+	}
+	for _, poll := range snapshot.Polls {
+		j.polls.Polls[poll.PollId] = poll
+	}
+	for _, vote := range snapshot.Votes {
+		j.votes.Votes[vote.VoteId] = vote
+	}
+	j.votes.lastVoteId = snapshot.LastVoteId
+}
+
+// replay applies the records of log newer than the snapshot and returns
+// where the last whole record ends, anything after it is a torn write
+func (j *Journal) replay(log io.Reader) (int64, error) {
+	reader := bufio.NewReader(log)
+	var end int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				slog.Warn("dropping a torn journal record", "bytes", len(line))
+			}
+			return end, nil
+		}
+		if err != nil {
+			return end, err
+		}
+
+		record, err := decodeRecord(line)
+		if err != nil {
+			slog.Warn("dropping journal records", "offset", end, "err", err)
+			return end, nil
+		}
+		end += int64(len(line))
+
+		if record.Seq <= j.seq {
+			continue
+		}
+		j.apply(record)
+		j.seq = record.Seq
+		j.sinceSnapshot++
+	}
+}
+
+func (j *Journal) apply(record journalRecord) {
+	switch record.Op {
+	case opPutVoter:
+		j.voters.Voters[record.Voter.VoterId] = *record.Voter
+	case opDeleteVoter:
+		delete(j.voters.Voters, record.Id)
+	case opDeleteAllVoters:
+		j.voters.Voters = make(map[uint]Voter)
+	case opPutPoll:
+		j.polls.Polls[record.Poll.PollId] = *record.Poll
+	case opDeletePoll:
+		delete(j.polls.Polls, record.Id)
+	case opDeleteAllPolls:
+		j.polls.Polls = make(map[uint]Poll)
+	case opPutVote:
+		j.votes.Votes[record.Vote.VoteId] = *record.Vote
+		j.voters.Voters[record.Voter.VoterId] = *record.Voter
+		if record.Vote.VoteId > j.votes.lastVoteId {
+			j.votes.lastVoteId = record.Vote.VoteId
+		}
+	case opDeleteAllVotes:
+		j.votes.Votes = make(map[uint]Vote)
+		if record.Id > j.votes.lastVoteId {
+			j.votes.lastVoteId = record.Id
+		}
+	}
+}
+
+// encodeRecord frames record as one line, the JSON is preceded by its
+// CRC-32 so a torn or damaged record is told apart from a whole one
+func encodeRecord(record journalRecord) ([]byte, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(payload), payload)), nil
+}
+
+func decodeRecord(line []byte) (journalRecord, error) {
+	checksum, payload, ok := bytes.Cut(bytes.TrimSuffix(line, []byte("\n")), []byte(" "))
+	if !ok {
+		return journalRecord{}, errors.New("record has no checksum")
+	}
+	sum, err := strconv.ParseUint(string(checksum), 16, 32)
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE(payload) {
+		return journalRecord{}, errors.New("record checksum does not match")
+	}
+
+	var record journalRecord
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return journalRecord{}, err
+	}
+	return record, nil
+}
+
+// writeFileSynced replaces path with data, a crash leaves either the old or
+// the new file and never a part of one
+func writeFileSynced(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// the rename itself is only durable once the directory is flushed
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
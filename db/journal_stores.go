@@ -0,0 +1,197 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+)
+
+// journalVoters, journalPolls and journalVotes log every write of the
+// in-memory store they wrap, reads go straight to the store
+
+type journalVoters struct {
+	*VoterList
+	j *Journal
+}
+
+var _ VoterStore = journalVoters{}
+
+// putVoter makes the change and logs the voter it left behind
+func (v journalVoters) putVoter(ctx context.Context, voterId uint, change func() error) error {
+	return v.j.write(func() (journalRecord, error) {
+		if err := change(); err != nil {
+			return journalRecord{}, err
+		}
+
+		voter, err := v.VoterList.GetVoter(ctx, voterId)
+		return journalRecord{Op: opPutVoter, Voter: &voter}, err
+	})
+}
+
+func (v journalVoters) AddVoter(ctx context.Context, voter Voter) error {
+	return v.putVoter(ctx, voter.VoterId, func() error {
+		return v.VoterList.AddVoter(ctx, voter)
+	})
+}
+
+func (v journalVoters) DeleteAllVoters(ctx context.Context) {
+	err := v.j.write(func() (journalRecord, error) {
+		v.VoterList.DeleteAllVoters(ctx)
+		return journalRecord{Op: opDeleteAllVoters}, nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "deleting all voters failed", "err", err)
+	}
+}
+
+func (v journalVoters) UpdateVoter(ctx context.Context, voter Voter, voterId uint, ifRevision uint64) (Voter, error) {
+	var updated Voter
+	err := v.putVoter(ctx, voterId, func() error {
+		var err error
+		updated, err = v.VoterList.UpdateVoter(ctx, voter, voterId, ifRevision)
+		return err
+	})
+	if err != nil {
+		return Voter{}, err
+	}
+
+	return updated, nil
+}
+
+func (v journalVoters) PatchVoter(ctx context.Context, voterId uint, ifRevision uint64, patch VoterPatch) (Voter, error) {
+	var patched Voter
+	err := v.putVoter(ctx, voterId, func() error {
+		var err error
+		patched, err = v.VoterList.PatchVoter(ctx, voterId, ifRevision, patch)
+		return err
+	})
+	if err != nil {
+		return Voter{}, err
+	}
+
+	return patched, nil
+}
+
+func (v journalVoters) DeleteVoter(ctx context.Context, voterId uint, ifRevision uint64) error {
+	return v.j.write(func() (journalRecord, error) {
+		err := v.VoterList.DeleteVoter(ctx, voterId, ifRevision)
+		return journalRecord{Op: opDeleteVoter, Id: voterId}, err
+	})
+}
+
+func (v journalVoters) AddVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint) error {
+	return v.putVoter(ctx, voterId, func() error {
+		return v.VoterList.AddVoterPoll(ctx, voterPoll, voterId)
+	})
+}
+
+func (v journalVoters) UpdateVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint, pollId uint) error {
+	return v.putVoter(ctx, voterId, func() error {
+		return v.VoterList.UpdateVoterPoll(ctx, voterPoll, voterId, pollId)
+	})
+}
+
+func (v journalVoters) DeleteVoterPoll(ctx context.Context, voterId uint, pollId uint) error {
+	return v.putVoter(ctx, voterId, func() error {
+		return v.VoterList.DeleteVoterPoll(ctx, voterId, pollId)
+	})
+}
+
+type journalPolls struct {
+	*PollList
+	j *Journal
+}
+
+var _ PollStore = journalPolls{}
+
+// putPoll makes the change and logs the poll it left behind
+func (p journalPolls) putPoll(ctx context.Context, pollId uint, change func() error) error {
+	return p.j.write(func() (journalRecord, error) {
+		if err := change(); err != nil {
+			return journalRecord{}, err
+		}
+
+		poll, err := p.PollList.GetPoll(ctx, pollId)
+		return journalRecord{Op: opPutPoll, Poll: &poll}, err
+	})
+}
+
+func (p journalPolls) AddPoll(ctx context.Context, poll Poll) error {
+	return p.putPoll(ctx, poll.PollId, func() error {
+		return p.PollList.AddPoll(ctx, poll)
+	})
+}
+
+func (p journalPolls) DeleteAllPolls(ctx context.Context) {
+	err := p.j.write(func() (journalRecord, error) {
+		p.PollList.DeleteAllPolls(ctx)
+		return journalRecord{Op: opDeleteAllPolls}, nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "deleting all polls failed", "err", err)
+	}
+}
+
+func (p journalPolls) UpdatePoll(ctx context.Context, poll Poll, pollId uint) error {
+	return p.putPoll(ctx, pollId, func() error {
+		return p.PollList.UpdatePoll(ctx, poll, pollId)
+	})
+}
+
+func (p journalPolls) DeletePoll(ctx context.Context, pollId uint) error {
+	return p.j.write(func() (journalRecord, error) {
+		err := p.PollList.DeletePoll(ctx, pollId)
+		return journalRecord{Op: opDeletePoll, Id: pollId}, err
+	})
+}
+
+func (p journalPolls) AddPollOption(ctx context.Context, option PollOption, pollId uint) error {
+	return p.putPoll(ctx, pollId, func() error {
+		return p.PollList.AddPollOption(ctx, option, pollId)
+	})
+}
+
+func (p journalPolls) DeletePollOption(ctx context.Context, pollId uint, optionId uint) error {
+	return p.putPoll(ctx, pollId, func() error {
+		return p.PollList.DeletePollOption(ctx, pollId, optionId)
+	})
+}
+
+// journalVotes logs tallies only through the votes they are counted from,
+// so RebuildTallies changes nothing that is kept
+type journalVotes struct {
+	*VoteList
+	j *Journal
+}
+
+var _ VoteStore = journalVotes{}
+
+func (v journalVotes) CastVote(ctx context.Context, vote Vote) (Vote, error) {
+	err := v.j.write(func() (journalRecord, error) {
+		var err error
+		vote, err = v.VoteList.CastVote(ctx, vote)
+		if err != nil {
+			return journalRecord{}, err
+		}
+
+		voter, err := v.VoteList.voters.GetVoter(ctx, vote.VoterId)
+		return journalRecord{Op: opPutVote, Vote: &vote, Voter: &voter}, err
+	})
+	if err != nil {
+		return Vote{}, err
+	}
+
+	return vote, nil
+}
+
+func (v journalVotes) DeleteAllVotes(ctx context.Context) {
+	err := v.j.write(func() (journalRecord, error) {
+		v.VoteList.DeleteAllVotes(ctx)
+
+		v.VoteList.mu.RLock()
+		defer v.VoteList.mu.RUnlock()
+		return journalRecord{Op: opDeleteAllVotes, Id: v.VoteList.lastVoteId}, nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "deleting all votes failed", "err", err)
+	}
+}
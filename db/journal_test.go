@@ -0,0 +1,271 @@
+package db_test
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// crashDirEnv makes the test binary run as the journal writer that
+// TestJournalSurvivesKill kills
+const crashDirEnv = "VOTER_API_JOURNAL_CRASH_DIR"
+
+// openJournal opens the journal in dir, a journal that is never closed is
+// left behind like one of a process that died
+func openJournal(t *testing.T, dir string) *db.Journal {
+	journal, err := db.OpenJournal(dir, db.FsyncAlways)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	return journal
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	for _, policy := range []db.FsyncPolicy{db.FsyncAlways, db.FsyncInterval, db.FsyncNever} {
+		parsed, err := db.ParseFsyncPolicy(string(policy))
+		assert.Nil(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+
+	_, err := db.ParseFsyncPolicy("sometimes")
+	assert.NotNil(t, err)
+}
+
+func TestJournalConformance(t *testing.T) {
+	newStores := func(t *testing.T) (db.VoterStore, db.PollStore, db.VoteStore) {
+		journal := openJournal(t, t.TempDir())
+		t.Cleanup(func() { journal.Close() })
+		return journal.Stores()
+	}
+
+	testutils.RunVoterStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore) {
+		voters, polls, _ := newStores(t)
+		return voters, polls
+	})
+	testutils.RunPollStoreConformance(t, func(t *testing.T) db.PollStore {
+		_, polls, _ := newStores(t)
+		return polls
+	})
+	testutils.RunVoteStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore, db.VoteStore) {
+		return newStores(t)
+	})
+}
+
+func TestJournalReplay(t *testing.T) {
+	dir := t.TempDir()
+	voters, polls, votes := openJournal(t, dir).Stores()
+
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(1)))
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(2)))
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(3)))
+	_, err := voters.UpdateVoter(ctx, testutils.NewRandVoter(1), 1, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, voters.DeleteVoter(ctx, 3, 0))
+	assert.Nil(t, polls.AddPoll(ctx, testutils.NewRandPoll(1, 1, 2)))
+	assert.Nil(t, polls.AddPoll(ctx, testutils.NewRandPoll(2, 1)))
+	assert.Nil(t, polls.DeletePollOption(ctx, 1, 2))
+	assert.Nil(t, polls.DeletePoll(ctx, 2))
+	_, err = votes.CastVote(ctx, db.Vote{VoterId: 1, PollId: 1, OptionId: 1})
+	assert.Nil(t, err)
+	votes.DeleteAllVotes(ctx)
+	_, err = votes.CastVote(ctx, db.Vote{VoterId: 2, PollId: 1, OptionId: 1})
+	assert.Nil(t, err)
+
+	// failed writes are not logged
+	assert.NotNil(t, voters.AddVoter(ctx, testutils.NewRandVoter(1)))
+
+	// the journal is not closed so all of it comes from the log
+	reopened := openJournal(t, dir)
+	defer reopened.Close()
+	replayedVoters, replayedPolls, replayedVotes := reopened.Stores()
+
+	assert.ElementsMatch(t, voters.GetAllVoters(ctx), replayedVoters.GetAllVoters(ctx))
+	assert.Equal(t, polls.GetAllPolls(ctx), replayedPolls.GetAllPolls(ctx))
+	assert.Equal(t, votes.GetAllVotes(ctx), replayedVotes.GetAllVotes(ctx))
+
+	tally, err := replayedVotes.GetTally(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, tally.Total)
+
+	// vote ids keep counting up past the deleted votes
+	assert.Nil(t, replayedVoters.AddVoter(ctx, testutils.NewRandVoter(4)))
+	vote, err := replayedVotes.CastVote(ctx, db.Vote{VoterId: 4, PollId: 1, OptionId: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, uint(3), vote.VoteId)
+}
+
+func TestJournalTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	voters, _, _ := openJournal(t, dir).Stores()
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(1)))
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(2)))
+
+	logPath := filepath.Join(dir, db.JournalLogFile)
+	whole, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatalf("failed to stat log: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{"Torn", `1a2b3c4d {"seq":3,"op":"putVoter","voter":{"voterId":`},
+		{"BadChecksum", `00000000 {"seq":3,"op":"deleteVoter","id":1}` + "\n"},
+		{"NoChecksum", `{"seq":3,"op":"deleteVoter","id":1}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				t.Fatalf("failed to open log: %v", err)
+			}
+			log.WriteString(tt.tail)
+			log.Close()
+
+			replayed, _, _ := openJournal(t, dir).Stores()
+			assert.ElementsMatch(t, voters.GetAllVoters(ctx), replayed.GetAllVoters(ctx))
+
+			// the damaged tail is cut off so later records are not lost behind it
+			info, err := os.Stat(logPath)
+			assert.Nil(t, err)
+			assert.Equal(t, whole.Size(), info.Size())
+		})
+	}
+
+	replayed, _, _ := openJournal(t, dir).Stores()
+	assert.Nil(t, replayed.DeleteVoter(ctx, 1, 0))
+	replayed, _, _ = openJournal(t, dir).Stores()
+	_, err = replayed.GetVoter(ctx, 1)
+	assert.ErrorIs(t, err, db.ErrVoterNotFound)
+}
+
+func TestJournalSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	journal := openJournal(t, dir)
+	voters, _, _ := journal.Stores()
+
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(1)))
+	assert.Nil(t, journal.Snapshot())
+
+	info, err := os.Stat(filepath.Join(dir, db.JournalLogFile))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+
+	// writes after the snapshot are replayed on top of it, a snapshot that
+	// was being written when the process died is thrown away
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(2)))
+	assert.Nil(t, voters.DeleteVoter(ctx, 1, 0))
+	tmpPath := filepath.Join(dir, db.JournalSnapshotFile+".tmp")
+	assert.Nil(t, os.WriteFile(tmpPath, []byte(`{"seq":`), 0o644))
+
+	reopened := openJournal(t, dir)
+	replayed, _, _ := reopened.Stores()
+	assert.ElementsMatch(t, voters.GetAllVoters(ctx), replayed.GetAllVoters(ctx))
+	_, err = os.Stat(tmpPath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// closing compacts the log and refuses later writes
+	assert.Nil(t, reopened.Close())
+	assert.Nil(t, reopened.Close())
+	assert.NotNil(t, replayed.AddVoter(ctx, testutils.NewRandVoter(3)))
+	info, err = os.Stat(filepath.Join(dir, db.JournalLogFile))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+
+	replayed, _, _ = openJournal(t, dir).Stores()
+	assert.ElementsMatch(t, voters.GetAllVoters(ctx), replayed.GetAllVoters(ctx))
+}
+
+// TestJournalSurvivesKill kills a process that is adding voters and checks
+// every voter it was told had been added is there after a restart
+func TestJournalSurvivesKill(t *testing.T) {
+	if dir := os.Getenv(crashDirEnv); dir != "" {
+		writeUntilKilled(dir)
+		return
+	}
+	if testing.Short() {
+		t.Skip("starts a process to kill")
+	}
+
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestJournalSurvivesKill$")
+	cmd.Env = append(os.Environ(), crashDirEnv+"="+dir)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("failed to pipe writer output: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start writer: %v", err)
+	}
+
+	var acknowledged []uint
+	scanner := bufio.NewScanner(stdout)
+	for len(acknowledged) < 300 && scanner.Scan() {
+		voterId, err := strconv.ParseUint(scanner.Text(), 10, 64)
+		if err != nil {
+			continue
+		}
+		acknowledged = append(acknowledged, uint(voterId))
+	}
+	cmd.Process.Signal(syscall.SIGKILL)
+	cmd.Wait()
+
+	if len(acknowledged) < 300 {
+		t.Fatalf("writer stopped after %d voters", len(acknowledged))
+	}
+
+	voters, _, _ := openJournal(t, dir).Stores()
+	for _, voterId := range acknowledged {
+		voter, err := voters.GetVoter(ctx, voterId)
+		assert.Nil(t, err, "voter %d", voterId)
+		assert.Equal(t, voterId, voter.VoterId)
+	}
+}
+
+func writeUntilKilled(dir string) {
+	journal, err := db.OpenJournal(dir, db.FsyncAlways)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	voters, _, _ := journal.Stores()
+
+	for voterId := uint(1); ; voterId++ {
+		if err := voters.AddVoter(ctx, testutils.NewRandVoter(voterId)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(voterId)
+	}
+}
+
+func TestJournalConcurrentClose(t *testing.T) {
+	journal := openJournal(t, t.TempDir())
+	voters, _, _ := journal.Stores()
+	assert.Nil(t, voters.AddVoter(ctx, testutils.NewRandVoter(1)))
+
+	// the shutdown and a deferred Close may race, both see it closed once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, journal.Close())
+		}()
+	}
+	wg.Wait()
+
+	assert.NotNil(t, voters.AddVoter(ctx, testutils.NewRandVoter(2)))
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// StoreObserver is told about every call of the stores ObserveStores wraps
+// with the ctx it was made with, store is voters, polls or votes and
+// operation the method called. It is called from many goroutines at once.
+type StoreObserver func(ctx context.Context, store string, operation string, took time.Duration, err error)
+
+// ObserveStores times every call of the stores and passes it to observe
+func ObserveStores(voters VoterStore, polls PollStore, votes VoteStore, observe StoreObserver) (VoterStore, PollStore, VoteStore) {
+	return observedVoters{store: voters, observe: observe},
+		observedPolls{store: polls, observe: observe},
+		observedVotes{store: votes, observe: observe}
+}
+
+// since reports the call that started at start, called deferred with a
+// pointer to the named error of the method
+func (observe StoreObserver) since(ctx context.Context, store string, operation string, start time.Time, err *error) {
+	observe(ctx, store, operation, time.Since(start), *err)
+}
+
+type observedVoters struct {
+	store   VoterStore
+	observe StoreObserver
+}
+
+func (o observedVoters) AddVoter(ctx context.Context, voter Voter) (err error) {
+	defer o.observe.since(ctx, "voters", "AddVoter", time.Now(), &err)
+	return o.store.AddVoter(ctx, voter)
+}
+
+func (o observedVoters) GetVoter(ctx context.Context, voterId uint) (_ Voter, err error) {
+	defer o.observe.since(ctx, "voters", "GetVoter", time.Now(), &err)
+	return o.store.GetVoter(ctx, voterId)
+}
+
+func (o observedVoters) GetAllVoters(ctx context.Context) []Voter {
+	var err error
+	defer o.observe.since(ctx, "voters", "GetAllVoters", time.Now(), &err)
+	return o.store.GetAllVoters(ctx)
+}
+
+func (o observedVoters) QueryVoters(ctx context.Context, query VoterQuery) (_ VoterPage, err error) {
+	defer o.observe.since(ctx, "voters", "QueryVoters", time.Now(), &err)
+	return o.store.QueryVoters(ctx, query)
+}
+
+func (o observedVoters) CountVoters(ctx context.Context) (_ int, err error) {
+	defer o.observe.since(ctx, "voters", "CountVoters", time.Now(), &err)
+	return o.store.CountVoters(ctx)
+}
+
+func (o observedVoters) DeleteAllVoters(ctx context.Context) {
+	var err error
+	defer o.observe.since(ctx, "voters", "DeleteAllVoters", time.Now(), &err)
+	o.store.DeleteAllVoters(ctx)
+}
+
+func (o observedVoters) UpdateVoter(ctx context.Context, voter Voter, voterId uint, ifRevision uint64) (_ Voter, err error) {
+	defer o.observe.since(ctx, "voters", "UpdateVoter", time.Now(), &err)
+	return o.store.UpdateVoter(ctx, voter, voterId, ifRevision)
+}
+
+func (o observedVoters) PatchVoter(ctx context.Context, voterId uint, ifRevision uint64, patch VoterPatch) (_ Voter, err error) {
+	defer o.observe.since(ctx, "voters", "PatchVoter", time.Now(), &err)
+	return o.store.PatchVoter(ctx, voterId, ifRevision, patch)
+}
+
+func (o observedVoters) DeleteVoter(ctx context.Context, voterId uint, ifRevision uint64) (err error) {
+	defer o.observe.since(ctx, "voters", "DeleteVoter", time.Now(), &err)
+	return o.store.DeleteVoter(ctx, voterId, ifRevision)
+}
+
+func (o observedVoters) GetVoterPolls(ctx context.Context, voterId uint) (_ []VoterHistory, err error) {
+	defer o.observe.since(ctx, "voters", "GetVoterPolls", time.Now(), &err)
+	return o.store.GetVoterPolls(ctx, voterId)
+}
+
+func (o observedVoters) AddVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint) (err error) {
+	defer o.observe.since(ctx, "voters", "AddVoterPoll", time.Now(), &err)
+	return o.store.AddVoterPoll(ctx, voterPoll, voterId)
+}
+
+func (o observedVoters) GetVoterPoll(ctx context.Context, voterId uint, pollId uint) (_ VoterHistory, err error) {
+	defer o.observe.since(ctx, "voters", "GetVoterPoll", time.Now(), &err)
+	return o.store.GetVoterPoll(ctx, voterId, pollId)
+}
+
+func (o observedVoters) UpdateVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint, pollId uint) (err error) {
+	defer o.observe.since(ctx, "voters", "UpdateVoterPoll", time.Now(), &err)
+	return o.store.UpdateVoterPoll(ctx, voterPoll, voterId, pollId)
+}
+
+func (o observedVoters) DeleteVoterPoll(ctx context.Context, voterId uint, pollId uint) (err error) {
+	defer o.observe.since(ctx, "voters", "DeleteVoterPoll", time.Now(), &err)
+	return o.store.DeleteVoterPoll(ctx, voterId, pollId)
+}
+
+type observedPolls struct {
+	store   PollStore
+	observe StoreObserver
+}
+
+func (o observedPolls) AddPoll(ctx context.Context, poll Poll) (err error) {
+	defer o.observe.since(ctx, "polls", "AddPoll", time.Now(), &err)
+	return o.store.AddPoll(ctx, poll)
+}
+
+func (o observedPolls) GetPoll(ctx context.Context, pollId uint) (_ Poll, err error) {
+	defer o.observe.since(ctx, "polls", "GetPoll", time.Now(), &err)
+	return o.store.GetPoll(ctx, pollId)
+}
+
+func (o observedPolls) GetAllPolls(ctx context.Context) []Poll {
+	var err error
+	defer o.observe.since(ctx, "polls", "GetAllPolls", time.Now(), &err)
+	return o.store.GetAllPolls(ctx)
+}
+
+func (o observedPolls) DeleteAllPolls(ctx context.Context) {
+	var err error
+	defer o.observe.since(ctx, "polls", "DeleteAllPolls", time.Now(), &err)
+	o.store.DeleteAllPolls(ctx)
+}
+
+func (o observedPolls) UpdatePoll(ctx context.Context, poll Poll, pollId uint) (err error) {
+	defer o.observe.since(ctx, "polls", "UpdatePoll", time.Now(), &err)
+	return o.store.UpdatePoll(ctx, poll, pollId)
+}
+
+func (o observedPolls) DeletePoll(ctx context.Context, pollId uint) (err error) {
+	defer o.observe.since(ctx, "polls", "DeletePoll", time.Now(), &err)
+	return o.store.DeletePoll(ctx, pollId)
+}
+
+func (o observedPolls) GetPollOptions(ctx context.Context, pollId uint) (_ []PollOption, err error) {
+	defer o.observe.since(ctx, "polls", "GetPollOptions", time.Now(), &err)
+	return o.store.GetPollOptions(ctx, pollId)
+}
+
+func (o observedPolls) AddPollOption(ctx context.Context, option PollOption, pollId uint) (err error) {
+	defer o.observe.since(ctx, "polls", "AddPollOption", time.Now(), &err)
+	return o.store.AddPollOption(ctx, option, pollId)
+}
+
+func (o observedPolls) GetPollOption(ctx context.Context, pollId uint, optionId uint) (_ PollOption, err error) {
+	defer o.observe.since(ctx, "polls", "GetPollOption", time.Now(), &err)
+	return o.store.GetPollOption(ctx, pollId, optionId)
+}
+
+func (o observedPolls) DeletePollOption(ctx context.Context, pollId uint, optionId uint) (err error) {
+	defer o.observe.since(ctx, "polls", "DeletePollOption", time.Now(), &err)
+	return o.store.DeletePollOption(ctx, pollId, optionId)
+}
+
+type observedVotes struct {
+	store   VoteStore
+	observe StoreObserver
+}
+
+func (o observedVotes) CastVote(ctx context.Context, vote Vote) (_ Vote, err error) {
+	defer o.observe.since(ctx, "votes", "CastVote", time.Now(), &err)
+	return o.store.CastVote(ctx, vote)
+}
+
+func (o observedVotes) GetVote(ctx context.Context, voteId uint) (_ Vote, err error) {
+	defer o.observe.since(ctx, "votes", "GetVote", time.Now(), &err)
+	return o.store.GetVote(ctx, voteId)
+}
+
+func (o observedVotes) GetAllVotes(ctx context.Context) []Vote {
+	var err error
+	defer o.observe.since(ctx, "votes", "GetAllVotes", time.Now(), &err)
+	return o.store.GetAllVotes(ctx)
+}
+
+func (o observedVotes) CountVotes(ctx context.Context) (_ int, err error) {
+	defer o.observe.since(ctx, "votes", "CountVotes", time.Now(), &err)
+	return o.store.CountVotes(ctx)
+}
+
+func (o observedVotes) DeleteAllVotes(ctx context.Context) {
+	var err error
+	defer o.observe.since(ctx, "votes", "DeleteAllVotes", time.Now(), &err)
+	o.store.DeleteAllVotes(ctx)
+}
+
+func (o observedVotes) GetTally(ctx context.Context, pollId uint) (_ Tally, err error) {
+	defer o.observe.since(ctx, "votes", "GetTally", time.Now(), &err)
+	return o.store.GetTally(ctx, pollId)
+}
+
+func (o observedVotes) RebuildTallies(ctx context.Context) (_ []TallyDrift, err error) {
+	defer o.observe.since(ctx, "votes", "RebuildTallies", time.Now(), &err)
+	return o.store.RebuildTallies(ctx)
+}
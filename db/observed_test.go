@@ -0,0 +1,87 @@
+package db_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// observedCall is a store call reported to a StoreObserver
+type observedCall struct {
+	ctx       context.Context
+	store     string
+	operation string
+	err       error
+}
+
+// callRecorder is a StoreObserver that keeps the calls it is told about
+type callRecorder struct {
+	calls []observedCall
+	mu    sync.Mutex
+}
+
+func (r *callRecorder) observe(ctx context.Context, store string, operation string, took time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, observedCall{ctx: ctx, store: store, operation: operation, err: err})
+}
+
+// newObservedStores returns empty in-memory stores wrapped by ObserveStores
+func newObservedStores(t *testing.T, observe db.StoreObserver) (db.VoterStore, db.PollStore, db.VoteStore) {
+	voterList, err := db.New()
+	if err != nil {
+		t.Fatalf("failed to create voter list: %v", err)
+	}
+	pollList, err := db.NewPollList(voterList)
+	if err != nil {
+		t.Fatalf("failed to create poll list: %v", err)
+	}
+	voteList, err := db.NewVoteList(voterList)
+	if err != nil {
+		t.Fatalf("failed to create vote list: %v", err)
+	}
+	return db.ObserveStores(voterList, pollList, voteList, observe)
+}
+
+func ignoreStoreCalls(context.Context, string, string, time.Duration, error) {}
+
+func TestObservedStoresConformance(t *testing.T) {
+	testutils.RunVoterStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore) {
+		voters, polls, _ := newObservedStores(t, ignoreStoreCalls)
+		return voters, polls
+	})
+	testutils.RunPollStoreConformance(t, func(t *testing.T) db.PollStore {
+		_, polls, _ := newObservedStores(t, ignoreStoreCalls)
+		return polls
+	})
+	testutils.RunVoteStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore, db.VoteStore) {
+		return newObservedStores(t, ignoreStoreCalls)
+	})
+}
+
+func TestObservedStoresReportCalls(t *testing.T) {
+	recorder := &callRecorder{}
+	voters, polls, votes := newObservedStores(t, recorder.observe)
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	assert.Nil(t, voters.AddVoter(callCtx, testutils.NewRandVoter(1)))
+	_, err := voters.GetVoter(callCtx, 2)
+	assert.ErrorIs(t, err, db.ErrVoterNotFound)
+	polls.GetAllPolls(callCtx)
+	count, err := votes.CountVotes(callCtx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	assert.Equal(t, []observedCall{
+		{ctx: callCtx, store: "voters", operation: "AddVoter"},
+		{ctx: callCtx, store: "voters", operation: "GetVoter", err: db.ErrVoterNotFound},
+		{ctx: callCtx, store: "polls", operation: "GetAllPolls"},
+		{ctx: callCtx, store: "votes", operation: "CountVotes"},
+	}, recorder.calls)
+}
@@ -0,0 +1,251 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// PollOption and Poll are checked against the rules in their validate tags,
+// see validation.go
+type PollOption struct {
+	OptionId uint   `json:"optionId" validate:"required"`
+	Text     string `json:"text" validate:"required,max=200"`
+}
+
+type Poll struct {
+	PollId   uint         `json:"pollId" validate:"required"`
+	Title    string       `json:"title" validate:"required,max=200"`
+	Question string       `json:"question" validate:"required,max=1000"`
+	Options  []PollOption `json:"options,omitempty"`
+}
+
+// PollStore is implemented by every poll backend, it lives alongside the
+// VoterStore of the same backend
+type PollStore interface {
+	AddPoll(ctx context.Context, poll Poll) error
+	GetPoll(ctx context.Context, pollId uint) (Poll, error)
+	GetAllPolls(ctx context.Context) []Poll
+	DeleteAllPolls(ctx context.Context)
+	UpdatePoll(ctx context.Context, poll Poll, pollId uint) error
+	DeletePoll(ctx context.Context, pollId uint) error
+	GetPollOptions(ctx context.Context, pollId uint) ([]PollOption, error)
+	AddPollOption(ctx context.Context, option PollOption, pollId uint) error
+	GetPollOption(ctx context.Context, pollId uint, optionId uint) (PollOption, error)
+	DeletePollOption(ctx context.Context, pollId uint, optionId uint) error
+}
+
+// PollList is the in-memory PollStore, it is safe for concurrent use
+type PollList struct {
+	Polls map[uint]Poll //A map of PollIDs as keys and Poll structs as values
+	mu    sync.RWMutex
+}
+
+var _ PollStore = (*PollList)(nil)
+
+// NewPollList returns an empty PollList. Given the VoterList it lives
+// alongside, vote history written to voters has to name one of its polls
+// from then on, a nil voters leaves the polls on their own.
+func NewPollList(voters *VoterList) (*PollList, error) {
+	polls := &PollList{
+		Polls: make(map[uint]Poll),
+	}
+	if voters != nil {
+		voters.polls = polls
+	}
+
+	return polls, nil
+}
+
+// checkPollOptions rejects a poll whose options repeat an optionId
+func checkPollOptions(poll Poll) error {
+	seen := make(map[uint]bool, len(poll.Options))
+	for _, option := range poll.Options {
+		if seen[option.OptionId] {
+			return ErrOptionExists
+		}
+		seen[option.OptionId] = true
+	}
+
+	return nil
+}
+
+func (p *PollList) AddPoll(ctx context.Context, poll Poll) error {
+	if err := poll.Validate(); err != nil {
+		return err
+	}
+	if err := checkPollOptions(poll); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.Polls[poll.PollId]
+	if ok {
+		return ErrPollExists
+	}
+
+	poll.Options = copyPollOptions(poll.Options)
+	p.Polls[poll.PollId] = poll
+	return nil
+}
+
+func (p *PollList) GetPoll(ctx context.Context, pollId uint) (Poll, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	poll, ok := p.Polls[pollId]
+	if !ok {
+		return Poll{}, ErrPollNotFound
+	}
+
+	poll.Options = copyPollOptions(poll.Options)
+	return poll, nil
+}
+
+// GetAllPolls returns polls ordered by pollId
+func (p *PollList) GetAllPolls(ctx context.Context) []Poll {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	pollList := []Poll{}
+	for _, poll := range p.Polls {
+		poll.Options = copyPollOptions(poll.Options)
+		pollList = append(pollList, poll)
+	}
+
+	sort.Slice(pollList, func(i, j int) bool {
+		return pollList[i].PollId < pollList[j].PollId
+	})
+	return pollList
+}
+
+func (p *PollList) DeleteAllPolls(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Polls = make(map[uint]Poll)
+}
+
+// UpdatePoll updates title and question of the poll, options are managed
+// through AddPollOption and DeletePollOption
+func (p *PollList) UpdatePoll(ctx context.Context, poll Poll, pollId uint) error {
+	if err := poll.validateUpdate(pollId); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	updatedPoll, ok := p.Polls[pollId]
+	if !ok {
+		return ErrPollNotFound
+	}
+
+	updatedPoll.Title = poll.Title
+	updatedPoll.Question = poll.Question
+
+	p.Polls[pollId] = updatedPoll
+	return nil
+}
+
+func (p *PollList) DeletePoll(ctx context.Context, pollId uint) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.Polls[pollId]
+	if !ok {
+		return ErrPollNotFound
+	}
+
+	delete(p.Polls, pollId)
+	return nil
+}
+
+func (p *PollList) GetPollOptions(ctx context.Context, pollId uint) ([]PollOption, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	poll, ok := p.Polls[pollId]
+	if !ok {
+		return nil, ErrPollNotFound
+	}
+
+	return copyPollOptions(poll.Options), nil
+}
+
+func (p *PollList) AddPollOption(ctx context.Context, option PollOption, pollId uint) error {
+	if err := option.Validate(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	poll, ok := p.Polls[pollId]
+	if !ok {
+		return ErrPollNotFound
+	}
+
+	for _, po := range poll.Options {
+		if po.OptionId == option.OptionId {
+			return ErrOptionExists
+		}
+	}
+
+	poll.Options = append(poll.Options, option)
+
+	p.Polls[pollId] = poll
+	return nil
+}
+
+func (p *PollList) GetPollOption(ctx context.Context, pollId uint, optionId uint) (PollOption, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	poll, ok := p.Polls[pollId]
+	if !ok {
+		return PollOption{}, ErrPollNotFound
+	}
+
+	for _, po := range poll.Options {
+		if po.OptionId == optionId {
+			return po, nil
+		}
+	}
+
+	return PollOption{}, ErrOptionNotFound
+}
+
+func (p *PollList) DeletePollOption(ctx context.Context, pollId uint, optionId uint) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	poll, ok := p.Polls[pollId]
+	if !ok {
+		return ErrPollNotFound
+	}
+
+	for i, po := range poll.Options {
+		if po.OptionId == optionId {
+			poll.Options = append(poll.Options[:i], poll.Options[i+1:]...)
+			p.Polls[pollId] = poll
+			return nil
+		}
+	}
+
+	return ErrOptionNotFound
+}
+
+// copyPollOptions returns a copy of options that does not share its backing
+// array, nil stays nil
+func copyPollOptions(options []PollOption) []PollOption {
+	if options == nil {
+		return nil
+	}
+
+	optionsCopy := make([]PollOption, len(options))
+	copy(optionsCopy, options)
+	return optionsCopy
+}
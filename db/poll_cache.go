@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	RedisPollKeyPrefix = "poll:"
+	// RedisPollIndexKey is a sorted set of every stored pollId scored by the
+	// id itself, it must not match RedisPollKeyPrefix
+	RedisPollIndexKey = "polls"
+)
+
+// PollCache is the PollStore backed by Redis, polls are kept as ReJSON
+// documents under poll:<id>
+type PollCache struct {
+	//Redis cache connections
+	cache
+}
+
+var _ PollStore = (*PollCache)(nil)
+
+// NewPollCache returns the PollStore sharing the redis connection of
+// voterCache, vote history written to voterCache has to name one of its
+// polls from then on
+func NewPollCache(voterCache *VoterCache) *PollCache {
+	voterCache.requirePolls = true
+	return &PollCache{cache: voterCache.cache}
+}
+
+func redisPollKeyFromId(id uint) string {
+	return fmt.Sprintf("%s%d", RedisPollKeyPrefix, id)
+}
+
+func (p *PollCache) updatePollInRedis(ctx context.Context, pollId uint, update func(poll *Poll) error) error {
+	return updateInRedis(ctx, &p.cache, redisPollKeyFromId(pollId), ErrPollNotFound, update)
+}
+
+func (p *PollCache) AddPoll(ctx context.Context, poll Poll) error {
+	if err := poll.Validate(); err != nil {
+		return err
+	}
+	if err := checkPollOptions(poll); err != nil {
+		return err
+	}
+
+	document, err := json.Marshal(poll)
+	if err != nil {
+		return err
+	}
+
+	//NX makes the existence check and the write a single atomic command
+	var setCmd *redis.Cmd
+	_, err = p.cacheClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		setCmd = pipe.Do(ctx, "JSON.SET", redisPollKeyFromId(poll.PollId), ".", string(document), "NX")
+		pipe.ZAdd(ctx, RedisPollIndexKey, redis.Z{Score: float64(poll.PollId), Member: poll.PollId})
+		return nil
+	})
+	if errors.Is(setCmd.Err(), redis.Nil) {
+		return ErrPollExists
+	}
+
+	return err
+}
+
+func (p *PollCache) GetPoll(ctx context.Context, pollId uint) (Poll, error) {
+	itemObject, err := p.json(ctx).JSONGet(redisPollKeyFromId(pollId), ".")
+	if errors.Is(err, redis.Nil) {
+		return Poll{}, ErrPollNotFound
+	}
+	if err != nil {
+		return Poll{}, err
+	}
+
+	var poll Poll
+	if err := json.Unmarshal(itemObject.([]byte), &poll); err != nil {
+		return Poll{}, err
+	}
+
+	return poll, nil
+}
+
+// GetAllPolls returns polls ordered by pollId, there are few enough polls
+// to fetch them with a single JSON.MGET
+func (p *PollCache) GetAllPolls(ctx context.Context) []Poll {
+	polls, err := p.allPolls(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "getting polls from redis failed", "err", err)
+	}
+
+	return polls
+}
+
+// allPolls returns the polls read so far with the error that stopped it, a
+// poll that can not be decoded is skipped
+func (p *PollCache) allPolls(ctx context.Context) ([]Poll, error) {
+	pollIds, err := p.cacheClient.ZRange(ctx, RedisPollIndexKey, 0, -1).Result()
+	if err != nil {
+		return []Poll{}, err
+	}
+
+	return p.getPollsFromRedis(ctx, pollIds)
+}
+
+// getPollsFromRedis reads the polls of pollIds in one round trip, polls
+// that do not exist are left out
+func (p *PollCache) getPollsFromRedis(ctx context.Context, pollIds []string) ([]Poll, error) {
+	polls := []Poll{}
+	if len(pollIds) == 0 {
+		return polls, nil
+	}
+
+	keys := make([]string, len(pollIds))
+	for i, pollId := range pollIds {
+		keys[i] = RedisPollKeyPrefix + pollId
+	}
+
+	items, err := p.json(ctx).JSONMGet(".", keys...)
+	if err != nil {
+		return polls, err
+	}
+
+	for _, item := range items.([]interface{}) {
+		if item == nil {
+			continue
+		}
+		var poll Poll
+		if err := json.Unmarshal(item.([]byte), &poll); err != nil {
+			slog.ErrorContext(ctx, "getting polls from redis failed", "err", err)
+			continue
+		}
+		polls = append(polls, poll)
+	}
+
+	return polls, nil
+}
+
+func (p *PollCache) DeleteAllPolls(ctx context.Context) {
+	pollIds, err := p.cacheClient.ZRange(ctx, RedisPollIndexKey, 0, -1).Result()
+	if err != nil {
+		slog.ErrorContext(ctx, "getting poll index from redis failed", "err", err)
+		return
+	}
+
+	keys := []string{RedisPollIndexKey}
+	for _, pollId := range pollIds {
+		keys = append(keys, RedisPollKeyPrefix+pollId)
+	}
+
+	if err := p.cacheClient.Del(ctx, keys...).Err(); err != nil {
+		slog.ErrorContext(ctx, "deleting polls from redis failed", "err", err)
+	}
+}
+
+// UpdatePoll updates title and question of the poll, options are managed
+// through AddPollOption and DeletePollOption
+func (p *PollCache) UpdatePoll(ctx context.Context, poll Poll, pollId uint) error {
+	if err := poll.validateUpdate(pollId); err != nil {
+		return err
+	}
+
+	return p.updatePollInRedis(ctx, pollId, func(existingPoll *Poll) error {
+		existingPoll.Title = poll.Title
+		existingPoll.Question = poll.Question
+		return nil
+	})
+}
+
+func (p *PollCache) DeletePoll(ctx context.Context, pollId uint) error {
+	//DEL reports how many keys it removed, zero means the poll was missing
+	var delCmd *redis.IntCmd
+	_, err := p.cacheClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		delCmd = pipe.Del(ctx, redisPollKeyFromId(pollId))
+		pipe.ZRem(ctx, RedisPollIndexKey, pollId)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if delCmd.Val() == 0 {
+		return ErrPollNotFound
+	}
+
+	return nil
+}
+
+func (p *PollCache) GetPollOptions(ctx context.Context, pollId uint) ([]PollOption, error) {
+	poll, err := p.GetPoll(ctx, pollId)
+	if err != nil {
+		return nil, err
+	}
+
+	return poll.Options, nil
+}
+
+func (p *PollCache) AddPollOption(ctx context.Context, option PollOption, pollId uint) error {
+	if err := option.Validate(); err != nil {
+		return err
+	}
+
+	return p.updatePollInRedis(ctx, pollId, func(poll *Poll) error {
+		for _, po := range poll.Options {
+			if po.OptionId == option.OptionId {
+				return ErrOptionExists
+			}
+		}
+
+		poll.Options = append(poll.Options, option)
+		return nil
+	})
+}
+
+func (p *PollCache) GetPollOption(ctx context.Context, pollId uint, optionId uint) (PollOption, error) {
+	poll, err := p.GetPoll(ctx, pollId)
+	if err != nil {
+		return PollOption{}, err
+	}
+
+	for _, po := range poll.Options {
+		if po.OptionId == optionId {
+			return po, nil
+		}
+	}
+
+	return PollOption{}, ErrOptionNotFound
+}
+
+func (p *PollCache) DeletePollOption(ctx context.Context, pollId uint, optionId uint) error {
+	return p.updatePollInRedis(ctx, pollId, func(poll *Poll) error {
+		for i, po := range poll.Options {
+			if po.OptionId == optionId {
+				poll.Options = append(poll.Options[:i], poll.Options[i+1:]...)
+				return nil
+			}
+		}
+
+		return ErrOptionNotFound
+	})
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+)
+
+// PollSQL is the PollStore backed by SQLite, polls and their options are
+// kept in the polls and poll_options tables
+type PollSQL struct {
+	sqlStore
+}
+
+var _ PollStore = (*PollSQL)(nil)
+
+// NewPollSQL returns the PollStore sharing the database of voterSQL, vote
+// history written to voterSQL has to name one of its polls from then on
+func NewPollSQL(voterSQL *VoterSQL) *PollSQL {
+	voterSQL.requirePolls = true
+	return &PollSQL{sqlStore: voterSQL.sqlStore}
+}
+
+// getPollsFromSQL reads the polls selected by where, ordered by pollId,
+// together with their options
+func getPollsFromSQL(ctx context.Context, q sqlQuerier, where string, args ...any) ([]Poll, error) {
+	rows, err := q.QueryContext(ctx, `SELECT poll_id, title, question FROM polls `+where+` ORDER BY poll_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	polls := []Poll{}
+	positions := map[uint]int{}
+	for rows.Next() {
+		var poll Poll
+		if err := rows.Scan(&poll.PollId, &poll.Title, &poll.Question); err != nil {
+			return nil, err
+		}
+		positions[poll.PollId] = len(polls)
+		polls = append(polls, poll)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(polls) == 0 {
+		return polls, nil
+	}
+
+	rows, err = q.QueryContext(ctx, `SELECT poll_id, option_id, text FROM poll_options
+		WHERE poll_id IN (SELECT poll_id FROM polls `+where+`) ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pollId uint
+		var option PollOption
+		if err := rows.Scan(&pollId, &option.OptionId, &option.Text); err != nil {
+			return nil, err
+		}
+
+		poll := &polls[positions[pollId]]
+		poll.Options = append(poll.Options, option)
+	}
+
+	return polls, rows.Err()
+}
+
+// insertPollOption adds an option, the unique (poll_id, option_id)
+// constraint refuses one the poll already has
+func insertPollOption(ctx context.Context, tx *sql.Tx, pollId uint, option PollOption) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO poll_options (poll_id, option_id, text) VALUES (?, ?, ?)`,
+		pollId, option.OptionId, option.Text)
+	if isSQLConflict(err) {
+		return ErrOptionExists
+	}
+	return err
+}
+
+// checkPollInSQL fails with ErrPollNotFound for a poll that is not stored
+func checkPollInSQL(ctx context.Context, q sqlQuerier, pollId uint) error {
+	var found int
+	err := q.QueryRowContext(ctx, `SELECT 1 FROM polls WHERE poll_id = ?`, pollId).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPollNotFound
+	}
+	return err
+}
+
+// checkPollOptionInSQL is checkPollInSQL that also fails with
+// ErrOptionNotFound when the poll does not have optionId
+func checkPollOptionInSQL(ctx context.Context, q sqlQuerier, pollId uint, optionId uint) error {
+	if err := checkPollInSQL(ctx, q, pollId); err != nil {
+		return err
+	}
+
+	var found int
+	err := q.QueryRowContext(ctx, `SELECT 1 FROM poll_options WHERE poll_id = ? AND option_id = ?`, pollId, optionId).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrOptionNotFound
+	}
+	return err
+}
+
+func (p *PollSQL) AddPoll(ctx context.Context, poll Poll) error {
+	if err := poll.Validate(); err != nil {
+		return err
+	}
+
+	return inSQLTx(ctx, p.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO polls (poll_id, title, question) VALUES (?, ?, ?)`,
+			poll.PollId, poll.Title, poll.Question)
+		if isSQLConflict(err) {
+			return ErrPollExists
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, option := range poll.Options {
+			if err := insertPollOption(ctx, tx, poll.PollId, option); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *PollSQL) GetPoll(ctx context.Context, pollId uint) (Poll, error) {
+	polls, err := getPollsFromSQL(ctx, p.db, `WHERE poll_id = ?`, pollId)
+	if err != nil {
+		return Poll{}, err
+	}
+	if len(polls) == 0 {
+		return Poll{}, ErrPollNotFound
+	}
+
+	return polls[0], nil
+}
+
+// GetAllPolls returns polls ordered by pollId
+func (p *PollSQL) GetAllPolls(ctx context.Context) []Poll {
+	polls, err := getPollsFromSQL(ctx, p.db, "")
+	if err != nil {
+		slog.ErrorContext(ctx, "getting polls from sqlite failed", "err", err)
+		return []Poll{}
+	}
+
+	return polls
+}
+
+// DeleteAllPolls takes their options with them
+func (p *PollSQL) DeleteAllPolls(ctx context.Context) {
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM polls`); err != nil {
+		slog.ErrorContext(ctx, "deleting polls from sqlite failed", "err", err)
+	}
+}
+
+// UpdatePoll updates title and question of the poll, options are managed
+// through AddPollOption and DeletePollOption
+func (p *PollSQL) UpdatePoll(ctx context.Context, poll Poll, pollId uint) error {
+	if err := poll.validateUpdate(pollId); err != nil {
+		return err
+	}
+
+	result, err := p.db.ExecContext(ctx, `UPDATE polls SET title = ?, question = ? WHERE poll_id = ?`,
+		poll.Title, poll.Question, pollId)
+	if err != nil {
+		return err
+	}
+
+	return sqlRowsAffected(result, ErrPollNotFound)
+}
+
+func (p *PollSQL) DeletePoll(ctx context.Context, pollId uint) error {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM polls WHERE poll_id = ?`, pollId)
+	if err != nil {
+		return err
+	}
+
+	return sqlRowsAffected(result, ErrPollNotFound)
+}
+
+func (p *PollSQL) GetPollOptions(ctx context.Context, pollId uint) ([]PollOption, error) {
+	poll, err := p.GetPoll(ctx, pollId)
+	if err != nil {
+		return nil, err
+	}
+
+	return poll.Options, nil
+}
+
+func (p *PollSQL) AddPollOption(ctx context.Context, option PollOption, pollId uint) error {
+	if err := option.Validate(); err != nil {
+		return err
+	}
+
+	return inSQLTx(ctx, p.db, func(tx *sql.Tx) error {
+		if err := checkPollInSQL(ctx, tx, pollId); err != nil {
+			return err
+		}
+
+		return insertPollOption(ctx, tx, pollId, option)
+	})
+}
+
+func (p *PollSQL) GetPollOption(ctx context.Context, pollId uint, optionId uint) (PollOption, error) {
+	options, err := p.GetPollOptions(ctx, pollId)
+	if err != nil {
+		return PollOption{}, err
+	}
+
+	for _, po := range options {
+		if po.OptionId == optionId {
+			return po, nil
+		}
+	}
+
+	return PollOption{}, ErrOptionNotFound
+}
+
+func (p *PollSQL) DeletePollOption(ctx context.Context, pollId uint, optionId uint) error {
+	return inSQLTx(ctx, p.db, func(tx *sql.Tx) error {
+		if err := checkPollInSQL(ctx, tx, pollId); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM poll_options WHERE poll_id = ? AND option_id = ?`, pollId, optionId)
+		if err != nil {
+			return err
+		}
+		return sqlRowsAffected(result, ErrOptionNotFound)
+	})
+}
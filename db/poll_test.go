@@ -0,0 +1,53 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPollList(t *testing.T) {
+	pollList, err := db.NewPollList(nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, pollList)
+	assert.Equal(t, 0, len(pollList.Polls))
+}
+
+func TestPollListConformance(t *testing.T) {
+	testutils.RunPollStoreConformance(t, func(t *testing.T) db.PollStore {
+		pollList, err := db.NewPollList(nil)
+		if err != nil {
+			t.Fatalf("failed to create poll list: %v", err)
+		}
+		return pollList
+	})
+}
+
+func TestPollCacheConformance(t *testing.T) {
+	testutils.RunPollStoreConformance(t, func(t *testing.T) db.PollStore {
+		pollCache := db.NewPollCache(newTestVoterCache(t))
+		pollCache.DeleteAllPolls(ctx)
+		return pollCache
+	})
+}
+
+func TestPollListOptionsAreNotAliased(t *testing.T) {
+	pollList, _ := db.NewPollList(nil)
+
+	poll1 := testutils.NewRandPoll(1, 1)
+	pollList.AddPoll(ctx, poll1)
+	option := poll1.Options[0]
+
+	// changing slices handed in or out does not change the store
+	poll1.Options[0].Text += "changed"
+	poll, _ := pollList.GetPoll(ctx, poll1.PollId)
+	poll.Options[0].Text += "changed"
+	options, _ := pollList.GetPollOptions(ctx, poll1.PollId)
+	options[0].Text += "changed"
+
+	storedOption, err := pollList.GetPollOption(ctx, poll1.PollId, option.OptionId)
+	assert.Nil(t, err)
+	assert.Equal(t, option, storedOption)
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// sqlMigration moves the schema from version-1 to version. Migrations are
+// never edited once released, a change to the schema is a new migration.
+type sqlMigration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+var sqlMigrations = []sqlMigration{
+	{1, "voters and their vote history", []string{
+		`CREATE TABLE voters (
+			voter_id INTEGER PRIMARY KEY,
+			name     TEXT    NOT NULL,
+			email    TEXT    NOT NULL,
+			revision INTEGER NOT NULL
+		)`,
+		// seq keeps the order entries were added in
+		`CREATE TABLE vote_history (
+			seq       INTEGER PRIMARY KEY AUTOINCREMENT,
+			voter_id  INTEGER NOT NULL REFERENCES voters (voter_id) ON DELETE CASCADE,
+			poll_id   INTEGER NOT NULL,
+			vote_id   INTEGER NOT NULL,
+			vote_date TEXT    NOT NULL,
+			UNIQUE (voter_id, poll_id)
+		)`,
+		`CREATE INDEX vote_history_by_poll ON vote_history (poll_id)`,
+	}},
+	{2, "polls and their options", []string{
+		`CREATE TABLE polls (
+			poll_id  INTEGER PRIMARY KEY,
+			title    TEXT    NOT NULL,
+			question TEXT    NOT NULL
+		)`,
+		`CREATE TABLE poll_options (
+			seq       INTEGER PRIMARY KEY AUTOINCREMENT,
+			poll_id   INTEGER NOT NULL REFERENCES polls (poll_id) ON DELETE CASCADE,
+			option_id INTEGER NOT NULL,
+			text      TEXT    NOT NULL,
+			UNIQUE (poll_id, option_id)
+		)`,
+	}},
+	// AUTOINCREMENT keeps vote ids counting up after every vote is deleted
+	{3, "votes", []string{
+		`CREATE TABLE votes (
+			vote_id   INTEGER PRIMARY KEY AUTOINCREMENT,
+			voter_id  INTEGER NOT NULL,
+			poll_id   INTEGER NOT NULL,
+			option_id INTEGER NOT NULL,
+			value     TEXT    NOT NULL,
+			vote_date TEXT    NOT NULL
+		)`,
+		`CREATE INDEX votes_by_poll ON votes (poll_id, option_id)`,
+	}},
+	// the running count of votes per option, kept in step by CastVote and
+	// counted from the votes already cast
+	{4, "tallies", []string{
+		`CREATE TABLE tallies (
+			poll_id   INTEGER NOT NULL,
+			option_id INTEGER NOT NULL,
+			count     INTEGER NOT NULL,
+			PRIMARY KEY (poll_id, option_id)
+		)`,
+		`INSERT INTO tallies (poll_id, option_id, count)
+			SELECT poll_id, option_id, COUNT(*) FROM votes GROUP BY poll_id, option_id`,
+	}},
+}
+
+// migrateSQL applies the migrations the database has not seen yet, each in
+// its own transaction, and refuses a database written by a newer schema
+func migrateSQL(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	latest := sqlMigrations[len(sqlMigrations)-1].version
+	if current > latest {
+		return fmt.Errorf("database schema is at version %d, this build only knows up to %d", current, latest)
+	}
+
+	for _, migration := range sqlMigrations {
+		if migration.version <= current {
+			continue
+		}
+
+		err := inSQLTx(ctx, db, func(tx *sql.Tx) error {
+			for _, statement := range migration.statements {
+				if _, err := tx.ExecContext(ctx, statement); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+				migration.version, time.Now().UTC().Format(time.RFC3339))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migrating to schema version %d (%s): %w", migration.version, migration.description, err)
+		}
+	}
+
+	return nil
+}
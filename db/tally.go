@@ -0,0 +1,148 @@
+package db
+
+import (
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Tally is the running count of votes per optionId of a poll
+type Tally struct {
+	PollId uint         `json:"pollId"`
+	Counts map[uint]int `json:"counts"`
+	Total  int          `json:"total"`
+}
+
+// TallyDrift is a stored tally that did not match the one rebuilt from the
+// votes
+type TallyDrift struct {
+	PollId  uint  `json:"pollId"`
+	Stored  Tally `json:"stored"`
+	Rebuilt Tally `json:"rebuilt"`
+}
+
+type OptionResult struct {
+	OptionId   uint    `json:"optionId"`
+	Text       string  `json:"text"`
+	Votes      int     `json:"votes"`
+	Percentage float64 `json:"percentage"`
+}
+
+// PollResults is what GET /polls/:id/results reports, percentages and
+// turnout run from 0 to 100
+type PollResults struct {
+	PollId           uint           `json:"pollId"`
+	Title            string         `json:"title"`
+	Question         string         `json:"question"`
+	Options          []OptionResult `json:"options"`
+	TotalBallots     int            `json:"totalBallots"`
+	RegisteredVoters int            `json:"registeredVoters"`
+	Turnout          float64        `json:"turnout"`
+}
+
+func newTally(pollId uint) Tally {
+	return Tally{PollId: pollId, Counts: map[uint]int{}}
+}
+
+func (t *Tally) add(optionId uint, count int) {
+	t.Counts[optionId] += count
+	t.Total += count
+}
+
+// tallyVotes counts votes per poll from scratch
+func tallyVotes(votes []Vote) map[uint]Tally {
+	tallies := map[uint]Tally{}
+	for _, vote := range votes {
+		tally, ok := tallies[vote.PollId]
+		if !ok {
+			tally = newTally(vote.PollId)
+		}
+		tally.add(vote.OptionId, 1)
+		tallies[vote.PollId] = tally
+	}
+
+	return tallies
+}
+
+// compareTallies lists the polls whose stored tally differs from the rebuilt
+// one, ordered by pollId
+func compareTallies(stored map[uint]Tally, rebuilt map[uint]Tally) []TallyDrift {
+	pollIds := map[uint]bool{}
+	for pollId := range stored {
+		pollIds[pollId] = true
+	}
+	for pollId := range rebuilt {
+		pollIds[pollId] = true
+	}
+
+	drifts := []TallyDrift{}
+	for pollId := range pollIds {
+		storedTally, ok := stored[pollId]
+		if !ok {
+			storedTally = newTally(pollId)
+		}
+		rebuiltTally, ok := rebuilt[pollId]
+		if !ok {
+			rebuiltTally = newTally(pollId)
+		}
+		if !reflect.DeepEqual(storedTally, rebuiltTally) {
+			drifts = append(drifts, TallyDrift{PollId: pollId, Stored: storedTally, Rebuilt: rebuiltTally})
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].PollId < drifts[j].PollId
+	})
+	return drifts
+}
+
+// percentage of part in whole rounded to two decimals, zero when whole is
+func percentage(part int, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+
+	return math.Round(float64(part)*10000/float64(whole)) / 100
+}
+
+// NewPollResults lays the tally out over the options of the poll, votes for
+// options that were removed since are listed after them without text
+func NewPollResults(poll Poll, tally Tally, registeredVoters int) PollResults {
+	results := PollResults{
+		PollId:           poll.PollId,
+		Title:            poll.Title,
+		Question:         poll.Question,
+		Options:          []OptionResult{},
+		TotalBallots:     tally.Total,
+		RegisteredVoters: registeredVoters,
+		Turnout:          percentage(tally.Total, registeredVoters),
+	}
+
+	listed := map[uint]bool{}
+	for _, option := range poll.Options {
+		listed[option.OptionId] = true
+		results.Options = append(results.Options, OptionResult{
+			OptionId:   option.OptionId,
+			Text:       option.Text,
+			Votes:      tally.Counts[option.OptionId],
+			Percentage: percentage(tally.Counts[option.OptionId], tally.Total),
+		})
+	}
+
+	var removed []uint
+	for optionId := range tally.Counts {
+		if !listed[optionId] {
+			removed = append(removed, optionId)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i] < removed[j] })
+	for _, optionId := range removed {
+		results.Options = append(results.Options, OptionResult{
+			OptionId:   optionId,
+			Votes:      tally.Counts[optionId],
+			Percentage: percentage(tally.Counts[optionId], tally.Total),
+		})
+	}
+
+	return results
+}
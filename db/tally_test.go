@@ -0,0 +1,43 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPollResults(t *testing.T) {
+	poll := db.Poll{
+		PollId:   1,
+		Title:    "Favorite Pet",
+		Question: "What type of pet do you like best?",
+		Options:  []db.PollOption{{OptionId: 1, Text: "Dogs"}, {OptionId: 2, Text: "Cats"}},
+	}
+	// option 3 was removed after it got a vote
+	tally := db.Tally{PollId: 1, Counts: map[uint]int{1: 1, 3: 2}, Total: 3}
+
+	results := db.NewPollResults(poll, tally, 4)
+	assert.Equal(t, db.PollResults{
+		PollId:   1,
+		Title:    poll.Title,
+		Question: poll.Question,
+		Options: []db.OptionResult{
+			{OptionId: 1, Text: "Dogs", Votes: 1, Percentage: 33.33},
+			{OptionId: 2, Text: "Cats", Votes: 0, Percentage: 0},
+			{OptionId: 3, Votes: 2, Percentage: 66.67},
+		},
+		TotalBallots:     3,
+		RegisteredVoters: 4,
+		Turnout:          75,
+	}, results)
+}
+
+func TestNewPollResultsNoVotes(t *testing.T) {
+	poll := db.Poll{PollId: 1, Options: []db.PollOption{{OptionId: 1, Text: "Dogs"}}}
+
+	results := db.NewPollResults(poll, db.Tally{PollId: 1, Counts: map[uint]int{}}, 0)
+	assert.Equal(t, []db.OptionResult{{OptionId: 1, Text: "Dogs"}}, results.Options)
+	assert.Equal(t, 0, results.TotalBallots)
+	assert.Equal(t, float64(0), results.Turnout)
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FieldError is one rule a field failed, Field is the JSON name of the field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every rule a value failed, it matches ErrValidation
+// with errors.Is
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	failed := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		failed[i] = field.Field + " " + field.Message
+	}
+
+	return ErrValidation.Error() + ": " + strings.Join(failed, ", ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// rule checks a single field against the parameter of its tag, it returns
+// what is wrong with the field or an empty string when the field passes
+type rule func(field reflect.Value, param string) string
+
+// rules are the names that can be used in a validate struct tag, rules run
+// in the order of the tag and a field stops at the first one it fails
+var rules = map[string]rule{
+	"required": func(field reflect.Value, _ string) string {
+		switch value := field.Interface().(type) {
+		case string:
+			if strings.TrimSpace(value) == "" {
+				return "must not be empty"
+			}
+		case time.Time:
+			if value.IsZero() {
+				return "must be set"
+			}
+		default:
+			if field.IsZero() {
+				return "must be greater than 0"
+			}
+		}
+		return ""
+	},
+	"max": func(field reflect.Value, param string) string {
+		max, _ := strconv.Atoi(param)
+		if utf8.RuneCountInString(field.String()) > max {
+			return fmt.Sprintf("must be at most %d characters", max)
+		}
+		return ""
+	},
+	"email": func(field reflect.Value, _ string) string {
+		// a display name or surrounding spaces are not part of an address
+		address, err := mail.ParseAddress(field.String())
+		if err != nil || address.Address != field.String() {
+			return "must be a valid email address"
+		}
+		return ""
+	},
+	"past": func(field reflect.Value, _ string) string {
+		if field.Interface().(time.Time).After(time.Now()) {
+			return "must not be in the future"
+		}
+		return ""
+	},
+	"empty": func(field reflect.Value, _ string) string {
+		if field.Len() > 0 {
+			return "must be empty"
+		}
+		return ""
+	},
+}
+
+// validate runs the rules in the given struct tags of the fields of item, a
+// type can keep rules for a single use like create next to its validate ones
+func validate(item interface{}, tags ...string) error {
+	value := reflect.ValueOf(item)
+	var fields []FieldError
+	for i := 0; i < value.NumField(); i++ {
+		structField := value.Type().Field(i)
+		name, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+		if name == "" {
+			name = structField.Name
+		}
+
+		for _, tag := range tags {
+			if failed, ok := checkField(value.Field(i), structField.Tag.Get(tag)); !ok {
+				fields = append(fields, FieldError{Field: name, Rule: failed.Rule, Message: failed.Message})
+				break
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func checkField(field reflect.Value, tag string) (FieldError, bool) {
+	if tag == "" {
+		return FieldError{}, true
+	}
+
+	for _, ruleTag := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(ruleTag, "=")
+		check, ok := rules[name]
+		if !ok {
+			panic("unknown validation rule " + name)
+		}
+		if message := check(field, param); message != "" {
+			return FieldError{Rule: name, Message: message}, false
+		}
+	}
+
+	return FieldError{}, true
+}
+
+// Validate checks voter against the rules in its validate tags
+func (v Voter) Validate() error {
+	return validate(v, "validate")
+}
+
+// ValidateNew checks a voter that is about to be added, on top of Validate
+// it has to come without vote history
+func (v Voter) ValidateNew() error {
+	return validate(v, "validate", "create")
+}
+
+// Validate checks poll and every one of its options against the rules in
+// their validate tags, the fields of an option are named by its position
+func (p Poll) Validate() error {
+	var fields []FieldError
+	var validationErr *ValidationError
+	if errors.As(validate(p, "validate"), &validationErr) {
+		fields = append(fields, validationErr.Fields...)
+	}
+	for i, option := range p.Options {
+		if errors.As(option.Validate(), &validationErr) {
+			for _, field := range validationErr.Fields {
+				field.Field = fmt.Sprintf("options[%d].%s", i, field.Field)
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// validateUpdate checks the title and question UpdatePoll writes to the
+// poll with pollId, options are left to AddPollOption
+func (p Poll) validateUpdate(pollId uint) error {
+	return Poll{PollId: pollId, Title: p.Title, Question: p.Question}.Validate()
+}
+
+// Validate checks a poll option against the rules in its validate tags
+func (o PollOption) Validate() error {
+	return validate(o, "validate")
+}
+
+// Validate checks a vote before it is cast, VoteId and VoteDate are left to
+// the store
+func (v Vote) Validate() error {
+	return validate(v, "validate")
+}
+
+// Validate checks a vote history entry against the rules in its validate
+// tags
+func (vh VoterHistory) Validate() error {
+	return validate(vh, "validate")
+}
@@ -0,0 +1,217 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Vote is a ballot cast by a voter for one option of a poll. VoteId and
+// VoteDate are set by the store when the vote is cast.
+type Vote struct {
+	VoteId   uint      `json:"voteId"`
+	VoterId  uint      `json:"voterId" validate:"required"`
+	PollId   uint      `json:"pollId" validate:"required"`
+	OptionId uint      `json:"optionId" validate:"required"`
+	Value    string    `json:"value"`
+	VoteDate time.Time `json:"voteDate"`
+}
+
+// VoteStore is implemented by every vote backend. CastVote writes the vote,
+// the matching VoterHistory entry of the voter and the tally of the poll as
+// one change. RebuildTallies recounts every tally from the stored votes and
+// reports the ones that had drifted.
+type VoteStore interface {
+	CastVote(ctx context.Context, vote Vote) (Vote, error)
+	GetVote(ctx context.Context, voteId uint) (Vote, error)
+	GetAllVotes(ctx context.Context) []Vote
+	CountVotes(ctx context.Context) (int, error)
+	DeleteAllVotes(ctx context.Context)
+	GetTally(ctx context.Context, pollId uint) (Tally, error)
+	RebuildTallies(ctx context.Context) ([]TallyDrift, error)
+}
+
+// historyForVote is the vote history entry recorded for vote
+func historyForVote(vote Vote) VoterHistory {
+	return VoterHistory{
+		PollId:   vote.PollId,
+		VoteId:   vote.VoteId,
+		VoteDate: vote.VoteDate,
+	}
+}
+
+// recordsVote reports whether vh in the history of voterId is the entry
+// vote wrote when it was cast
+func recordsVote(vote Vote, voterId uint, vh VoterHistory) bool {
+	return vote.VoteId == vh.VoteId && vote.VoterId == voterId && vote.PollId == vh.PollId
+}
+
+// checkVoteHistory fails when the voter already has a history entry for the
+// poll of the vote
+func checkVoteHistory(voter Voter, vote Vote) error {
+	for _, vh := range voter.VoteHistory {
+		if vh.PollId == vote.PollId {
+			return ErrAlreadyVoted
+		}
+	}
+
+	return nil
+}
+
+// VoteList is the in-memory VoteStore, it records history in the VoterList
+// it was created with
+type VoteList struct {
+	Votes      map[uint]Vote //A map of VoteIDs as keys and Vote structs as values
+	tallies    map[uint]Tally
+	voters     *VoterList
+	lastVoteId uint
+	mu         sync.RWMutex
+}
+
+var _ VoteStore = (*VoteList)(nil)
+
+func NewVoteList(voters *VoterList) (*VoteList, error) {
+	if voters == nil {
+		return nil, errors.New("voter list is required")
+	}
+
+	votes := &VoteList{
+		Votes:   make(map[uint]Vote),
+		tallies: make(map[uint]Tally),
+		voters:  voters,
+	}
+	voters.votes = votes
+	return votes, nil
+}
+
+func (v *VoteList) CastVote(ctx context.Context, vote Vote) (Vote, error) {
+	if err := vote.Validate(); err != nil {
+		return Vote{}, err
+	}
+
+	// the voter list lock is always taken first, then the polls
+	v.voters.mu.Lock()
+	defer v.voters.mu.Unlock()
+
+	voter, ok := v.voters.Voters[vote.VoterId]
+	if !ok {
+		return Vote{}, ErrVoterNotFound
+	}
+
+	unlock, err := v.voters.lockPollOption(vote.PollId, vote.OptionId)
+	if err != nil {
+		return Vote{}, err
+	}
+	defer unlock()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := checkVoteHistory(voter, vote); err != nil {
+		return Vote{}, err
+	}
+
+	v.lastVoteId++
+	vote.VoteId = v.lastVoteId
+	vote.VoteDate = time.Now().UTC()
+
+	voter.VoteHistory = append(copyVoteHistory(voter.VoteHistory), historyForVote(vote))
+	voter.Revision++
+	v.voters.Voters[vote.VoterId] = voter
+	v.Votes[vote.VoteId] = vote
+
+	tally, ok := v.tallies[vote.PollId]
+	if !ok {
+		tally = newTally(vote.PollId)
+	}
+	tally.add(vote.OptionId, 1)
+	v.tallies[vote.PollId] = tally
+
+	return vote, nil
+}
+
+func (v *VoteList) GetVote(ctx context.Context, voteId uint) (Vote, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	vote, ok := v.Votes[voteId]
+	if !ok {
+		return Vote{}, ErrVoteNotFound
+	}
+
+	return vote, nil
+}
+
+// GetAllVotes returns votes ordered by voteId
+func (v *VoteList) GetAllVotes(ctx context.Context) []Vote {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	voteList := []Vote{}
+	for _, vote := range v.Votes {
+		voteList = append(voteList, vote)
+	}
+
+	sort.Slice(voteList, func(i, j int) bool {
+		return voteList[i].VoteId < voteList[j].VoteId
+	})
+	return voteList
+}
+
+func (v *VoteList) CountVotes(ctx context.Context) (int, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return len(v.Votes), nil
+}
+
+// DeleteAllVotes forgets every vote and tally, the vote history of voters is
+// kept and vote ids keep counting up
+func (v *VoteList) DeleteAllVotes(ctx context.Context) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.Votes = make(map[uint]Vote)
+	v.tallies = make(map[uint]Tally)
+}
+
+// GetTally returns an empty tally for a poll nobody voted in
+func (v *VoteList) GetTally(ctx context.Context, pollId uint) (Tally, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	tally, ok := v.tallies[pollId]
+	if !ok {
+		return newTally(pollId), nil
+	}
+
+	return copyTally(tally), nil
+}
+
+func (v *VoteList) RebuildTallies(ctx context.Context) ([]TallyDrift, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	votes := make([]Vote, 0, len(v.Votes))
+	for _, vote := range v.Votes {
+		votes = append(votes, vote)
+	}
+
+	rebuilt := tallyVotes(votes)
+	drifts := compareTallies(v.tallies, rebuilt)
+	v.tallies = rebuilt
+	return drifts, nil
+}
+
+// copyTally returns a copy of tally that does not share its counts
+func copyTally(tally Tally) Tally {
+	counts := make(map[uint]int, len(tally.Counts))
+	for optionId, count := range tally.Counts {
+		counts[optionId] = count
+	}
+
+	tally.Counts = counts
+	return tally
+}
@@ -0,0 +1,359 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	RedisVoteKeyPrefix = "vote:"
+	// RedisVoteIndexKey is a sorted set of every stored voteId scored by the
+	// id itself, it must not match RedisVoteKeyPrefix
+	RedisVoteIndexKey = "votes"
+	// RedisVoteIdKey is the counter handing out voteIds
+	RedisVoteIdKey = "vote-id"
+	// RedisTallyKeyPrefix keys a hash of optionId to vote count per poll
+	RedisTallyKeyPrefix = "tally:"
+)
+
+// VoteCache is the VoteStore backed by Redis, votes are kept as ReJSON
+// documents under vote:<id>
+type VoteCache struct {
+	//Redis cache connections
+	cache
+	// voters tells whether ballots have to name a stored poll and option
+	voters *VoterCache
+}
+
+var _ VoteStore = (*VoteCache)(nil)
+
+// NewVoteCache returns the VoteStore sharing the redis connection of
+// voterCache
+func NewVoteCache(voterCache *VoterCache) *VoteCache {
+	return &VoteCache{cache: voterCache.cache, voters: voterCache}
+}
+
+func redisVoteKeyFromId(id uint) string {
+	return fmt.Sprintf("%s%d", RedisVoteKeyPrefix, id)
+}
+
+func redisTallyKeyFromId(pollId uint) string {
+	return fmt.Sprintf("%s%d", RedisTallyKeyPrefix, pollId)
+}
+
+// CastVote stores the vote, appends its history entry to the voter and counts
+// it in the tally of the poll in the same MULTI, the voter document is watched
+// so a concurrent vote of the same voter in the same poll cannot slip in
+// between. Once a PollCache shares the connection the poll is watched too and
+// has to have the option.
+func (v *VoteCache) CastVote(ctx context.Context, vote Vote) (Vote, error) {
+	if err := vote.Validate(); err != nil {
+		return Vote{}, err
+	}
+
+	voteId, err := v.cacheClient.Incr(ctx, RedisVoteIdKey).Result()
+	if err != nil {
+		return Vote{}, err
+	}
+	vote.VoteId = uint(voteId)
+	vote.VoteDate = time.Now().UTC()
+
+	document, err := json.Marshal(vote)
+	if err != nil {
+		return Vote{}, err
+	}
+
+	err = updateVoterDocumentIf(ctx, &v.cache, vote.VoterId, v.pollOptionPrecondition(ctx, vote.PollId, vote.OptionId),
+		func(voter *Voter) error {
+			if err := checkVoteHistory(*voter, vote); err != nil {
+				return err
+			}
+			voter.VoteHistory = append(voter.VoteHistory, historyForVote(vote))
+			return nil
+		},
+		func(pipe redis.Pipeliner) {
+			pipe.Do(ctx, "JSON.SET", redisVoteKeyFromId(vote.VoteId), ".", string(document))
+			pipe.ZAdd(ctx, RedisVoteIndexKey, redis.Z{Score: float64(vote.VoteId), Member: vote.VoteId})
+			pipe.HIncrBy(ctx, redisTallyKeyFromId(vote.PollId), strconv.FormatUint(uint64(vote.OptionId), 10), 1)
+		})
+	if err != nil {
+		return Vote{}, err
+	}
+
+	return vote, nil
+}
+
+// pollOptionPrecondition fails with ErrPollNotFound or ErrOptionNotFound
+// when a PollCache shares the connection and the poll does not have optionId
+func (v *VoteCache) pollOptionPrecondition(ctx context.Context, pollId uint, optionId uint) redisPrecondition {
+	if !v.voters.requirePolls {
+		return redisPrecondition{}
+	}
+
+	pollKey := redisPollKeyFromId(pollId)
+	return redisPrecondition{
+		keys: []string{pollKey},
+		check: func(tx *redis.Tx) error {
+			var poll Poll
+			err := getInTx(ctx, tx, pollKey, &poll)
+			if errors.Is(err, redis.Nil) {
+				return ErrPollNotFound
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, po := range poll.Options {
+				if po.OptionId == optionId {
+					return nil
+				}
+			}
+			return ErrOptionNotFound
+		},
+	}
+}
+
+func (v *VoteCache) GetVote(ctx context.Context, voteId uint) (Vote, error) {
+	itemObject, err := v.json(ctx).JSONGet(redisVoteKeyFromId(voteId), ".")
+	if errors.Is(err, redis.Nil) {
+		return Vote{}, ErrVoteNotFound
+	}
+	if err != nil {
+		return Vote{}, err
+	}
+
+	var vote Vote
+	if err := json.Unmarshal(itemObject.([]byte), &vote); err != nil {
+		return Vote{}, err
+	}
+
+	return vote, nil
+}
+
+// getVotesFromRedis reads the votes of voteIds in one round trip, votes
+// that do not exist are left out
+func (v *VoteCache) getVotesFromRedis(ctx context.Context, voteIds []string) ([]Vote, error) {
+	if len(voteIds) == 0 {
+		return []Vote{}, nil
+	}
+
+	keys := make([]string, len(voteIds))
+	for i, voteId := range voteIds {
+		keys[i] = RedisVoteKeyPrefix + voteId
+	}
+
+	items, err := v.json(ctx).JSONMGet(".", keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	votes := make([]Vote, 0, len(voteIds))
+	for _, item := range items.([]interface{}) {
+		if item == nil {
+			continue
+		}
+		var vote Vote
+		if err := json.Unmarshal(item.([]byte), &vote); err != nil {
+			return nil, err
+		}
+		votes = append(votes, vote)
+	}
+
+	return votes, nil
+}
+
+// forEachVote walks the index by score in batches of RedisBatchSize, so
+// votes come in voteId order and each batch is a single round trip
+func (v *VoteCache) forEachVote(ctx context.Context, fn func(vote Vote)) error {
+	start := "-inf"
+	for {
+		voteIds, err := v.cacheClient.ZRangeArgs(ctx, redis.ZRangeArgs{
+			Key:     RedisVoteIndexKey,
+			Start:   start,
+			Stop:    "+inf",
+			ByScore: true,
+			Count:   RedisBatchSize,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(voteIds) == 0 {
+			return nil
+		}
+
+		votes, err := v.getVotesFromRedis(ctx, voteIds)
+		if err != nil {
+			return err
+		}
+		for _, vote := range votes {
+			fn(vote)
+		}
+
+		if len(voteIds) < RedisBatchSize {
+			return nil
+		}
+		start = "(" + voteIds[len(voteIds)-1]
+	}
+}
+
+// GetAllVotes returns votes ordered by voteId
+func (v *VoteCache) GetAllVotes(ctx context.Context) []Vote {
+	votes := []Vote{}
+	err := v.forEachVote(ctx, func(vote Vote) {
+		votes = append(votes, vote)
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "getting votes from redis failed", "err", err)
+	}
+
+	return votes
+}
+
+// CountVotes counts the vote index
+func (v *VoteCache) CountVotes(ctx context.Context) (int, error) {
+	count, err := v.cacheClient.ZCard(ctx, RedisVoteIndexKey).Result()
+	return int(count), err
+}
+
+// DeleteAllVotes forgets every vote and tally, the vote history of voters is
+// kept and vote ids keep counting up
+func (v *VoteCache) DeleteAllVotes(ctx context.Context) {
+	for {
+		voteIds, err := v.cacheClient.ZRange(ctx, RedisVoteIndexKey, 0, RedisBatchSize-1).Result()
+		if err != nil {
+			slog.ErrorContext(ctx, "getting vote index from redis failed", "err", err)
+			return
+		}
+		if len(voteIds) == 0 {
+			break
+		}
+
+		keys := make([]string, len(voteIds))
+		members := make([]interface{}, len(voteIds))
+		for i, voteId := range voteIds {
+			keys[i] = RedisVoteKeyPrefix + voteId
+			members[i] = voteId
+		}
+
+		_, err = v.cacheClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, keys...)
+			pipe.ZRem(ctx, RedisVoteIndexKey, members...)
+			return nil
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "deleting votes from redis failed", "err", err)
+			return
+		}
+	}
+
+	tallyKeys, err := v.tallyKeys(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "getting tallies from redis failed", "err", err)
+		return
+	}
+	if len(tallyKeys) > 0 {
+		if err := v.cacheClient.Del(ctx, tallyKeys...).Err(); err != nil {
+			slog.ErrorContext(ctx, "deleting tallies from redis failed", "err", err)
+		}
+	}
+}
+
+// tallyKeys lists every tally key with SCAN, there is one per poll
+func (v *VoteCache) tallyKeys(ctx context.Context) ([]string, error) {
+	var keys []string
+	iter := v.cacheClient.Scan(ctx, 0, RedisTallyKeyPrefix+"*", RedisBatchSize).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+
+	return keys, iter.Err()
+}
+
+func (v *VoteCache) getTallyFromRedis(ctx context.Context, redisKey string, pollId uint) (Tally, error) {
+	counts, err := v.cacheClient.HGetAll(ctx, redisKey).Result()
+	if err != nil {
+		return Tally{}, err
+	}
+
+	tally := newTally(pollId)
+	for field, value := range counts {
+		optionId, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return Tally{}, fmt.Errorf("bad option %q in %s", field, redisKey)
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return Tally{}, fmt.Errorf("bad count %q in %s", value, redisKey)
+		}
+		tally.add(uint(optionId), count)
+	}
+
+	return tally, nil
+}
+
+// GetTally returns an empty tally for a poll nobody voted in
+func (v *VoteCache) GetTally(ctx context.Context, pollId uint) (Tally, error) {
+	return v.getTallyFromRedis(ctx, redisTallyKeyFromId(pollId), pollId)
+}
+
+// RebuildTallies recounts the votes and replaces every tally hash. The vote
+// index is watched, every cast changes it, so a ballot cast during the
+// rebuild makes it start over instead of being lost.
+func (v *VoteCache) RebuildTallies(ctx context.Context) ([]TallyDrift, error) {
+	var drifts []TallyDrift
+	txf := func(tx *redis.Tx) error {
+		var votes []Vote
+		if err := v.forEachVote(ctx, func(vote Vote) { votes = append(votes, vote) }); err != nil {
+			return err
+		}
+		rebuilt := tallyVotes(votes)
+
+		tallyKeys, err := v.tallyKeys(ctx)
+		if err != nil {
+			return err
+		}
+		stored := map[uint]Tally{}
+		for _, tallyKey := range tallyKeys {
+			pollId, err := strconv.ParseUint(strings.TrimPrefix(tallyKey, RedisTallyKeyPrefix), 10, 32)
+			if err != nil {
+				return fmt.Errorf("bad tally key %q", tallyKey)
+			}
+			tally, err := v.getTallyFromRedis(ctx, tallyKey, uint(pollId))
+			if err != nil {
+				return err
+			}
+			stored[uint(pollId)] = tally
+		}
+
+		drifts = compareTallies(stored, rebuilt)
+		if len(drifts) == 0 {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, drift := range drifts {
+				tallyKey := redisTallyKeyFromId(drift.PollId)
+				pipe.Del(ctx, tallyKey)
+				for optionId, count := range drift.Rebuilt.Counts {
+					pipe.HSet(ctx, tallyKey, strconv.FormatUint(uint64(optionId), 10), count)
+				}
+			}
+			return nil
+		})
+		return err
+	}
+
+	if err := watchWithRetry(ctx, &v.cache, txf, RedisVoteIndexKey); err != nil {
+		return nil, err
+	}
+
+	return drifts, nil
+}
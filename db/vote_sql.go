@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// VoteSQL is the VoteStore backed by SQLite, votes are kept in the votes
+// table and the running tally of every poll in the tallies table
+type VoteSQL struct {
+	sqlStore
+	// voters tells whether ballots have to name a stored poll and option
+	voters *VoterSQL
+}
+
+var _ VoteStore = (*VoteSQL)(nil)
+
+// NewVoteSQL returns the VoteStore sharing the database of voterSQL
+func NewVoteSQL(voterSQL *VoterSQL) *VoteSQL {
+	return &VoteSQL{sqlStore: voterSQL.sqlStore, voters: voterSQL}
+}
+
+func scanVote(row interface{ Scan(dest ...any) error }) (Vote, error) {
+	var vote Vote
+	var voteDate string
+	if err := row.Scan(&vote.VoteId, &vote.VoterId, &vote.PollId, &vote.OptionId, &vote.Value, &voteDate); err != nil {
+		return Vote{}, err
+	}
+
+	var err error
+	vote.VoteDate, err = parseSQLTime(voteDate)
+	return vote, err
+}
+
+// CastVote stores the vote, its history entry and its count in the tally in
+// the transaction that bumps the revision of the voter, the unique
+// (voter_id, poll_id) constraint on vote_history keeps out a second ballot in
+// the same poll. The poll and option are checked in the same transaction.
+func (v *VoteSQL) CastVote(ctx context.Context, vote Vote) (Vote, error) {
+	if err := vote.Validate(); err != nil {
+		return Vote{}, err
+	}
+
+	vote.VoteDate = time.Now().UTC()
+
+	_, err := updateVoterRow(ctx, &v.sqlStore, vote.VoterId, func(tx *sql.Tx, voter *Voter) error {
+		if err := v.voters.checkPollOption(ctx, tx, vote.PollId, vote.OptionId); err != nil {
+			return err
+		}
+		if err := checkVoteHistory(*voter, vote); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `INSERT INTO votes (voter_id, poll_id, option_id, value, vote_date) VALUES (?, ?, ?, ?, ?)`,
+			vote.VoterId, vote.PollId, vote.OptionId, vote.Value, vote.VoteDate.Format(sqlTimeFormat))
+		if err != nil {
+			return err
+		}
+		voteId, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		vote.VoteId = uint(voteId)
+
+		if err := insertVoterPoll(ctx, tx, vote.VoterId, historyForVote(vote), ErrAlreadyVoted); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO tallies (poll_id, option_id, count) VALUES (?, ?, 1)
+			ON CONFLICT (poll_id, option_id) DO UPDATE SET count = count + 1`, vote.PollId, vote.OptionId)
+		return err
+	})
+	if err != nil {
+		return Vote{}, err
+	}
+
+	return vote, nil
+}
+
+func (v *VoteSQL) GetVote(ctx context.Context, voteId uint) (Vote, error) {
+	vote, err := scanVote(v.db.QueryRowContext(ctx, `SELECT vote_id, voter_id, poll_id, option_id, value, vote_date
+		FROM votes WHERE vote_id = ?`, voteId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Vote{}, ErrVoteNotFound
+	}
+	if err != nil {
+		return Vote{}, err
+	}
+
+	return vote, nil
+}
+
+// GetAllVotes returns votes ordered by voteId
+func (v *VoteSQL) GetAllVotes(ctx context.Context) []Vote {
+	votes := []Vote{}
+	rows, err := v.db.QueryContext(ctx, `SELECT vote_id, voter_id, poll_id, option_id, value, vote_date FROM votes ORDER BY vote_id`)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var vote Vote
+			if vote, err = scanVote(rows); err != nil {
+				break
+			}
+			votes = append(votes, vote)
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "getting votes from sqlite failed", "err", err)
+	}
+
+	return votes
+}
+
+func (v *VoteSQL) CountVotes(ctx context.Context) (int, error) {
+	var count int
+	err := v.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM votes`).Scan(&count)
+	return count, err
+}
+
+// DeleteAllVotes forgets every vote and tally, the vote history of voters is
+// kept and vote ids keep counting up
+func (v *VoteSQL) DeleteAllVotes(ctx context.Context) {
+	err := inSQLTx(ctx, v.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM votes`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM tallies`)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "deleting votes from sqlite failed", "err", err)
+	}
+}
+
+// getTalliesFromSQL reads the per option counts of query into a tally per
+// poll, query selects poll_id, option_id and a count
+func getTalliesFromSQL(ctx context.Context, q sqlQuerier, query string, args ...any) (map[uint]Tally, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tallies := map[uint]Tally{}
+	for rows.Next() {
+		var pollId, optionId uint
+		var count int
+		if err := rows.Scan(&pollId, &optionId, &count); err != nil {
+			return nil, err
+		}
+
+		tally, ok := tallies[pollId]
+		if !ok {
+			tally = newTally(pollId)
+		}
+		tally.add(optionId, count)
+		tallies[pollId] = tally
+	}
+
+	return tallies, rows.Err()
+}
+
+// GetTally returns an empty tally for a poll nobody voted in
+func (v *VoteSQL) GetTally(ctx context.Context, pollId uint) (Tally, error) {
+	tallies, err := getTalliesFromSQL(ctx, v.db, `SELECT poll_id, option_id, count FROM tallies WHERE poll_id = ?`, pollId)
+	if err != nil {
+		return Tally{}, err
+	}
+
+	tally, ok := tallies[pollId]
+	if !ok {
+		return newTally(pollId), nil
+	}
+	return tally, nil
+}
+
+// RebuildTallies recounts the votes and rewrites the tallies that drifted in
+// one transaction, so no ballot is cast in between
+func (v *VoteSQL) RebuildTallies(ctx context.Context) ([]TallyDrift, error) {
+	var drifts []TallyDrift
+	err := inSQLTx(ctx, v.db, func(tx *sql.Tx) error {
+		stored, err := getTalliesFromSQL(ctx, tx, `SELECT poll_id, option_id, count FROM tallies`)
+		if err != nil {
+			return err
+		}
+		rebuilt, err := getTalliesFromSQL(ctx, tx, `SELECT poll_id, option_id, COUNT(*) FROM votes GROUP BY poll_id, option_id`)
+		if err != nil {
+			return err
+		}
+
+		drifts = compareTallies(stored, rebuilt)
+		for _, drift := range drifts {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM tallies WHERE poll_id = ?`, drift.PollId); err != nil {
+				return err
+			}
+			for optionId, count := range drift.Rebuilt.Counts {
+				_, err := tx.ExecContext(ctx, `INSERT INTO tallies (poll_id, option_id, count) VALUES (?, ?, ?)`,
+					drift.PollId, optionId, count)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return drifts, nil
+}
@@ -0,0 +1,89 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVoteList(t *testing.T) {
+	voterList, _ := db.New()
+	voteList, err := db.NewVoteList(voterList)
+	assert.Nil(t, err)
+	assert.NotNil(t, voteList)
+	assert.Equal(t, 0, len(voteList.Votes))
+
+	_, err = db.NewVoteList(nil)
+	assert.NotNil(t, err)
+}
+
+func TestVoteListConformance(t *testing.T) {
+	testutils.RunVoteStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore, db.VoteStore) {
+		voterList, err := db.New()
+		if err != nil {
+			t.Fatalf("failed to create voter list: %v", err)
+		}
+		pollList, _ := db.NewPollList(voterList)
+		voteList, err := db.NewVoteList(voterList)
+		if err != nil {
+			t.Fatalf("failed to create vote list: %v", err)
+		}
+		return voterList, pollList, voteList
+	})
+}
+
+func TestVoteCacheConformance(t *testing.T) {
+	testutils.RunVoteStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore, db.VoteStore) {
+		voterCache := newTestVoterCache(t)
+		pollCache := db.NewPollCache(voterCache)
+		pollCache.DeleteAllPolls(ctx)
+		voteCache := db.NewVoteCache(voterCache)
+		voteCache.DeleteAllVotes(ctx)
+		return voterCache, pollCache, voteCache
+	})
+}
+
+func TestVoteCacheRebuildTallies(t *testing.T) {
+	location := testutils.NewRedisStandIn(t)
+	voterCache, err := db.NewWithCacheInstance(location)
+	assert.Nil(t, err)
+	voteCache := db.NewVoteCache(voterCache)
+
+	voterCache.AddVoter(ctx, testutils.NewRandVoter(1))
+	voterCache.AddVoter(ctx, testutils.NewRandVoter(2))
+	voteCache.CastVote(ctx, db.Vote{VoterId: 1, PollId: 1, OptionId: 1})
+	voteCache.CastVote(ctx, db.Vote{VoterId: 2, PollId: 1, OptionId: 2})
+
+	// tallies knocked out of step with the votes
+	client := redis.NewClient(&redis.Options{Addr: location})
+	defer client.Close()
+	assert.Nil(t, client.HIncrBy(context.Background(), db.RedisTallyKeyPrefix+"1", "2", 5).Err())
+	assert.Nil(t, client.HSet(context.Background(), db.RedisTallyKeyPrefix+"7", "1", 1).Err())
+
+	drifts, err := voteCache.RebuildTallies(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []db.TallyDrift{
+		{
+			PollId:  1,
+			Stored:  db.Tally{PollId: 1, Counts: map[uint]int{1: 1, 2: 6}, Total: 7},
+			Rebuilt: db.Tally{PollId: 1, Counts: map[uint]int{1: 1, 2: 1}, Total: 2},
+		},
+		{
+			PollId:  7,
+			Stored:  db.Tally{PollId: 7, Counts: map[uint]int{1: 1}, Total: 1},
+			Rebuilt: db.Tally{PollId: 7, Counts: map[uint]int{}},
+		},
+	}, drifts)
+
+	tally, err := voteCache.GetTally(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, db.Tally{PollId: 1, Counts: map[uint]int{1: 1, 2: 1}, Total: 2}, tally)
+
+	drifts, err = voteCache.RebuildTallies(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, drifts)
+}
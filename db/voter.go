@@ -1,120 +1,318 @@
 package db
 
 import (
-	"errors"
+	"context"
+	"log/slog"
+	"sync"
 	"time"
 )
 
+// VoterHistory and Voter are checked by every store with the rules in their
+// validate tags, see validation.go. Voters are created with the rules in
+// their create tags too.
 type VoterHistory struct {
-	PollId   uint      `json:"pollId"`
+	PollId   uint      `json:"pollId" validate:"required"`
 	VoteId   uint      `json:"voteId"`
-	VoteDate time.Time `json:"voteDate"`
+	VoteDate time.Time `json:"voteDate" validate:"required,past"`
 }
 
+// FirstRevision is the revision of a voter that was just added
+const FirstRevision uint64 = 1
+
+// Voter.Revision is set by the store, it starts at FirstRevision and goes
+// up with every write to the voter including its vote history
 type Voter struct {
-	VoterId     uint           `json:"voterId"`
-	Name        string         `json:"name"`
-	Email       string         `json:"email"`
-	VoteHistory []VoterHistory `json:"voteHistory,omitempty"`
+	VoterId     uint           `json:"voterId" validate:"required"`
+	Name        string         `json:"name" validate:"required,max=100"`
+	Email       string         `json:"email" validate:"required,email,max=254"`
+	VoteHistory []VoterHistory `json:"voteHistory,omitempty" create:"empty"`
+	Revision    uint64         `json:"revision"`
+}
+
+// LogValue logs a voter with its name and email under keys of their own, so
+// they can be redacted, and only the length of its vote history
+func (v Voter) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("voterId", uint64(v.VoterId)),
+		slog.String("name", v.Name),
+		slog.String("email", v.Email),
+		slog.Int("votes", len(v.VoteHistory)),
+		slog.Uint64("revision", v.Revision),
+	)
 }
 
+// VoterPatch returns what voter should be replaced with, like the body of
+// UpdateVoter only its mutable fields are used. Stores may call it more than
+// once so it must not have side effects.
+type VoterPatch func(voter Voter) (Voter, error)
+
+// VoterStore is implemented by every voter backend so the API layer does
+// not care where voters are kept. The writes that take ifRevision only
+// happen while the voter is still at that revision, 0 skips the check.
+// Stores that wait on a server give up once ctx is done, the in-memory
+// stores never wait and ignore it.
+type VoterStore interface {
+	AddVoter(ctx context.Context, voter Voter) error
+	GetVoter(ctx context.Context, voterId uint) (Voter, error)
+	GetAllVoters(ctx context.Context) []Voter
+	QueryVoters(ctx context.Context, query VoterQuery) (VoterPage, error)
+	CountVoters(ctx context.Context) (int, error)
+	DeleteAllVoters(ctx context.Context)
+	UpdateVoter(ctx context.Context, voter Voter, voterId uint, ifRevision uint64) (Voter, error)
+	PatchVoter(ctx context.Context, voterId uint, ifRevision uint64, patch VoterPatch) (Voter, error)
+	DeleteVoter(ctx context.Context, voterId uint, ifRevision uint64) error
+	GetVoterPolls(ctx context.Context, voterId uint) ([]VoterHistory, error)
+	AddVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint) error
+	GetVoterPoll(ctx context.Context, voterId uint, pollId uint) (VoterHistory, error)
+	UpdateVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint, pollId uint) error
+	DeleteVoterPoll(ctx context.Context, voterId uint, pollId uint) error
+}
+
+// VoterList is the in-memory VoterStore, it is safe for concurrent use.
+// Readers share the lock and always get copies of the vote history so the
+// stored slices never escape.
 type VoterList struct {
 	Voters map[uint]Voter //A map of VoterIDs as keys and Voter structs as values
+	polls  *PollList      //the polls vote history has to name, set by NewPollList
+	votes  *VoteList      //the votes that wrote vote history, set by NewVoteList
+	mu     sync.RWMutex
 }
 
+var _ VoterStore = (*VoterList)(nil)
+
 func New() (*VoterList, error) {
 	return &VoterList{
 		Voters: make(map[uint]Voter),
 	}, nil
 }
 
-func (v *VoterList) AddVoter(voter Voter) error {
+func (v *VoterList) AddVoter(ctx context.Context, voter Voter) error {
+	if err := voter.ValidateNew(); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
 	_, ok := v.Voters[voter.VoterId]
 	if ok {
-		return errors.New("voter already exists")
+		return ErrVoterExists
 	}
 
+	voter.VoteHistory = copyVoteHistory(voter.VoteHistory)
+	voter.Revision = FirstRevision
 	v.Voters[voter.VoterId] = voter
 	return nil
 }
 
-func (v *VoterList) GetVoter(voterId uint) (Voter, error) {
+func (v *VoterList) GetVoter(ctx context.Context, voterId uint) (Voter, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
 	voter, ok := v.Voters[voterId]
 	if !ok {
-		return Voter{}, errors.New("voter does not exist")
+		return Voter{}, ErrVoterNotFound
 	}
 
+	voter.VoteHistory = copyVoteHistory(voter.VoteHistory)
 	return voter, nil
 }
 
-func (v *VoterList) GetAllVoters() []Voter {
+func (v *VoterList) GetAllVoters(ctx context.Context) []Voter {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
 	var voterList []Voter
 	for _, voter := range v.Voters {
+		voter.VoteHistory = copyVoteHistory(voter.VoteHistory)
 		voterList = append(voterList, voter)
 	}
 	return voterList
 }
 
-func (v *VoterList) DeleteAllVoters() {
+func (v *VoterList) QueryVoters(ctx context.Context, query VoterQuery) (VoterPage, error) {
+	if err := query.Validate(); err != nil {
+		return VoterPage{}, err
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	matching := []Voter{}
+	for _, voter := range v.Voters {
+		if query.Matches(voter) {
+			voter.VoteHistory = copyVoteHistory(voter.VoteHistory)
+			matching = append(matching, voter)
+		}
+	}
+
+	return query.page(matching), nil
+}
+
+func (v *VoterList) CountVoters(ctx context.Context) (int, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return len(v.Voters), nil
+}
+
+func (v *VoterList) DeleteAllVoters(ctx context.Context) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
 	v.Voters = make(map[uint]Voter)
 }
 
-func (v *VoterList) UpdateVoter(voter Voter, voterId uint) error {
-	_, ok := v.Voters[voterId]
+func (v *VoterList) UpdateVoter(ctx context.Context, voter Voter, voterId uint, ifRevision uint64) (Voter, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	updatedVoter, ok := v.Voters[voterId]
 	if !ok {
-		return errors.New("voter does not exist")
+		return Voter{}, ErrVoterNotFound
+	}
+	if err := checkRevision(updatedVoter, ifRevision); err != nil {
+		return Voter{}, err
 	}
 
-	updatedVoter := v.Voters[voterId]
-	updatedVoter.Email = voter.Email
-	updatedVoter.Name = voter.Name
+	if err := replaceVoter(&updatedVoter, voter); err != nil {
+		return Voter{}, err
+	}
 
+	updatedVoter.Revision++
 	v.Voters[voterId] = updatedVoter
+	updatedVoter.VoteHistory = copyVoteHistory(updatedVoter.VoteHistory)
+	return updatedVoter, nil
+}
 
-	return nil
+func (v *VoterList) PatchVoter(ctx context.Context, voterId uint, ifRevision uint64, patch VoterPatch) (Voter, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	updatedVoter, ok := v.Voters[voterId]
+	if !ok {
+		return Voter{}, ErrVoterNotFound
+	}
+	if err := checkRevision(updatedVoter, ifRevision); err != nil {
+		return Voter{}, err
+	}
+
+	current := updatedVoter
+	current.VoteHistory = copyVoteHistory(updatedVoter.VoteHistory)
+	voter, err := patch(current)
+	if err != nil {
+		return Voter{}, err
+	}
+	if err := replaceVoter(&updatedVoter, voter); err != nil {
+		return Voter{}, err
+	}
+
+	updatedVoter.Revision++
+	v.Voters[voterId] = updatedVoter
+	updatedVoter.VoteHistory = copyVoteHistory(updatedVoter.VoteHistory)
+	return updatedVoter, nil
 }
 
-func (v *VoterList) DeleteVoter(voterId uint) error {
-	_, ok := v.Voters[voterId]
+func (v *VoterList) DeleteVoter(ctx context.Context, voterId uint, ifRevision uint64) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	voter, ok := v.Voters[voterId]
 	if !ok {
-		return errors.New("voter does not exist")
+		return ErrVoterNotFound
+	}
+	if err := checkRevision(voter, ifRevision); err != nil {
+		return err
 	}
 
 	delete(v.Voters, voterId)
 	return nil
 }
 
-func (v *VoterList) GetVoterPolls(voterId uint) ([]VoterHistory, error) {
+func (v *VoterList) GetVoterPolls(ctx context.Context, voterId uint) ([]VoterHistory, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
 	voter, ok := v.Voters[voterId]
 	if !ok {
-		return nil, errors.New("voter does not exist")
+		return nil, ErrVoterNotFound
 	}
 
-	return voter.VoteHistory, nil
+	return copyVoteHistory(voter.VoteHistory), nil
 }
 
-func (v *VoterList) AddVoterPoll(voterPoll VoterHistory, voterId uint) error {
+// lockPoll fails with ErrPollNotFound when the polls kept alongside the
+// voters do not have pollId, otherwise the poll is kept from being deleted
+// until unlock is called. The voter lock has to be held already.
+func (v *VoterList) lockPoll(pollId uint) (unlock func(), err error) {
+	if v.polls == nil {
+		return func() {}, nil
+	}
+
+	v.polls.mu.RLock()
+	if _, ok := v.polls.Polls[pollId]; !ok {
+		v.polls.mu.RUnlock()
+		return nil, ErrPollNotFound
+	}
+	return v.polls.mu.RUnlock, nil
+}
+
+// lockPollOption is lockPoll for a ballot, the poll has to have optionId
+// too
+func (v *VoterList) lockPollOption(pollId uint, optionId uint) (unlock func(), err error) {
+	unlock, err = v.lockPoll(pollId)
+	if err != nil || v.polls == nil {
+		return unlock, err
+	}
+
+	for _, po := range v.polls.Polls[pollId].Options {
+		if po.OptionId == optionId {
+			return unlock, nil
+		}
+	}
+	unlock()
+	return nil, ErrOptionNotFound
+}
+
+func (v *VoterList) AddVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint) error {
+	if err := voterPoll.Validate(); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
 	voter, ok := v.Voters[voterId]
 	if !ok {
-		return errors.New("voter does not exist")
+		return ErrVoterNotFound
 	}
 
+	unlock, err := v.lockPoll(voterPoll.PollId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	for _, vh := range voter.VoteHistory {
 		if vh.PollId == voterPoll.PollId {
-			return errors.New("poll already exists")
+			return ErrPollExists
 		}
 	}
 
 	voter.VoteHistory = append(voter.VoteHistory, voterPoll)
+	voter.Revision++
 
 	v.Voters[voterId] = voter
 	return nil
 }
 
-func (v *VoterList) GetVoterPoll(voterId uint, pollId uint) (VoterHistory, error) {
+func (v *VoterList) GetVoterPoll(ctx context.Context, voterId uint, pollId uint) (VoterHistory, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
 	voter, ok := v.Voters[voterId]
 	if !ok {
-		return VoterHistory{}, errors.New("voter does not exist")
+		return VoterHistory{}, ErrVoterNotFound
 	}
 
 	for _, vh := range voter.VoteHistory {
@@ -123,39 +321,123 @@ func (v *VoterList) GetVoterPoll(voterId uint, pollId uint) (VoterHistory, error
 		}
 	}
 
-	return VoterHistory{}, errors.New("poll does not exist")
+	return VoterHistory{}, ErrPollNotFound
 }
 
-func (v *VoterList) UpdateVoterPoll(voterPoll VoterHistory, voterId uint, pollId uint) error {
+func (v *VoterList) UpdateVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint, pollId uint) error {
+	voterPoll.PollId = pollId
+	if err := voterPoll.Validate(); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
 	voter, ok := v.Voters[voterId]
 	if !ok {
-		return errors.New("voter does not exist")
+		return ErrVoterNotFound
 	}
 
+	unlock, err := v.lockPoll(pollId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	for i, vh := range voter.VoteHistory {
 		if vh.PollId == pollId {
-			voterPoll.PollId = pollId
+			// the entry a ballot wrote keeps pointing at its vote
+			if v.recordsVote(voterId, vh) {
+				return ErrVoteRecorded
+			}
+
 			voter.VoteHistory[i] = voterPoll
+			voter.Revision++
+			v.Voters[voterId] = voter
 			return nil
 		}
 	}
 
-	return errors.New("poll does not exist")
+	return ErrPollNotFound
 }
 
-func (v *VoterList) DeleteVoterPoll(voterId uint, pollId uint) error {
+func (v *VoterList) DeleteVoterPoll(ctx context.Context, voterId uint, pollId uint) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
 	voter, ok := v.Voters[voterId]
 	if !ok {
-		return errors.New("voter does not exist")
+		return ErrVoterNotFound
 	}
 
 	for i, vh := range voter.VoteHistory {
 		if vh.PollId == pollId {
+			if v.recordsVote(voterId, vh) {
+				return ErrVoteRecorded
+			}
+
 			voter.VoteHistory = append(voter.VoteHistory[:i], voter.VoteHistory[i+1:]...)
+			voter.Revision++
 			v.Voters[voterId] = voter
 			return nil
 		}
 	}
 
-	return errors.New("poll does not exist")
+	return ErrPollNotFound
+}
+
+// recordsVote reports whether vh of voterId was written by casting one of
+// the votes kept alongside the voters. The voter lock has to be held
+// already, CastVote takes it first too.
+func (v *VoterList) recordsVote(voterId uint, vh VoterHistory) bool {
+	if v.votes == nil {
+		return false
+	}
+
+	v.votes.mu.RLock()
+	defer v.votes.mu.RUnlock()
+
+	vote, ok := v.votes.Votes[vh.VoteId]
+	return ok && recordsVote(vote, voterId, vh)
+}
+
+// checkRevision fails when ifRevision is set and voter is at another
+// revision
+func checkRevision(voter Voter, ifRevision uint64) error {
+	if ifRevision != 0 && ifRevision != voter.Revision {
+		return ErrRevisionMismatch
+	}
+
+	return nil
+}
+
+// replaceVoter replaces the mutable fields of existing with the ones of
+// voter. The voterId of voter may be left out but can not name another
+// voter, the vote history only changes through the vote history calls.
+func replaceVoter(existing *Voter, voter Voter) error {
+	if voter.VoterId != 0 && voter.VoterId != existing.VoterId {
+		return ErrVoterIdMismatch
+	}
+
+	voter.VoterId = existing.VoterId
+	voter.VoteHistory = nil
+	if err := voter.Validate(); err != nil {
+		return err
+	}
+
+	existing.Name = voter.Name
+	existing.Email = voter.Email
+	return nil
+}
+
+// copyVoteHistory returns a copy of history that does not share its backing
+// array, nil stays nil
+func copyVoteHistory(history []VoterHistory) []VoterHistory {
+	if history == nil {
+		return nil
+	}
+
+	historyCopy := make([]VoterHistory, len(history))
+	copy(historyCopy, history)
+	return historyCopy
 }
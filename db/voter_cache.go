@@ -0,0 +1,795 @@
+package db
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/nitishm/go-rejson/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	RedisNilError        = "redis: nil"
+	RedisDefaultLocation = "0.0.0.0:6379"
+	RedisKeyPrefix       = "voter:"
+	// RedisIndexKey is a sorted set of every stored voterId scored by the id
+	// itself, it must not match RedisKeyPrefix
+	RedisIndexKey = "voters"
+	// RedisBatchSize is how many voters are fetched or deleted per round trip
+	RedisBatchSize = 500
+
+	// RedisTxMaxRetries bounds how often a read-modify-write of a voter is
+	// retried when another client changed the document in between
+	RedisTxMaxRetries = 50
+	redisTxMaxBackoff = 50 * time.Millisecond
+)
+
+type cache struct {
+	cacheClient *redis.Client
+	breaker     *circuitBreaker
+}
+
+// json returns a ReJSON handler whose calls run under ctx
+func (c *cache) json(ctx context.Context) *rejson.Handler {
+	jsonHelper := rejson.NewReJSONHandler()
+	jsonHelper.SetGoRedisClientWithContext(ctx, c.cacheClient)
+	return jsonHelper
+}
+
+// VoterCache is the VoterStore backed by Redis, voters are kept as
+// ReJSON documents under voter:<id>
+type VoterCache struct {
+	//Redis cache connections
+	cache
+	// requirePolls makes vote history name an existing poll, set by
+	// NewPollCache
+	requirePolls bool
+}
+
+var _ VoterStore = (*VoterCache)(nil)
+
+// RedisConfig says how to reach redis beyond its address, the zero value
+// connects without a password or TLS to database 0 with the default pool
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+	// TLS is nil to connect in plain text
+	TLS      *tls.Config
+	PoolSize int
+}
+
+func NewWithCacheInstance(location string) (*VoterCache, error) {
+	return NewWithRedisConfig(RedisConfig{Addr: location})
+}
+
+func NewWithRedisConfig(config RedisConfig) (*VoterCache, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:                  config.Addr,
+		Password:              config.Password,
+		DB:                    config.DB,
+		TLSConfig:             config.TLS,
+		PoolSize:              config.PoolSize,
+		DialTimeout:           RedisDialTimeout,
+		ContextTimeoutEnabled: true,
+		MaxRetries:            RedisMaxRetries,
+		MinRetryBackoff:       RedisMinRetryBackoff,
+		MaxRetryBackoff:       RedisMaxRetryBackoff,
+	})
+	breaker := newCircuitBreaker(RedisBreakerFailures, RedisBreakerCooldown)
+	client.AddHook(breakerHook{breaker: breaker})
+
+	ctx := context.Background()
+
+	err := client.Ping(ctx).Err()
+	if err != nil {
+		slog.WarnContext(ctx, "connecting to redis failed, continuing without it", "addr", config.Addr, "err", err)
+	}
+
+	voterCache := &VoterCache{
+		cache: cache{
+			cacheClient: client,
+			breaker:     breaker,
+		},
+	}
+
+	// voters written before the index existed are picked up once
+	if err == nil {
+		if exists, err := client.Exists(ctx, RedisIndexKey).Result(); err == nil && exists == 0 {
+			if err := voterCache.RebuildIndex(ctx); err != nil {
+				slog.ErrorContext(ctx, "rebuilding voter index failed", "err", err)
+			}
+		}
+	}
+
+	return voterCache, nil
+}
+
+// Ping checks that the redis server is reachable
+func (v *VoterCache) Ping(ctx context.Context) error {
+	return v.cacheClient.Ping(ctx).Err()
+}
+
+// Close closes the redis client, the PollCache and VoteCache sharing it too
+func (v *VoterCache) Close() error {
+	return v.cacheClient.Close()
+}
+
+// PoolStats reports the connection pool of the redis client
+func (v *VoterCache) PoolStats() *redis.PoolStats {
+	return v.cacheClient.PoolStats()
+}
+
+// BreakerState tells whether calls to redis go through or fail fast
+func (v *VoterCache) BreakerState() BreakerState {
+	return v.breaker.State()
+}
+
+func redisKeyFromId(id int) string {
+	return fmt.Sprintf("%s%d", RedisKeyPrefix, id)
+}
+
+// RebuildIndex adds every voter:<id> key to the voter index, walking the
+// keyspace with SCAN so redis is never blocked
+func (v *VoterCache) RebuildIndex(ctx context.Context) error {
+	iter := v.cacheClient.Scan(ctx, 0, RedisKeyPrefix+"*", RedisBatchSize).Iterator()
+
+	var members []redis.Z
+	flush := func() error {
+		if len(members) == 0 {
+			return nil
+		}
+		err := v.cacheClient.ZAdd(ctx, RedisIndexKey, members...).Err()
+		members = members[:0]
+		return err
+	}
+
+	for iter.Next(ctx) {
+		var voterId uint
+		if _, err := fmt.Sscanf(iter.Val(), RedisKeyPrefix+"%d", &voterId); err != nil {
+			continue
+		}
+		members = append(members, redis.Z{Score: float64(voterId), Member: voterId})
+		if len(members) == RedisBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// getItemFromRedis reads the voter document under key, a document of an
+// older schema version is upgraded and written back
+func (v *VoterCache) getItemFromRedis(ctx context.Context, key string, voter *Voter) error {
+	itemObject, err := v.json(ctx).JSONGet(key, ".")
+	if err != nil {
+		return err
+	}
+
+	var upgraded bool
+	*voter, upgraded, err = decodeVoterDocument(itemObject.([]byte))
+	if err != nil {
+		return err
+	}
+	if upgraded {
+		v.writeBackUpgrade(ctx, key)
+	}
+
+	return nil
+}
+
+// getVoterFromRedis maps a missing key to the same error the in-memory
+// store returns
+func (v *VoterCache) getVoterFromRedis(ctx context.Context, voterId uint) (Voter, error) {
+	var voter Voter
+	if err := v.getItemFromRedis(ctx, redisKeyFromId(int(voterId)), &voter); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return Voter{}, ErrVoterNotFound
+		}
+		return Voter{}, err
+	}
+
+	return voter, nil
+}
+
+// updateInRedis runs update on the JSON document stored under redisKey and
+// writes the result back in a MULTI guarded by WATCH, so a concurrent change
+// to the same document makes the transaction fail and the whole
+// read-modify-write is retried instead of one of the writes getting lost.
+// Writes queued by alsoWrite run in the same MULTI.
+func updateInRedis[T any](ctx context.Context, c *cache, redisKey string, notFound error, update func(item *T) error, alsoWrite ...func(pipe redis.Pipeliner)) error {
+	return updateInRedisIf(ctx, c, redisKey, notFound, redisPrecondition{}, update, alsoWrite...)
+}
+
+// redisPrecondition is checked by updateInRedisIf before the document is
+// read, the keys check reads are watched along with the document
+type redisPrecondition struct {
+	keys  []string
+	check func(tx *redis.Tx) error
+}
+
+// updateInRedisIf is updateInRedis that only updates while precondition
+// holds, a change to its keys retries the update like one to the document
+func updateInRedisIf[T any](ctx context.Context, c *cache, redisKey string, notFound error, precondition redisPrecondition, update func(item *T) error, alsoWrite ...func(pipe redis.Pipeliner)) error {
+	txf := func(tx *redis.Tx) error {
+		if precondition.check != nil {
+			if err := precondition.check(tx); err != nil {
+				return err
+			}
+		}
+
+		getCmd := redis.NewStringCmd(ctx, "JSON.GET", redisKey, ".")
+		_ = tx.Process(ctx, getCmd)
+		itemObject, err := getCmd.Result()
+		if errors.Is(err, redis.Nil) {
+			return notFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var item T
+		if err := json.Unmarshal([]byte(itemObject), &item); err != nil {
+			return err
+		}
+
+		if err := update(&item); err != nil {
+			return err
+		}
+
+		document, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Do(ctx, "JSON.SET", redisKey, ".", string(document))
+			for _, write := range alsoWrite {
+				write(pipe)
+			}
+			return nil
+		})
+		return err
+	}
+
+	return watchWithRetry(ctx, c, txf, append([]string{redisKey}, precondition.keys...)...)
+}
+
+// watchWithRetry runs txf with redisKeys watched until its MULTI goes
+// through, giving up after RedisTxMaxRetries attempts
+func watchWithRetry(ctx context.Context, c *cache, txf func(tx *redis.Tx) error, redisKeys ...string) error {
+	backoff := time.Millisecond
+	for i := 0; i < RedisTxMaxRetries; i++ {
+		err := c.cacheClient.Watch(ctx, txf, redisKeys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+
+		// back off with jitter so competing writers spread out
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(rand.Int63n(int64(backoff))) + backoff/2):
+		}
+		if backoff < redisTxMaxBackoff {
+			backoff *= 2
+		}
+	}
+
+	return fmt.Errorf("%s was changed concurrently, gave up after %d attempts", redisKeys[0], RedisTxMaxRetries)
+}
+
+// updateVoterDocument is updateInRedis for voter documents, the revision of
+// the voter goes up with every update that succeeds and the document is
+// written at the current schema version
+func updateVoterDocument(ctx context.Context, c *cache, voterId uint, update func(voter *Voter) error, alsoWrite ...func(pipe redis.Pipeliner)) error {
+	return updateVoterDocumentIf(ctx, c, voterId, redisPrecondition{}, update, alsoWrite...)
+}
+
+// updateVoterDocumentIf is updateVoterDocument guarded by precondition
+func updateVoterDocumentIf(ctx context.Context, c *cache, voterId uint, precondition redisPrecondition, update func(voter *Voter) error, alsoWrite ...func(pipe redis.Pipeliner)) error {
+	return updateInRedisIf(ctx, c, redisKeyFromId(int(voterId)), ErrVoterNotFound, precondition, func(document *voterDocument) error {
+		voter := (*Voter)(document)
+		if err := update(voter); err != nil {
+			return err
+		}
+		voter.Revision++
+		return nil
+	}, alsoWrite...)
+}
+
+func (v *VoterCache) updateVoterInRedis(ctx context.Context, voterId uint, update func(voter *Voter) error) error {
+	return updateVoterDocument(ctx, &v.cache, voterId, update)
+}
+
+// updateVoterPollInRedis is updateVoterInRedis for the history entry of
+// pollId guarded by check, once a PollCache shares the connection the poll
+// has to exist too and is watched so a concurrent delete retries the update
+func (v *VoterCache) updateVoterPollInRedis(ctx context.Context, voterId uint, pollId uint, check func(tx *redis.Tx) error, update func(voter *Voter) error) error {
+	precondition := redisPrecondition{check: check}
+	if v.requirePolls {
+		pollKey := redisPollKeyFromId(pollId)
+		precondition.keys = []string{pollKey}
+		precondition.check = func(tx *redis.Tx) error {
+			exists, err := tx.Exists(ctx, pollKey).Result()
+			if err != nil {
+				return err
+			}
+			if exists == 0 {
+				return ErrPollNotFound
+			}
+			if check != nil {
+				return check(tx)
+			}
+			return nil
+		}
+	}
+	return updateVoterDocumentIf(ctx, &v.cache, voterId, precondition, update)
+}
+
+func (v *VoterCache) AddVoter(ctx context.Context, voter Voter) error {
+	if err := voter.ValidateNew(); err != nil {
+		return err
+	}
+
+	voter.Revision = FirstRevision
+	document, err := json.Marshal(voterDocument(voter))
+	if err != nil {
+		return err
+	}
+
+	//Add item to database with JSON Set, NX makes the existence check and
+	//the write a single atomic command. Indexing an existing voter again is
+	//harmless so both run in one MULTI.
+	var setCmd *redis.Cmd
+	_, err = v.cacheClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		setCmd = pipe.Do(ctx, "JSON.SET", redisKeyFromId(int(voter.VoterId)), ".", string(document), "NX")
+		pipe.ZAdd(ctx, RedisIndexKey, redis.Z{Score: float64(voter.VoterId), Member: voter.VoterId})
+		return nil
+	})
+	if errors.Is(setCmd.Err(), redis.Nil) {
+		return ErrVoterExists
+	}
+
+	return err
+}
+
+func (v *VoterCache) GetVoter(ctx context.Context, voterId uint) (Voter, error) {
+	return v.getVoterFromRedis(ctx, voterId)
+}
+
+// getVotersFromRedis fetches the documents of voterIds with a single
+// JSON.MGET, voters deleted in the meantime are skipped
+func (v *VoterCache) getVotersFromRedis(ctx context.Context, voterIds []string) ([]Voter, error) {
+	if len(voterIds) == 0 {
+		return []Voter{}, nil
+	}
+
+	keys := make([]string, len(voterIds))
+	for i, voterId := range voterIds {
+		keys[i] = RedisKeyPrefix + voterId
+	}
+
+	items, err := v.json(ctx).JSONMGet(".", keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	voters := make([]Voter, 0, len(voterIds))
+	for i, item := range items.([]interface{}) {
+		if item == nil {
+			continue
+		}
+		voter, upgraded, err := decodeVoterDocument(item.([]byte))
+		if err != nil {
+			return nil, err
+		}
+		if upgraded {
+			v.writeBackUpgrade(ctx, keys[i])
+		}
+		voters = append(voters, voter)
+	}
+
+	return voters, nil
+}
+
+// forEachVoter walks the index by score in batches of RedisBatchSize, so
+// voters come in voterId order and each batch is a single round trip
+func (v *VoterCache) forEachVoter(ctx context.Context, fn func(voter Voter)) error {
+	start := "-inf"
+	for {
+		voterIds, err := v.cacheClient.ZRangeArgs(ctx, redis.ZRangeArgs{
+			Key:     RedisIndexKey,
+			Start:   start,
+			Stop:    "+inf",
+			ByScore: true,
+			Count:   RedisBatchSize,
+		}).Result()
+		if err != nil {
+			return err
+		}
+
+		voters, err := v.getVotersFromRedis(ctx, voterIds)
+		if err != nil {
+			return err
+		}
+		for _, voter := range voters {
+			fn(voter)
+		}
+
+		if len(voterIds) < RedisBatchSize {
+			return nil
+		}
+		start = "(" + voterIds[len(voterIds)-1]
+	}
+}
+
+// GetAllVoters returns voters ordered by voterId
+func (v *VoterCache) GetAllVoters(ctx context.Context) []Voter {
+	var voters []Voter
+	err := v.forEachVoter(ctx, func(voter Voter) {
+		voters = append(voters, voter)
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "getting voters from redis failed", "err", err)
+	}
+
+	return voters
+}
+
+// QueryVoters reads a page straight off the index when voters are listed by
+// voterId without filters. Any other query is answered by walking the index
+// and reading every voter document into memory to filter and sort them, so
+// it costs O(n) round trips of RedisBatchSize and O(n) memory for n voters
+// however small the page is; redis keeps no index on name, email or vote
+// history to push them down to.
+func (v *VoterCache) QueryVoters(ctx context.Context, query VoterQuery) (VoterPage, error) {
+	if err := query.Validate(); err != nil {
+		return VoterPage{}, err
+	}
+
+	if query.HasFilter() || (query.SortBy != "" && query.SortBy != SortByVoterId) {
+		matching := []Voter{}
+		err := v.forEachVoter(ctx, func(voter Voter) {
+			if query.Matches(voter) {
+				matching = append(matching, voter)
+			}
+		})
+		if err != nil {
+			return VoterPage{}, err
+		}
+		return query.page(matching), nil
+	}
+
+	total, err := v.cacheClient.ZCard(ctx, RedisIndexKey).Result()
+	if err != nil {
+		return VoterPage{}, err
+	}
+
+	page := VoterPage{Voters: []Voter{}, Total: int(total), Offset: query.Offset, Limit: query.Limit}
+	if query.Offset >= page.Total {
+		return page, nil
+	}
+
+	stop := int64(-1)
+	if query.Limit > 0 {
+		stop = int64(query.Offset + query.Limit - 1)
+	}
+	voterIds, err := v.cacheClient.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:   RedisIndexKey,
+		Start: query.Offset,
+		Stop:  stop,
+		Rev:   query.Descending,
+	}).Result()
+	if err != nil {
+		return VoterPage{}, err
+	}
+
+	page.Voters, err = v.getVotersFromRedis(ctx, voterIds)
+	return page, err
+}
+
+// CountVoters counts the voter index
+func (v *VoterCache) CountVoters(ctx context.Context) (int, error) {
+	count, err := v.cacheClient.ZCard(ctx, RedisIndexKey).Result()
+	return int(count), err
+}
+
+// DeleteAllVoters removes indexed voters batch by batch, then sweeps any
+// voter keys the index does not know about with SCAN
+func (v *VoterCache) DeleteAllVoters(ctx context.Context) {
+	for {
+		voterIds, err := v.cacheClient.ZRange(ctx, RedisIndexKey, 0, RedisBatchSize-1).Result()
+		if err != nil {
+			slog.ErrorContext(ctx, "getting voter index from redis failed", "err", err)
+			return
+		}
+		if len(voterIds) == 0 {
+			break
+		}
+
+		keys := make([]string, len(voterIds))
+		members := make([]interface{}, len(voterIds))
+		for i, voterId := range voterIds {
+			keys[i] = RedisKeyPrefix + voterId
+			members[i] = voterId
+		}
+
+		_, err = v.cacheClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, keys...)
+			pipe.ZRem(ctx, RedisIndexKey, members...)
+			return nil
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "deleting voters from redis failed", "err", err)
+			return
+		}
+	}
+
+	iter := v.cacheClient.Scan(ctx, 0, RedisKeyPrefix+"*", RedisBatchSize).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == RedisBatchSize {
+			if err := v.cacheClient.Del(ctx, keys...).Err(); err != nil {
+				slog.ErrorContext(ctx, "deleting voters from redis failed", "err", err)
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		slog.ErrorContext(ctx, "getting keys from redis failed", "err", err)
+	}
+	if len(keys) > 0 {
+		if err := v.cacheClient.Del(ctx, keys...).Err(); err != nil {
+			slog.ErrorContext(ctx, "deleting voters from redis failed", "err", err)
+		}
+	}
+}
+
+// UpdateVoter replaces name and email of the voter stored under voterId, the
+// vote history is left untouched as in the in-memory store
+func (v *VoterCache) UpdateVoter(ctx context.Context, voter Voter, voterId uint, ifRevision uint64) (Voter, error) {
+	var updatedVoter *Voter
+	err := v.updateVoterInRedis(ctx, voterId, func(existingItem *Voter) error {
+		if err := checkRevision(*existingItem, ifRevision); err != nil {
+			return err
+		}
+		if err := replaceVoter(existingItem, voter); err != nil {
+			return err
+		}
+
+		updatedVoter = existingItem
+		return nil
+	})
+	if err != nil {
+		return Voter{}, err
+	}
+
+	// updatedVoter is the document that was written, revision included
+	return *updatedVoter, nil
+}
+
+// PatchVoter runs patch inside the WATCH of updateInRedis, a retried
+// transaction patches the voter it read again
+func (v *VoterCache) PatchVoter(ctx context.Context, voterId uint, ifRevision uint64, patch VoterPatch) (Voter, error) {
+	var updatedVoter *Voter
+	err := v.updateVoterInRedis(ctx, voterId, func(existingItem *Voter) error {
+		if err := checkRevision(*existingItem, ifRevision); err != nil {
+			return err
+		}
+
+		current := *existingItem
+		current.VoteHistory = copyVoteHistory(existingItem.VoteHistory)
+		voter, err := patch(current)
+		if err != nil {
+			return err
+		}
+		if err := replaceVoter(existingItem, voter); err != nil {
+			return err
+		}
+
+		updatedVoter = existingItem
+		return nil
+	})
+	if err != nil {
+		return Voter{}, err
+	}
+
+	// updatedVoter is the document that was written, revision included
+	return *updatedVoter, nil
+}
+
+func (v *VoterCache) DeleteVoter(ctx context.Context, voterId uint, ifRevision uint64) error {
+	if ifRevision != 0 {
+		return v.deleteVoterAtRevision(ctx, voterId, ifRevision)
+	}
+
+	//DEL reports how many keys it removed, zero means the voter was missing
+	var delCmd *redis.IntCmd
+	_, err := v.cacheClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		delCmd = pipe.Del(ctx, redisKeyFromId(int(voterId)))
+		pipe.ZRem(ctx, RedisIndexKey, voterId)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if delCmd.Val() == 0 {
+		return ErrVoterNotFound
+	}
+
+	return nil
+}
+
+// deleteVoterAtRevision checks the revision of the voter under WATCH, so the
+// voter can not change between the check and the delete
+func (v *VoterCache) deleteVoterAtRevision(ctx context.Context, voterId uint, ifRevision uint64) error {
+	redisKey := redisKeyFromId(int(voterId))
+	txf := func(tx *redis.Tx) error {
+		getCmd := redis.NewStringCmd(ctx, "JSON.GET", redisKey, ".")
+		_ = tx.Process(ctx, getCmd)
+		itemObject, err := getCmd.Result()
+		if errors.Is(err, redis.Nil) {
+			return ErrVoterNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		voter, _, err := decodeVoterDocument([]byte(itemObject))
+		if err != nil {
+			return err
+		}
+		if err := checkRevision(voter, ifRevision); err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, redisKey)
+			pipe.ZRem(ctx, RedisIndexKey, voterId)
+			return nil
+		})
+		return err
+	}
+
+	return watchWithRetry(ctx, &v.cache, txf, redisKey)
+}
+
+func (v *VoterCache) GetVoterPolls(ctx context.Context, voterId uint) ([]VoterHistory, error) {
+	voter, err := v.getVoterFromRedis(ctx, voterId)
+	if err != nil {
+		return nil, err
+	}
+
+	return voter.VoteHistory, nil
+}
+
+func (v *VoterCache) AddVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint) error {
+	if err := voterPoll.Validate(); err != nil {
+		return err
+	}
+
+	return v.updateVoterPollInRedis(ctx, voterId, voterPoll.PollId, nil, func(voter *Voter) error {
+		for _, vh := range voter.VoteHistory {
+			if vh.PollId == voterPoll.PollId {
+				return ErrPollExists
+			}
+		}
+
+		voter.VoteHistory = append(voter.VoteHistory, voterPoll)
+		return nil
+	})
+}
+
+func (v *VoterCache) GetVoterPoll(ctx context.Context, voterId uint, pollId uint) (VoterHistory, error) {
+	voter, err := v.getVoterFromRedis(ctx, voterId)
+	if err != nil {
+		return VoterHistory{}, err
+	}
+
+	for _, vh := range voter.VoteHistory {
+		if vh.PollId == pollId {
+			return vh, nil
+		}
+	}
+
+	return VoterHistory{}, ErrPollNotFound
+}
+
+func (v *VoterCache) UpdateVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint, pollId uint) error {
+	voterPoll.PollId = pollId
+	if err := voterPoll.Validate(); err != nil {
+		return err
+	}
+
+	// the entry a ballot wrote keeps pointing at its vote
+	check := func(tx *redis.Tx) error {
+		return checkNotRecorded(ctx, tx, voterId, pollId)
+	}
+	return v.updateVoterPollInRedis(ctx, voterId, pollId, check, func(voter *Voter) error {
+		for i, vh := range voter.VoteHistory {
+			if vh.PollId == pollId {
+				voter.VoteHistory[i] = voterPoll
+				return nil
+			}
+		}
+
+		return ErrPollNotFound
+	})
+}
+
+func (v *VoterCache) DeleteVoterPoll(ctx context.Context, voterId uint, pollId uint) error {
+	precondition := redisPrecondition{
+		check: func(tx *redis.Tx) error {
+			return checkNotRecorded(ctx, tx, voterId, pollId)
+		},
+	}
+	return updateVoterDocumentIf(ctx, &v.cache, voterId, precondition, func(voter *Voter) error {
+		for i, vh := range voter.VoteHistory {
+			if vh.PollId == pollId {
+				voter.VoteHistory = append(voter.VoteHistory[:i], voter.VoteHistory[i+1:]...)
+				return nil
+			}
+		}
+
+		return ErrPollNotFound
+	})
+}
+
+// checkNotRecorded fails with ErrVoteRecorded when the history entry of
+// voterId for pollId was written by casting a vote. CastVote writes the
+// vote together with the voter document, which the transaction watches.
+func checkNotRecorded(ctx context.Context, tx *redis.Tx, voterId uint, pollId uint) error {
+	var voter Voter
+	if err := getInTx(ctx, tx, redisKeyFromId(int(voterId)), &voter); err != nil {
+		return ignoreNil(err)
+	}
+
+	for _, vh := range voter.VoteHistory {
+		if vh.PollId != pollId || vh.VoteId == 0 {
+			continue
+		}
+
+		var vote Vote
+		if err := getInTx(ctx, tx, redisVoteKeyFromId(vh.VoteId), &vote); err != nil {
+			return ignoreNil(err)
+		}
+		if recordsVote(vote, voterId, vh) {
+			return ErrVoteRecorded
+		}
+	}
+	return nil
+}
+
+// getInTx reads the JSON document under redisKey into item on the
+// connection of tx, redis.Nil when there is none
+func getInTx(ctx context.Context, tx *redis.Tx, redisKey string, item any) error {
+	getCmd := redis.NewStringCmd(ctx, "JSON.GET", redisKey, ".")
+	_ = tx.Process(ctx, getCmd)
+	itemObject, err := getCmd.Result()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(itemObject), item)
+}
+
+// ignoreNil drops redis.Nil, a missing document is reported by whoever
+// reads it next
+func ignoreNil(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
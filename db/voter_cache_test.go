@@ -0,0 +1,422 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestVoterCache connects to REDIS_URL when it is set, otherwise to an
+// in-process redis stand-in
+func newTestVoterCache(t *testing.T) *db.VoterCache {
+	location := os.Getenv("REDIS_URL")
+	if location == "" {
+		location = testutils.NewRedisStandIn(t)
+	}
+
+	voterCache, err := db.NewWithCacheInstance(location)
+	assert.Nil(t, err)
+	assert.Nil(t, voterCache.Ping(ctx))
+
+	voterCache.DeleteAllVoters(ctx)
+	return voterCache
+}
+
+func TestVoterCacheAddVoter(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	voter2 := testutils.NewRandVoter(2)
+
+	// Test adding a new voter
+	err := voterCache.AddVoter(ctx, voter1)
+	assert.Nil(t, err)
+
+	voterFromRedis, _ := voterCache.GetVoter(ctx, voter1.VoterId)
+	assert.Equal(t, testutils.AsAdded(voter1), voterFromRedis)
+
+	// Test adding another new voter
+	err = voterCache.AddVoter(ctx, voter2)
+	assert.Nil(t, err)
+	voterFromRedis, _ = voterCache.GetVoter(ctx, voter2.VoterId)
+	assert.Equal(t, testutils.AsAdded(voter2), voterFromRedis)
+
+	// Test adding an existing voter
+	err = voterCache.AddVoter(ctx, voter1)
+	assert.NotNil(t, err)
+	assert.Equal(t, "voter already exists", err.Error())
+}
+
+func TestVoterCacheGetVoter(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	voter2 := testutils.NewRandVoter(2)
+
+	// Test getting a non-existent voter
+	voterItem, err := voterCache.GetVoter(ctx, voter1.VoterId)
+	assert.NotNil(t, err)
+	assert.Equal(t, db.Voter{}, voterItem)
+
+	// Test getting an existing voter
+	voterCache.AddVoter(ctx, voter1)
+	voterCache.AddVoter(ctx, voter2)
+
+	voterFromRedis, err := voterCache.GetVoter(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, testutils.AsAdded(voter1), voterFromRedis)
+}
+
+func TestVoterCacheGetAllVoters(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	voter2 := testutils.NewRandVoter(2)
+
+	// Test getting all voters
+	voterCache.AddVoter(ctx, voter1)
+	voterCache.AddVoter(ctx, voter2)
+
+	voters := voterCache.GetAllVoters(ctx)
+	assert.Equal(t, 2, len(voters))
+	assert.Contains(t, voters, testutils.AsAdded(voter1))
+	assert.Contains(t, voters, testutils.AsAdded(voter2))
+}
+
+func TestVoterCacheDeleteAllVoters(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	voter2 := testutils.NewRandVoter(2)
+
+	// Test deleting all voters
+	voterCache.AddVoter(ctx, voter1)
+	voterCache.AddVoter(ctx, voter2)
+
+	voterCache.DeleteAllVoters(ctx)
+	voters := voterCache.GetAllVoters(ctx)
+	assert.Equal(t, 0, len(voters))
+}
+
+func TestVoterCacheUpdateVoter(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	voter2 := testutils.NewRandVoter(2)
+
+	// Updating voter2 to have the same voterId as voter1
+	voter2.VoterId = voter1.VoterId
+
+	// Test updating a non-existent voter
+	_, err := voterCache.UpdateVoter(ctx, voter1, voter1.VoterId, 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, "voter does not exist", err.Error())
+
+	// Test updating an existing voter
+	voterCache.AddVoter(ctx, voter1)
+	_, err = voterCache.UpdateVoter(ctx, voter2, voter1.VoterId, 0)
+	assert.Nil(t, err)
+
+	// Get the updated voter
+	voter, _ := voterCache.GetVoter(ctx, voter1.VoterId)
+	assert.Equal(t, voter2.Name, voter.Name)
+	assert.Equal(t, voter2.Email, voter.Email)
+}
+
+func TestVoterCacheDeleteVoter(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	voter2 := testutils.NewRandVoter(2)
+
+	// Test deleting a non-existent voter
+	err := voterCache.DeleteVoter(ctx, voter1.VoterId, 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, "voter does not exist", err.Error())
+
+	// Test deleting an existing voter
+	voterCache.AddVoter(ctx, voter1)
+	voterCache.AddVoter(ctx, voter2)
+	err = voterCache.DeleteVoter(ctx, voter1.VoterId, 0)
+	assert.Nil(t, err)
+
+	// Get all voters
+	voters := voterCache.GetAllVoters(ctx)
+
+	assert.Equal(t, 1, len(voters))
+	assert.NotContains(t, voters, voter1.VoterId)
+}
+
+func TestVoterCacheAddVoterPoll(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	poll1 := testutils.NewRandPollVoteRecord(1)
+
+	// Test adding a poll to a non-existent voter
+	err := voterCache.AddVoterPoll(ctx, poll1, voter1.VoterId)
+	assert.NotNil(t, err)
+
+	// Test adding a poll to an existing voter
+	voterCache.AddVoter(ctx, voter1)
+	err = voterCache.AddVoterPoll(ctx, poll1, voter1.VoterId)
+	assert.Nil(t, err)
+
+	// Test adding same poll to an existing voter with existing polls
+	err = voterCache.AddVoterPoll(ctx, poll1, voter1.VoterId)
+	assert.NotNil(t, err)
+	assert.Equal(t, "poll already exists", err.Error())
+
+	// Get the voter
+	voter, _ := voterCache.GetVoter(ctx, voter1.VoterId)
+	assert.Equal(t, 1, len(voter.VoteHistory))
+	assert.Contains(t, voter.VoteHistory, poll1)
+}
+
+func TestVoterCacheGetVoterPoll(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	poll1 := testutils.NewRandPollVoteRecord(1)
+
+	// Test getting a poll for a non-existent voter
+	_, err := voterCache.GetVoterPoll(ctx, poll1.PollId, voter1.VoterId)
+	assert.NotNil(t, err)
+
+	// Test getting a poll for an existing voter with no polls
+	voterCache.AddVoter(ctx, voter1)
+	_, err = voterCache.GetVoterPoll(ctx, poll1.PollId, voter1.VoterId)
+	assert.NotNil(t, err)
+	assert.Equal(t, "poll does not exist", err.Error())
+
+	// test getting a poll for an existing voter with polls
+	voterCache.AddVoterPoll(ctx, poll1, voter1.VoterId)
+
+	voterPoll, err := voterCache.GetVoterPoll(ctx, poll1.PollId, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, poll1, voterPoll)
+}
+
+func TestVoterCacheGetVoterPolls(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	poll1 := testutils.NewRandPollVoteRecord(1)
+
+	// Test getting polls for a non-existent voter
+	_, err := voterCache.GetVoterPolls(ctx, voter1.VoterId)
+	assert.NotNil(t, err)
+
+	// Test getting polls for an existing voter
+	voterCache.AddVoter(ctx, voter1)
+	voterCache.AddVoterPoll(ctx, poll1, voter1.VoterId)
+
+	voterPolls, err := voterCache.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(voterPolls))
+	assert.Contains(t, voterPolls, poll1)
+}
+
+func TestVoterCacheDeleteVoterPoll(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	poll1 := testutils.NewRandPollVoteRecord(1)
+
+	// Test deleting polls for a non-existent voter
+	err := voterCache.DeleteVoterPoll(ctx, poll1.PollId, voter1.VoterId)
+	assert.NotNil(t, err)
+
+	// Test deleting polls for an existing voter with no polls
+	voterCache.AddVoter(ctx, voter1)
+	err = voterCache.DeleteVoterPoll(ctx, poll1.PollId, voter1.VoterId)
+	assert.NotNil(t, err)
+	assert.Equal(t, "poll does not exist", err.Error())
+
+	// test deleting polls for an existing voter with polls
+	voterCache.AddVoterPoll(ctx, poll1, voter1.VoterId)
+	err = voterCache.DeleteVoterPoll(ctx, poll1.PollId, voter1.VoterId)
+	assert.Nil(t, err)
+
+	// Get the voter
+	voter, _ := voterCache.GetVoter(ctx, voter1.VoterId)
+	assert.Equal(t, 0, len(voter.VoteHistory))
+	assert.NotContains(t, voter.VoteHistory, poll1)
+}
+
+func TestVoterCacheUpdateVoterPoll(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	poll1 := testutils.NewRandPollVoteRecord(1)
+	poll2 := testutils.NewRandPollVoteRecord(2)
+
+	// Test updating polls for a non-existent voter
+	err := voterCache.UpdateVoterPoll(ctx, poll1, voter1.VoterId, poll1.PollId)
+	assert.NotNil(t, err)
+
+	// Test updating polls for an existing voter with no polls
+	voterCache.AddVoter(ctx, voter1)
+	err = voterCache.UpdateVoterPoll(ctx, poll1, voter1.VoterId, poll1.PollId)
+	assert.NotNil(t, err)
+	assert.Equal(t, "poll does not exist", err.Error())
+
+	// test updating polls for an existing voter with polls
+	voterCache.AddVoterPoll(ctx, poll1, voter1.VoterId)
+	err = voterCache.UpdateVoterPoll(ctx, poll2, voter1.VoterId, poll1.PollId)
+	assert.Nil(t, err)
+
+	// Get the voter
+	voter, _ := voterCache.GetVoter(ctx, voter1.VoterId)
+	assert.Equal(t, 1, len(voter.VoteHistory))
+	poll2.PollId = poll1.PollId
+	assert.Contains(t, voter.VoteHistory, poll2)
+}
+
+func TestVoterCacheConcurrentAddVoterPoll(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	voterCache.AddVoter(ctx, voter1)
+
+	// every poll added concurrently to the same voter has to survive
+	const polls = 30
+	var wg sync.WaitGroup
+	for pollId := uint(1); pollId <= polls; pollId++ {
+		wg.Add(1)
+		go func(pollId uint) {
+			defer wg.Done()
+			assert.Nil(t, voterCache.AddVoterPoll(ctx, testutils.NewRandPollVoteRecord(pollId), voter1.VoterId))
+		}(pollId)
+	}
+	wg.Wait()
+
+	voterPolls, err := voterCache.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, polls, len(voterPolls))
+}
+
+func TestVoterCacheConcurrentPollHistory(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	voter1 := testutils.NewRandVoter(1)
+	voterCache.AddVoter(ctx, voter1)
+
+	// polls 1..20 exist up front, odd ones get deleted and even ones updated
+	// while polls 21..40 are added and the name is changed
+	updates := map[uint]db.VoterHistory{}
+	for pollId := uint(1); pollId <= 20; pollId++ {
+		voterCache.AddVoterPoll(ctx, testutils.NewRandPollVoteRecord(pollId), voter1.VoterId)
+		updates[pollId] = testutils.NewRandPollVoteRecord(pollId)
+	}
+
+	var wg sync.WaitGroup
+	for pollId := uint(1); pollId <= 20; pollId++ {
+		wg.Add(2)
+		go func(pollId uint) {
+			defer wg.Done()
+			if pollId%2 == 1 {
+				assert.Nil(t, voterCache.DeleteVoterPoll(ctx, voter1.VoterId, pollId))
+			} else {
+				assert.Nil(t, voterCache.UpdateVoterPoll(ctx, updates[pollId], voter1.VoterId, pollId))
+			}
+		}(pollId)
+		go func(pollId uint) {
+			defer wg.Done()
+			assert.Nil(t, voterCache.AddVoterPoll(ctx, testutils.NewRandPollVoteRecord(pollId), voter1.VoterId))
+		}(pollId + 20)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := voterCache.UpdateVoter(ctx, testutils.NewRandVoter(1), voter1.VoterId, 0)
+		assert.Nil(t, err)
+	}()
+	wg.Wait()
+
+	voterPolls, err := voterCache.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, 30, len(voterPolls))
+	for pollId := uint(2); pollId <= 20; pollId += 2 {
+		assert.Contains(t, voterPolls, updates[pollId])
+	}
+}
+
+func TestVoterCacheConcurrentAddVoter(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	// only one of the clients adding the same voter can win
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	added := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if voterCache.AddVoter(ctx, testutils.NewRandVoter(1)) == nil {
+				mu.Lock()
+				added++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, added)
+}
+
+func TestVoterCacheGetAllVotersBatches(t *testing.T) {
+	voterCache := newTestVoterCache(t)
+
+	// more voters than fit in a single batch, added out of order
+	voterCount := db.RedisBatchSize*2 + 7
+	for voterId := voterCount; voterId > 0; voterId-- {
+		assert.Nil(t, voterCache.AddVoter(ctx, testutils.NewRandVoter(uint(voterId))))
+	}
+
+	voters := voterCache.GetAllVoters(ctx)
+	assert.Equal(t, voterCount, len(voters))
+	for i, voter := range voters {
+		assert.Equal(t, uint(i+1), voter.VoterId)
+	}
+
+	voterCache.DeleteAllVoters(ctx)
+	assert.Empty(t, voterCache.GetAllVoters(ctx))
+}
+
+func TestVoterCacheRebuildIndex(t *testing.T) {
+	location := testutils.NewRedisStandIn(t)
+
+	// voters written before the index existed
+	client := redis.NewClient(&redis.Options{Addr: location})
+	defer client.Close()
+	legacyVoters := []db.Voter{testutils.NewRandVoter(3), testutils.NewRandVoter(1)}
+	for _, voter := range legacyVoters {
+		document, _ := json.Marshal(voter)
+		err := client.Do(context.Background(), "JSON.SET", fmt.Sprintf("%s%d", db.RedisKeyPrefix, voter.VoterId), ".", string(document)).Err()
+		assert.Nil(t, err)
+	}
+
+	// connecting builds the index, the documents are upgraded on the way
+	voterCache, err := db.NewWithCacheInstance(location)
+	assert.Nil(t, err)
+	assert.Equal(t, []db.Voter{testutils.AsAdded(legacyVoters[1]), testutils.AsAdded(legacyVoters[0])}, voterCache.GetAllVoters(ctx))
+
+	// keys missing from the index are still removed by DeleteAllVoters
+	voter2 := testutils.NewRandVoter(2)
+	document, _ := json.Marshal(voter2)
+	client.Do(context.Background(), "JSON.SET", fmt.Sprintf("%s%d", db.RedisKeyPrefix, voter2.VoterId), ".", string(document))
+
+	voterCache.DeleteAllVoters(ctx)
+	keys, err := client.Keys(context.Background(), "*").Result()
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
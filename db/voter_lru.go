@@ -0,0 +1,256 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// CacheStats counts how the VoterLRU has been doing since it was created
+type CacheStats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+	Size          int    `json:"size"`
+	Bypassed      bool   `json:"bypassed"`
+}
+
+type lruEntry struct {
+	voter   Voter
+	expires time.Time
+}
+
+// VoterLRU is a read-through cache of up to size voters in front of any
+// VoterStore. GetVoter and the vote history reads are answered from it,
+// every write through it drops the voter it touched. Writes that reach the
+// store some other way, a vote cast or another replica, have to call
+// Invalidate, see WrapVoteStore and VoterCache.WatchVoterChanges.
+type VoterLRU struct {
+	VoterStore
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[uint]*list.Element
+	order   *list.List //front is the most recently used voter
+	stats   CacheStats
+	// generation goes up with every invalidation, a voter read from the
+	// store is only cached if none happened while it was being read
+	generation uint64
+	// bypassed sends every read to the store, see SetBypassed
+	bypassed bool
+}
+
+var _ VoterStore = (*VoterLRU)(nil)
+
+// NewVoterLRU caches up to size voters of store for ttl each, a ttl of 0
+// keeps them until they are evicted or invalidated
+func NewVoterLRU(store VoterStore, size int, ttl time.Duration) *VoterLRU {
+	return &VoterLRU{
+		VoterStore: store,
+		size:       size,
+		ttl:        ttl,
+		entries:    make(map[uint]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Stats returns the counters so far
+func (c *VoterLRU) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.order.Len()
+	stats.Bypassed = c.bypassed
+	return stats
+}
+
+// SetBypassed turns the cache off while changes made elsewhere can not be
+// told about, reads go to the store and nothing is cached. Turning it back
+// on starts with an empty cache.
+func (c *VoterLRU) SetBypassed(bypassed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.bypassed = bypassed
+	c.generation++
+	c.entries = make(map[uint]*list.Element)
+	c.order.Init()
+}
+
+// Invalidate drops the voter from the cache
+func (c *VoterLRU) Invalidate(voterId uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.stats.Invalidations++
+	if element, ok := c.entries[voterId]; ok {
+		c.order.Remove(element)
+		delete(c.entries, voterId)
+	}
+}
+
+// Purge drops every voter from the cache
+func (c *VoterLRU) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.stats.Invalidations++
+	c.entries = make(map[uint]*list.Element)
+	c.order.Init()
+}
+
+// lookup returns a copy of the cached voter, or the generation to fill the
+// cache with after a miss
+func (c *VoterLRU) lookup(voterId uint) (Voter, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[voterId]
+	if ok && !c.bypassed {
+		entry := element.Value.(*lruEntry)
+		if c.ttl == 0 || time.Now().Before(entry.expires) {
+			c.stats.Hits++
+			c.order.MoveToFront(element)
+			voter := entry.voter
+			voter.VoteHistory = copyVoteHistory(voter.VoteHistory)
+			return voter, 0, true
+		}
+
+		c.order.Remove(element)
+		delete(c.entries, voterId)
+	}
+
+	c.stats.Misses++
+	return Voter{}, c.generation, false
+}
+
+// fill caches voter unless it was invalidated since generation
+func (c *VoterLRU) fill(voter Voter, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 || c.bypassed || generation != c.generation {
+		return
+	}
+
+	voter.VoteHistory = copyVoteHistory(voter.VoteHistory)
+	entry := &lruEntry{voter: voter, expires: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[voter.VoterId]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[voter.VoterId] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).voter.VoterId)
+		c.stats.Evictions++
+	}
+}
+
+func (c *VoterLRU) GetVoter(ctx context.Context, voterId uint) (Voter, error) {
+	voter, generation, ok := c.lookup(voterId)
+	if ok {
+		return voter, nil
+	}
+
+	voter, err := c.VoterStore.GetVoter(ctx, voterId)
+	if err != nil {
+		return Voter{}, err
+	}
+
+	c.fill(voter, generation)
+	return voter, nil
+}
+
+func (c *VoterLRU) GetVoterPolls(ctx context.Context, voterId uint) ([]VoterHistory, error) {
+	voter, err := c.GetVoter(ctx, voterId)
+	if err != nil {
+		return nil, err
+	}
+
+	return voter.VoteHistory, nil
+}
+
+func (c *VoterLRU) GetVoterPoll(ctx context.Context, voterId uint, pollId uint) (VoterHistory, error) {
+	voter, err := c.GetVoter(ctx, voterId)
+	if err != nil {
+		return VoterHistory{}, err
+	}
+
+	for _, vh := range voter.VoteHistory {
+		if vh.PollId == pollId {
+			return vh, nil
+		}
+	}
+
+	return VoterHistory{}, ErrPollNotFound
+}
+
+// the writes drop the voter once the store has it, so a read racing the
+// write either sees the new voter or is not cached
+
+func (c *VoterLRU) AddVoter(ctx context.Context, voter Voter) error {
+	defer c.Invalidate(voter.VoterId)
+	return c.VoterStore.AddVoter(ctx, voter)
+}
+
+func (c *VoterLRU) DeleteAllVoters(ctx context.Context) {
+	defer c.Purge()
+	c.VoterStore.DeleteAllVoters(ctx)
+}
+
+func (c *VoterLRU) UpdateVoter(ctx context.Context, voter Voter, voterId uint, ifRevision uint64) (Voter, error) {
+	defer c.Invalidate(voterId)
+	return c.VoterStore.UpdateVoter(ctx, voter, voterId, ifRevision)
+}
+
+func (c *VoterLRU) PatchVoter(ctx context.Context, voterId uint, ifRevision uint64, patch VoterPatch) (Voter, error) {
+	defer c.Invalidate(voterId)
+	return c.VoterStore.PatchVoter(ctx, voterId, ifRevision, patch)
+}
+
+func (c *VoterLRU) DeleteVoter(ctx context.Context, voterId uint, ifRevision uint64) error {
+	defer c.Invalidate(voterId)
+	return c.VoterStore.DeleteVoter(ctx, voterId, ifRevision)
+}
+
+func (c *VoterLRU) AddVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint) error {
+	defer c.Invalidate(voterId)
+	return c.VoterStore.AddVoterPoll(ctx, voterPoll, voterId)
+}
+
+func (c *VoterLRU) UpdateVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint, pollId uint) error {
+	defer c.Invalidate(voterId)
+	return c.VoterStore.UpdateVoterPoll(ctx, voterPoll, voterId, pollId)
+}
+
+func (c *VoterLRU) DeleteVoterPoll(ctx context.Context, voterId uint, pollId uint) error {
+	defer c.Invalidate(voterId)
+	return c.VoterStore.DeleteVoterPoll(ctx, voterId, pollId)
+}
+
+// lruVotes drops the voter a vote was cast by, the vote history and revision
+// of the voter changed underneath the cache
+type lruVotes struct {
+	VoteStore
+	lru *VoterLRU
+}
+
+// WrapVoteStore returns votes invalidating the voters it records history in
+func (c *VoterLRU) WrapVoteStore(votes VoteStore) VoteStore {
+	return lruVotes{VoteStore: votes, lru: c}
+}
+
+func (v lruVotes) CastVote(ctx context.Context, vote Vote) (Vote, error) {
+	defer v.lru.Invalidate(vote.VoterId)
+	return v.VoteStore.CastVote(ctx, vote)
+}
@@ -0,0 +1,256 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestVoterLRU(t *testing.T, size int, ttl time.Duration) (*db.VoterLRU, *db.VoterList) {
+	voterList, err := db.New()
+	if err != nil {
+		t.Fatalf("failed to create voter list: %v", err)
+	}
+	return db.NewVoterLRU(voterList, size, ttl), voterList
+}
+
+func TestVoterLRUConformance(t *testing.T) {
+	testutils.RunVoterStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore) {
+		voterLRU, voterList := newTestVoterLRU(t, 100, time.Minute)
+		pollList, _ := db.NewPollList(voterList)
+		return voterLRU, pollList
+	})
+	testutils.RunVoteStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore, db.VoteStore) {
+		voterLRU, voterList := newTestVoterLRU(t, 100, time.Minute)
+		pollList, _ := db.NewPollList(voterList)
+		voteList, _ := db.NewVoteList(voterList)
+		return voterLRU, pollList, voterLRU.WrapVoteStore(voteList)
+	})
+}
+
+func TestVoterLRUHitsAndMisses(t *testing.T) {
+	voterLRU, voterList := newTestVoterLRU(t, 10, time.Minute)
+	voter1 := testutils.NewRandVoter(1)
+	voterLRU.AddVoter(ctx, voter1)
+
+	for i := 0; i < 3; i++ {
+		voter, err := voterLRU.GetVoter(ctx, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, testutils.AsAdded(voter1), voter)
+	}
+	_, err := voterLRU.GetVoterPoll(ctx, 1, 1)
+	assert.ErrorIs(t, err, db.ErrPollNotFound)
+	_, err = voterLRU.GetVoter(ctx, 2)
+	assert.ErrorIs(t, err, db.ErrVoterNotFound)
+
+	stats := voterLRU.Stats()
+	assert.Equal(t, uint64(3), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, 1, stats.Size)
+
+	// a change behind the cache is only seen once the voter is invalidated
+	_, err = voterList.UpdateVoter(ctx, testutils.NewRandVoter(1), 1, 0)
+	assert.Nil(t, err)
+	voter, _ := voterLRU.GetVoter(ctx, 1)
+	assert.Equal(t, db.FirstRevision, voter.Revision)
+
+	voterLRU.Invalidate(1)
+	voter, _ = voterLRU.GetVoter(ctx, 1)
+	assert.Equal(t, uint64(2), voter.Revision)
+}
+
+func TestVoterLRUWritesInvalidate(t *testing.T) {
+	voterLRU, voterList := newTestVoterLRU(t, 10, time.Minute)
+	votes := voterLRU.WrapVoteStore(func() db.VoteStore {
+		voteList, _ := db.NewVoteList(voterList)
+		return voteList
+	}())
+	voterLRU.AddVoter(ctx, testutils.NewRandVoter(1))
+	voterLRU.GetVoter(ctx, 1)
+
+	poll1 := testutils.NewRandPollVoteRecord(1)
+	assert.Nil(t, voterLRU.AddVoterPoll(ctx, poll1, 1))
+	voterPolls, _ := voterLRU.GetVoterPolls(ctx, 1)
+	assert.Equal(t, []db.VoterHistory{poll1}, voterPolls)
+
+	_, err := votes.CastVote(ctx, db.Vote{VoterId: 1, PollId: 2, OptionId: 1})
+	assert.Nil(t, err)
+	voterPolls, _ = voterLRU.GetVoterPolls(ctx, 1)
+	assert.Len(t, voterPolls, 2)
+
+	assert.Nil(t, voterLRU.DeleteVoter(ctx, 1, 0))
+	_, err = voterLRU.GetVoter(ctx, 1)
+	assert.ErrorIs(t, err, db.ErrVoterNotFound)
+}
+
+func TestVoterLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	voterLRU, _ := newTestVoterLRU(t, 2, 0)
+	for voterId := uint(1); voterId <= 3; voterId++ {
+		voterLRU.AddVoter(ctx, testutils.NewRandVoter(voterId))
+	}
+
+	voterLRU.GetVoter(ctx, 1)
+	voterLRU.GetVoter(ctx, 2)
+	voterLRU.GetVoter(ctx, 1)
+	voterLRU.GetVoter(ctx, 3)
+
+	stats := voterLRU.Stats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Size)
+
+	// 2 was the least recently used
+	voterLRU.GetVoter(ctx, 1)
+	voterLRU.GetVoter(ctx, 2)
+	stats = voterLRU.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(4), stats.Misses)
+}
+
+func TestVoterLRUExpires(t *testing.T) {
+	voterLRU, _ := newTestVoterLRU(t, 10, 20*time.Millisecond)
+	voterLRU.AddVoter(ctx, testutils.NewRandVoter(1))
+
+	voterLRU.GetVoter(ctx, 1)
+	voterLRU.GetVoter(ctx, 1)
+	time.Sleep(40 * time.Millisecond)
+	voterLRU.GetVoter(ctx, 1)
+
+	stats := voterLRU.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+}
+
+func TestVoterLRUHistoryIsNotAliased(t *testing.T) {
+	voterLRU, _ := newTestVoterLRU(t, 10, time.Minute)
+	voterLRU.AddVoter(ctx, testutils.NewRandVoter(1))
+	poll1 := testutils.NewRandPollVoteRecord(1)
+	voterLRU.AddVoterPoll(ctx, poll1, 1)
+
+	voter, _ := voterLRU.GetVoter(ctx, 1)
+	voter.VoteHistory[0].PollId = 9
+
+	voterPolls, _ := voterLRU.GetVoterPolls(ctx, 1)
+	assert.Equal(t, []db.VoterHistory{poll1}, voterPolls)
+}
+
+func TestVoterCacheWatchVoterChanges(t *testing.T) {
+	location := testutils.NewRedisStandIn(t)
+	voterCache, err := db.NewWithCacheInstance(location)
+	assert.Nil(t, err)
+
+	changed := make(chan uint, 10)
+	stop, err := voterCache.WatchVoterChanges(ctx, func(voterId uint) { changed <- voterId }, func() {})
+	if err != nil {
+		t.Fatalf("failed to watch voter changes: %v", err)
+	}
+	defer stop()
+
+	// the stand-in sends no keyspace notifications, they are published the
+	// way redis would
+	client := redis.NewClient(&redis.Options{Addr: location})
+	defer client.Close()
+	ctx := context.Background()
+	client.Publish(ctx, "__keyspace@0__:"+db.RedisIndexKey, "zadd")
+	client.Publish(ctx, "__keyspace@0__:"+db.RedisPollKeyPrefix+"3", "json.set")
+	client.Publish(ctx, fmt.Sprintf("__keyspace@0__:%s%d", db.RedisKeyPrefix, 7), "json.set")
+
+	select {
+	case voterId := <-changed:
+		assert.Equal(t, uint(7), voterId)
+	case <-time.After(time.Second):
+		t.Fatal("no change was reported")
+	}
+	assert.Empty(t, changed)
+}
+
+func TestVoterLRUBypassed(t *testing.T) {
+	voterLRU, voterList := newTestVoterLRU(t, 10, time.Minute)
+	voter1 := testutils.NewRandVoter(1)
+	voterLRU.AddVoter(ctx, voter1)
+	voterLRU.GetVoter(ctx, 1)
+
+	// a bypassed cache answers from the store and keeps nothing
+	voterLRU.SetBypassed(true)
+	voterList.UpdateVoter(ctx, testutils.NewRandVoter(1), 1, 0)
+	stored, _ := voterList.GetVoter(ctx, 1)
+	voter, _ := voterLRU.GetVoter(ctx, 1)
+	assert.Equal(t, stored, voter)
+	stats := voterLRU.Stats()
+	assert.True(t, stats.Bypassed)
+	assert.Equal(t, 0, stats.Size)
+
+	voterLRU.SetBypassed(false)
+	voterLRU.GetVoter(ctx, 1)
+	voterLRU.GetVoter(ctx, 1)
+	stats = voterLRU.Stats()
+	assert.False(t, stats.Bypassed)
+	assert.Equal(t, 1, stats.Size)
+	assert.Equal(t, uint64(1), stats.Hits)
+}
+
+func TestVoterCacheKeepWatchingVoterChanges(t *testing.T) {
+	standIn := testutils.StartRedisStandIn(t)
+	voterCache, err := db.NewWithCacheInstance(standIn.Addr())
+	assert.Nil(t, err)
+
+	// the subscription is tried again until redis is back
+	standIn.Close()
+	changed := make(chan uint, 10)
+	watching := make(chan struct{})
+	failed := make(chan error, 100)
+	stop := voterCache.KeepWatchingVoterChanges(10*time.Millisecond, func(voterId uint) { changed <- voterId }, func() {},
+		func() { close(watching) }, func(err error) { failed <- err })
+	defer stop()
+
+	select {
+	case err := <-failed:
+		assert.NotNil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("no failed attempt was reported")
+	}
+	standIn.Restart()
+	select {
+	case <-watching:
+	case <-time.After(2 * db.RedisBreakerCooldown):
+		t.Fatal("voter changes were not watched after redis came back")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: standIn.Addr()})
+	defer client.Close()
+	client.Publish(ctx, fmt.Sprintf("__keyspace@0__:%s%d", db.RedisKeyPrefix, 7), "json.set")
+	select {
+	case voterId := <-changed:
+		assert.Equal(t, uint(7), voterId)
+	case <-time.After(time.Second):
+		t.Fatal("no change was reported")
+	}
+}
+
+func TestVoterCacheWatchVoterChangesReconnect(t *testing.T) {
+	standIn := testutils.StartRedisStandIn(t)
+	voterCache, err := db.NewWithCacheInstance(standIn.Addr())
+	assert.Nil(t, err)
+
+	missed := make(chan struct{}, 10)
+	stop, err := voterCache.WatchVoterChanges(ctx, func(uint) {}, func() { missed <- struct{}{} })
+	if err != nil {
+		t.Fatalf("failed to watch voter changes: %v", err)
+	}
+	defer stop()
+
+	// the subscription comes back on its own, what was published while it
+	// was down is reported as missed
+	standIn.Close()
+	standIn.Restart()
+	select {
+	case <-missed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reconnect was not reported")
+	}
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisKeyspaceEvents are the notify-keyspace-events classes WatchVoterChanges
+// needs, keyspace events (K) of every kind (A) including the JSON.* ones
+const RedisKeyspaceEvents = "KA"
+
+// enableKeyspaceEvents adds RedisKeyspaceEvents to the server config when
+// they are missing. Managed servers often refuse CONFIG, they have to be set
+// up with the events beforehand.
+func (v *VoterCache) enableKeyspaceEvents(ctx context.Context) {
+	config, err := v.cacheClient.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		slog.WarnContext(ctx, "reading notify-keyspace-events failed, voter changes of other replicas may go unnoticed", "err", err)
+		return
+	}
+
+	current := config["notify-keyspace-events"]
+	missing := ""
+	for _, class := range RedisKeyspaceEvents {
+		if !strings.ContainsRune(current, class) {
+			missing += string(class)
+		}
+	}
+	if missing == "" {
+		return
+	}
+
+	if err := v.cacheClient.ConfigSet(ctx, "notify-keyspace-events", current+missing).Err(); err != nil {
+		slog.WarnContext(ctx, "enabling notify-keyspace-events failed, voter changes of other replicas may go unnoticed", "err", err)
+	}
+}
+
+// WatchVoterChanges calls changed with the voterId of every voter document
+// that is written or removed, by this or any other client, as told by the
+// keyspace notifications of redis. Notifications sent while the connection
+// is down are lost, missed is called once it is subscribed again. The
+// returned func stops watching.
+func (v *VoterCache) WatchVoterChanges(ctx context.Context, changed func(voterId uint), missed func()) (func() error, error) {
+	v.enableKeyspaceEvents(ctx)
+
+	channelPrefix := fmt.Sprintf("__keyspace@%d__:%s", v.cacheClient.Options().DB, RedisKeyPrefix)
+	pubsub := v.cacheClient.PSubscribe(ctx, channelPrefix+"*")
+	// wait for the subscription so no change after this call is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	go func() {
+		for msg := range pubsub.ChannelWithSubscriptions() {
+			switch msg := msg.(type) {
+			case *redis.Message:
+				voterId, err := strconv.ParseUint(strings.TrimPrefix(msg.Channel, channelPrefix), 10, 32)
+				if err != nil {
+					continue
+				}
+				changed(uint(voterId))
+			case *redis.Subscription:
+				// subscribed again after a reconnect
+				missed()
+			}
+		}
+	}()
+
+	return pubsub.Close, nil
+}
+
+// KeepWatchingVoterChanges is WatchVoterChanges that does not give up when
+// the subscription can not be set up. Every failed attempt is passed to
+// failed and tried again after retry, watching is called once the changes
+// are watched. The returned func stops trying, or watching.
+func (v *VoterCache) KeepWatchingVoterChanges(retry time.Duration, changed func(voterId uint), missed func(), watching func(), failed func(err error)) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var stop func() error
+	go func() {
+		defer close(done)
+		for {
+			var err error
+			stop, err = v.WatchVoterChanges(ctx, changed, missed)
+			if err == nil {
+				watching()
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			failed(err)
+
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() error {
+		cancel()
+		<-done
+		if stop == nil {
+			return nil
+		}
+		return stop()
+	}
+}
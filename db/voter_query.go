@@ -0,0 +1,121 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+const (
+	SortByVoterId = "voterId"
+	SortByName    = "name"
+	SortByEmail   = "email"
+
+	// DefaultVoterQueryLimit is the page size when a client does not ask for
+	// one, MaxVoterQueryLimit caps the page size a client can ask for
+	DefaultVoterQueryLimit = 100
+	MaxVoterQueryLimit     = 1000
+)
+
+// VoterQuery selects a page of voters. Zero values mean no filter, Limit 0
+// means every matching voter.
+type VoterQuery struct {
+	Limit  int
+	Offset int
+	// SortBy is one of the SortBy constants, voterId when empty
+	SortBy     string
+	Descending bool
+
+	NameContains string //case insensitive substring of the name
+	Email        string //case insensitive exact email
+	VotedInPoll  uint   //only voters with this poll in their history
+}
+
+// VoterPage is one page of a VoterQuery, Total counts every matching voter
+type VoterPage struct {
+	Voters []Voter
+	Total  int
+	Offset int
+	Limit  int
+}
+
+func (q VoterQuery) Validate() error {
+	switch q.SortBy {
+	case "", SortByVoterId, SortByName, SortByEmail:
+	default:
+		return errors.New("sort must be one of voterId, name or email")
+	}
+	if q.Limit < 0 || q.Limit > MaxVoterQueryLimit {
+		return errors.New("limit must be between 0 and 1000")
+	}
+	if q.Offset < 0 {
+		return errors.New("offset must not be negative")
+	}
+
+	return nil
+}
+
+// HasFilter reports whether the query narrows down the voters at all
+func (q VoterQuery) HasFilter() bool {
+	return q.NameContains != "" || q.Email != "" || q.VotedInPoll != 0
+}
+
+// Matches reports whether voter passes every filter of the query
+func (q VoterQuery) Matches(voter Voter) bool {
+	if q.NameContains != "" && !strings.Contains(strings.ToLower(voter.Name), strings.ToLower(q.NameContains)) {
+		return false
+	}
+	if q.Email != "" && !strings.EqualFold(voter.Email, q.Email) {
+		return false
+	}
+	if q.VotedInPoll != 0 {
+		for _, vh := range voter.VoteHistory {
+			if vh.PollId == q.VotedInPoll {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// sortVoters orders voters in place as requested, ties are broken by voterId
+// so every page of a query is stable
+func (q VoterQuery) sortVoters(voters []Voter) {
+	key := func(voter Voter) string {
+		switch q.SortBy {
+		case SortByName:
+			return strings.ToLower(voter.Name)
+		case SortByEmail:
+			return strings.ToLower(voter.Email)
+		}
+		return ""
+	}
+
+	sort.SliceStable(voters, func(i, j int) bool {
+		a, b := voters[i], voters[j]
+		if ka, kb := key(a), key(b); ka != kb {
+			return (ka < kb) != q.Descending
+		}
+		return (a.VoterId < b.VoterId) != q.Descending
+	})
+}
+
+// page sorts the matching voters and cuts out the requested page
+func (q VoterQuery) page(matching []Voter) VoterPage {
+	q.sortVoters(matching)
+
+	page := VoterPage{Total: len(matching), Offset: q.Offset, Limit: q.Limit}
+	if q.Offset >= len(matching) {
+		page.Voters = []Voter{}
+		return page
+	}
+
+	end := len(matching)
+	if q.Limit > 0 && q.Offset+q.Limit < end {
+		end = q.Offset + q.Limit
+	}
+	page.Voters = matching[q.Offset:end]
+	return page
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// VoterSchemaVersion is the schemaVersion written into every voter document
+// in redis. Documents without one are version 1, the original VoterItem
+// shape.
+const VoterSchemaVersion = 2
+
+// voterUpgrade turns a voter document of the version before into one of
+// version. Upgrades work on the raw fields so they do not depend on how
+// Voter looks today, and are never edited once released.
+type voterUpgrade struct {
+	version     int
+	description string
+	upgrade     func(document map[string]json.RawMessage) error
+}
+
+var voterUpgrades = []voterUpgrade{
+	{2, "voters carry a revision", func(document map[string]json.RawMessage) error {
+		var revision uint64
+		if raw, ok := document["revision"]; ok {
+			if err := json.Unmarshal(raw, &revision); err != nil {
+				return err
+			}
+		}
+		if revision == 0 {
+			document["revision"] = json.RawMessage(fmt.Sprint(FirstRevision))
+		}
+		return nil
+	}},
+}
+
+// voterDocument is how a Voter is stored in redis, the schemaVersion stays
+// out of the API
+type voterDocument Voter
+
+func (d voterDocument) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Voter
+		SchemaVersion int `json:"schemaVersion"`
+	}{Voter(d), VoterSchemaVersion})
+}
+
+func (d *voterDocument) UnmarshalJSON(data []byte) error {
+	voter, _, err := decodeVoterDocument(data)
+	*d = voterDocument(voter)
+	return err
+}
+
+// decodeVoterDocument reads a voter document of any known schema version and
+// reports whether it had to be upgraded on the way
+func decodeVoterDocument(data []byte) (Voter, bool, error) {
+	var versioned struct {
+		Voter
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &versioned); err != nil {
+		return Voter{}, false, err
+	}
+
+	version := versioned.SchemaVersion
+	if version == 0 {
+		version = 1
+	}
+	if version > VoterSchemaVersion {
+		return Voter{}, false, fmt.Errorf("voter document has schema version %d, this build only knows up to %d", version, VoterSchemaVersion)
+	}
+	if version == VoterSchemaVersion {
+		return versioned.Voter, false, nil
+	}
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil {
+		return Voter{}, false, err
+	}
+	for _, upgrade := range voterUpgrades {
+		if upgrade.version <= version {
+			continue
+		}
+		if err := upgrade.upgrade(document); err != nil {
+			return Voter{}, false, fmt.Errorf("upgrading voter document to schema version %d (%s): %w", upgrade.version, upgrade.description, err)
+		}
+	}
+
+	upgraded, err := json.Marshal(document)
+	if err != nil {
+		return Voter{}, false, err
+	}
+	var voter Voter
+	if err := json.Unmarshal(upgraded, &voter); err != nil {
+		return Voter{}, false, err
+	}
+	return voter, true, nil
+}
+
+// upgradeVoterDocument writes the document under redisKey back at the
+// current schema version, under WATCH so a write that came in since it was
+// read is not overwritten. It reports whether there was anything to upgrade.
+func upgradeVoterDocument(ctx context.Context, c *cache, redisKey string) (bool, error) {
+	upgraded := false
+	txf := func(tx *redis.Tx) error {
+		upgraded = false
+		getCmd := redis.NewStringCmd(ctx, "JSON.GET", redisKey, ".")
+		_ = tx.Process(ctx, getCmd)
+		itemObject, err := getCmd.Result()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		voter, outdated, err := decodeVoterDocument([]byte(itemObject))
+		if err != nil || !outdated {
+			return err
+		}
+		document, err := json.Marshal(voterDocument(voter))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Do(ctx, "JSON.SET", redisKey, ".", string(document), "XX")
+			return nil
+		})
+		upgraded = err == nil
+		return err
+	}
+
+	err := watchWithRetry(ctx, c, txf, redisKey)
+	return upgraded, err
+}
+
+// writeBackUpgrade stores a voter that was upgraded on read, a failure only
+// means the next read upgrades it again
+func (v *VoterCache) writeBackUpgrade(ctx context.Context, redisKey string) {
+	if _, err := upgradeVoterDocument(ctx, &v.cache, redisKey); err != nil {
+		slog.WarnContext(ctx, "writing back upgraded voter document failed", "key", redisKey, "err", err)
+	}
+}
+
+// MigrationProgress counts the voter documents MigrateVoters went through
+type MigrationProgress struct {
+	Scanned  int `json:"scanned"`
+	Upgraded int `json:"upgraded"`
+	Failed   int `json:"failed"`
+	// Total is the size of the voter index when the migration started,
+	// documents missing from the index are scanned too
+	Total int `json:"total"`
+}
+
+// MigrateVoters upgrades every voter:<id> document to VoterSchemaVersion,
+// walking the keyspace with SCAN. progress is called after every batch of
+// RedisBatchSize keys. A dry run only counts the documents that would be
+// upgraded. Documents that can not be read are counted as failed and left
+// alone.
+func (v *VoterCache) MigrateVoters(ctx context.Context, dryRun bool, progress func(MigrationProgress)) (MigrationProgress, error) {
+	var report MigrationProgress
+	total, err := v.cacheClient.ZCard(ctx, RedisIndexKey).Result()
+	if err != nil {
+		return report, err
+	}
+	report.Total = int(total)
+
+	migrateBatch := func(keys []string) error {
+		items, err := v.json(ctx).JSONMGet(".", keys...)
+		if err != nil {
+			return err
+		}
+
+		for i, item := range items.([]interface{}) {
+			if item == nil {
+				continue
+			}
+			report.Scanned++
+
+			_, outdated, err := decodeVoterDocument(item.([]byte))
+			if err != nil {
+				slog.ErrorContext(ctx, "reading voter document failed", "key", keys[i], "err", err)
+				report.Failed++
+				continue
+			}
+			if !outdated {
+				continue
+			}
+			if dryRun {
+				report.Upgraded++
+				continue
+			}
+
+			upgraded, err := upgradeVoterDocument(ctx, &v.cache, keys[i])
+			if err != nil {
+				slog.ErrorContext(ctx, "upgrading voter document failed", "key", keys[i], "err", err)
+				report.Failed++
+				continue
+			}
+			if upgraded {
+				report.Upgraded++
+			}
+		}
+
+		if progress != nil {
+			progress(report)
+		}
+		return nil
+	}
+
+	iter := v.cacheClient.Scan(ctx, 0, RedisKeyPrefix+"*", RedisBatchSize).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == RedisBatchSize {
+			if err := migrateBatch(keys); err != nil {
+				return report, err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return report, err
+	}
+	if len(keys) > 0 {
+		if err := migrateBatch(keys); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,127 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyDocument is a voter the way the first releases stored it, without a
+// schemaVersion or revision
+func legacyDocument(voter db.Voter) string {
+	return fmt.Sprintf(`{"voterId":%d,"name":%q,"email":%q}`, voter.VoterId, voter.Name, voter.Email)
+}
+
+// storedDocument reads the raw voter document off redis
+func storedDocument(t *testing.T, client *redis.Client, voterId uint) map[string]interface{} {
+	raw, err := client.Do(context.Background(), "JSON.GET", fmt.Sprintf("%s%d", db.RedisKeyPrefix, voterId), ".").Text()
+	if err != nil {
+		t.Fatalf("failed to read voter document: %v", err)
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &document); err != nil {
+		t.Fatalf("failed to unmarshal voter document: %v", err)
+	}
+	return document
+}
+
+func newSchemaTestCache(t *testing.T) (*db.VoterCache, *redis.Client) {
+	location := testutils.NewRedisStandIn(t)
+	voterCache, err := db.NewWithCacheInstance(location)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: location})
+	t.Cleanup(func() { client.Close() })
+	return voterCache, client
+}
+
+func setDocument(t *testing.T, client *redis.Client, voterId uint, document string) {
+	ctx := context.Background()
+	assert.Nil(t, client.Do(ctx, "JSON.SET", fmt.Sprintf("%s%d", db.RedisKeyPrefix, voterId), ".", document).Err())
+	assert.Nil(t, client.ZAdd(ctx, db.RedisIndexKey, redis.Z{Score: float64(voterId), Member: voterId}).Err())
+}
+
+func TestVoterDocumentsAreVersioned(t *testing.T) {
+	voterCache, client := newSchemaTestCache(t)
+
+	assert.Nil(t, voterCache.AddVoter(ctx, testutils.NewRandVoter(1)))
+	assert.Equal(t, float64(db.VoterSchemaVersion), storedDocument(t, client, 1)["schemaVersion"])
+
+	// but the version stays out of the voter
+	voter, err := voterCache.GetVoter(ctx, 1)
+	assert.Nil(t, err)
+	voterJSON, _ := json.Marshal(voter)
+	assert.NotContains(t, string(voterJSON), "schemaVersion")
+}
+
+func TestVoterDocumentsUpgradeOnRead(t *testing.T) {
+	voterCache, client := newSchemaTestCache(t)
+	voter1 := testutils.NewRandVoter(1)
+	voter2 := testutils.NewRandVoter(2)
+	setDocument(t, client, 1, legacyDocument(voter1))
+	setDocument(t, client, 2, legacyDocument(voter2))
+
+	voter, err := voterCache.GetVoter(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, testutils.AsAdded(voter1), voter)
+	assert.Equal(t, float64(db.VoterSchemaVersion), storedDocument(t, client, 1)["schemaVersion"])
+	assert.Equal(t, float64(db.FirstRevision), storedDocument(t, client, 1)["revision"])
+
+	// and on writes
+	assert.Nil(t, voterCache.AddVoterPoll(ctx, testutils.NewRandPollVoteRecord(1), 2))
+	document := storedDocument(t, client, 2)
+	assert.Equal(t, float64(db.VoterSchemaVersion), document["schemaVersion"])
+	assert.Equal(t, float64(2), document["revision"])
+}
+
+func TestVoterDocumentFromNewerSchema(t *testing.T) {
+	voterCache, client := newSchemaTestCache(t)
+	setDocument(t, client, 1, `{"voterId":1,"name":"Jo","email":"jo@example.com","revision":1,"schemaVersion":99}`)
+
+	_, err := voterCache.GetVoter(ctx, 1)
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, db.ErrVoterNotFound)
+
+	// it is not touched
+	assert.Equal(t, float64(99), storedDocument(t, client, 1)["schemaVersion"])
+}
+
+func TestMigrateVoters(t *testing.T) {
+	voterCache, client := newSchemaTestCache(t)
+	for voterId := uint(1); voterId <= 3; voterId++ {
+		setDocument(t, client, voterId, legacyDocument(testutils.NewRandVoter(voterId)))
+	}
+	assert.Nil(t, voterCache.AddVoter(ctx, testutils.NewRandVoter(4)))
+	setDocument(t, client, 5, `{"voterId":5,"schemaVersion":99}`)
+
+	report, err := voterCache.MigrateVoters(ctx, true, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, db.MigrationProgress{Scanned: 5, Upgraded: 3, Failed: 1, Total: 5}, report)
+	_, versioned := storedDocument(t, client, 1)["schemaVersion"]
+	assert.False(t, versioned)
+
+	var reports []db.MigrationProgress
+	report, err = voterCache.MigrateVoters(ctx, false, func(progress db.MigrationProgress) {
+		reports = append(reports, progress)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, db.MigrationProgress{Scanned: 5, Upgraded: 3, Failed: 1, Total: 5}, report)
+	assert.Equal(t, []db.MigrationProgress{report}, reports)
+	for voterId := uint(1); voterId <= 3; voterId++ {
+		assert.Equal(t, float64(db.VoterSchemaVersion), storedDocument(t, client, voterId)["schemaVersion"])
+	}
+
+	// running it again finds nothing to do
+	report, err = voterCache.MigrateVoters(ctx, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, report.Upgraded)
+}
@@ -0,0 +1,517 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	// SQLitePragmas are set on every connection, foreign keys cascade
+	// deleted voters and polls to their history and options
+	SQLitePragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	// sqlTimeFormat keeps times the way they read back from JSON
+	sqlTimeFormat = time.RFC3339Nano
+)
+
+type sqlStore struct {
+	db *sql.DB
+}
+
+// sqlQuerier is what *sql.DB and *sql.Tx have in common, reads are shared
+// between plain calls and transactions
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// VoterSQL is the VoterStore backed by SQLite, voters and their vote history
+// are kept in the voters and vote_history tables
+type VoterSQL struct {
+	sqlStore
+	// requirePolls makes vote history name a poll of the polls table, set
+	// by NewPollSQL
+	requirePolls bool
+}
+
+var _ VoterStore = (*VoterSQL)(nil)
+
+func init() {
+	// go_lower folds case like strings.ToLower, lower() of SQLite only folds
+	// ASCII and queries would match other names than the other stores
+	sqlite.MustRegisterDeterministicScalarFunction("go_lower", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		switch arg := args[0].(type) {
+		case string:
+			return strings.ToLower(arg), nil
+		case nil:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("go_lower takes text, not %T", arg)
+		}
+	})
+}
+
+// NewWithSQLite opens the SQLite database at path, creating it when needed,
+// and migrates its schema to the latest version
+func NewWithSQLite(path string) (*VoterSQL, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?"+SQLitePragmas)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite takes one writer at a time, a single connection makes writers
+	// queue here rather than fail with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQL(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &VoterSQL{sqlStore: sqlStore{db: db}}, nil
+}
+
+// Ping checks that the database can be reached
+func (v *VoterSQL) Ping(ctx context.Context) error {
+	return v.db.PingContext(ctx)
+}
+
+func (v *VoterSQL) Close() error {
+	return v.db.Close()
+}
+
+// inSQLTx runs fn in a transaction that is committed when fn succeeds
+func inSQLTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// isSQLConflict reports whether err is a primary key or unique constraint
+// of the schema turning a write away
+func isSQLConflict(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || code == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// sqlRowsAffected turns a write that matched no row into notFound
+func sqlRowsAffected(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return notFound
+	}
+
+	return nil
+}
+
+func parseSQLTime(value string) (time.Time, error) {
+	return time.Parse(sqlTimeFormat, value)
+}
+
+// getVotersFromSQL reads the voters selected by where, ordered by voterId,
+// together with their vote history
+func getVotersFromSQL(ctx context.Context, q sqlQuerier, where string, args ...any) ([]Voter, error) {
+	voters, err := scanVotersFromSQL(ctx, q, `SELECT voter_id, name, email, revision FROM voters `+where+` ORDER BY voter_id`, args...)
+	if err != nil || len(voters) == 0 {
+		return voters, err
+	}
+
+	return voters, addVoteHistoryFromSQL(ctx, q, voters, `SELECT voter_id FROM voters `+where, args...)
+}
+
+// scanVotersFromSQL reads the voters query selects in its order, without
+// their vote history
+func scanVotersFromSQL(ctx context.Context, q sqlQuerier, query string, args ...any) ([]Voter, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var voters []Voter
+	for rows.Next() {
+		var voter Voter
+		if err := rows.Scan(&voter.VoterId, &voter.Name, &voter.Email, &voter.Revision); err != nil {
+			return nil, err
+		}
+		voters = append(voters, voter)
+	}
+
+	return voters, rows.Err()
+}
+
+// addVoteHistoryFromSQL fills in the vote history of voters, idQuery selects
+// the voter ids whose history is read
+func addVoteHistoryFromSQL(ctx context.Context, q sqlQuerier, voters []Voter, idQuery string, args ...any) error {
+	positions := make(map[uint]int, len(voters))
+	for i, voter := range voters {
+		positions[voter.VoterId] = i
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT voter_id, poll_id, vote_id, vote_date FROM vote_history
+		WHERE voter_id IN (`+idQuery+`) ORDER BY seq`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var voterId uint
+		var vh VoterHistory
+		var voteDate string
+		if err := rows.Scan(&voterId, &vh.PollId, &vh.VoteId, &voteDate); err != nil {
+			return err
+		}
+		if vh.VoteDate, err = parseSQLTime(voteDate); err != nil {
+			return err
+		}
+
+		voter := &voters[positions[voterId]]
+		voter.VoteHistory = append(voter.VoteHistory, vh)
+	}
+
+	return rows.Err()
+}
+
+func getVoterFromSQL(ctx context.Context, q sqlQuerier, voterId uint) (Voter, error) {
+	voters, err := getVotersFromSQL(ctx, q, `WHERE voter_id = ?`, voterId)
+	if err != nil {
+		return Voter{}, err
+	}
+	if len(voters) == 0 {
+		return Voter{}, ErrVoterNotFound
+	}
+
+	return voters[0], nil
+}
+
+// updateVoterRow runs update on the voter in a transaction and writes back
+// its name and email with the next revision. update gets the transaction to
+// change the vote history in, the VoteHistory of the voter is not written.
+func updateVoterRow(ctx context.Context, s *sqlStore, voterId uint, update func(tx *sql.Tx, voter *Voter) error) (Voter, error) {
+	var voter Voter
+	err := inSQLTx(ctx, s.db, func(tx *sql.Tx) error {
+		var err error
+		voter, err = getVoterFromSQL(ctx, tx, voterId)
+		if err != nil {
+			return err
+		}
+
+		if err := update(tx, &voter); err != nil {
+			return err
+		}
+
+		voter.Revision++
+		_, err = tx.ExecContext(ctx, `UPDATE voters SET name = ?, email = ?, revision = ? WHERE voter_id = ?`,
+			voter.Name, voter.Email, voter.Revision, voterId)
+		return err
+	})
+	if err != nil {
+		return Voter{}, err
+	}
+
+	return voter, nil
+}
+
+func (v *VoterSQL) AddVoter(ctx context.Context, voter Voter) error {
+	if err := voter.ValidateNew(); err != nil {
+		return err
+	}
+
+	_, err := v.db.ExecContext(ctx, `INSERT INTO voters (voter_id, name, email, revision) VALUES (?, ?, ?, ?)`,
+		voter.VoterId, voter.Name, voter.Email, FirstRevision)
+	if isSQLConflict(err) {
+		return ErrVoterExists
+	}
+	return err
+}
+
+func (v *VoterSQL) GetVoter(ctx context.Context, voterId uint) (Voter, error) {
+	return getVoterFromSQL(ctx, v.db, voterId)
+}
+
+// GetAllVoters returns voters ordered by voterId
+func (v *VoterSQL) GetAllVoters(ctx context.Context) []Voter {
+	voters, err := getVotersFromSQL(ctx, v.db, "")
+	if err != nil {
+		slog.ErrorContext(ctx, "getting voters from sqlite failed", "err", err)
+	}
+
+	return voters
+}
+
+// QueryVoters filters, sorts and pages the voters in SQL and reads the vote
+// history of the voters on the page only
+func (v *VoterSQL) QueryVoters(ctx context.Context, query VoterQuery) (VoterPage, error) {
+	if err := query.Validate(); err != nil {
+		return VoterPage{}, err
+	}
+
+	var conditions []string
+	var args []any
+	if query.NameContains != "" {
+		conditions = append(conditions, `instr(go_lower(name), go_lower(?)) > 0`)
+		args = append(args, query.NameContains)
+	}
+	if query.Email != "" {
+		conditions = append(conditions, `go_lower(email) = go_lower(?)`)
+		args = append(args, query.Email)
+	}
+	if query.VotedInPoll != 0 {
+		conditions = append(conditions, `voter_id IN (SELECT voter_id FROM vote_history WHERE poll_id = ?)`)
+		args = append(args, query.VotedInPoll)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = `WHERE ` + strings.Join(conditions, ` AND `)
+	}
+
+	direction := ` ASC`
+	if query.Descending {
+		direction = ` DESC`
+	}
+	orderBy := `voter_id` + direction
+	switch query.SortBy {
+	case SortByName:
+		orderBy = `go_lower(name)` + direction + `, ` + orderBy
+	case SortByEmail:
+		orderBy = `go_lower(email)` + direction + `, ` + orderBy
+	}
+	// a negative LIMIT is no limit in SQLite
+	limit := query.Limit
+	if limit == 0 {
+		limit = -1
+	}
+
+	page := VoterPage{Offset: query.Offset, Limit: query.Limit}
+	err := inSQLTx(ctx, v.db, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM voters `+where, args...).Scan(&page.Total); err != nil {
+			return err
+		}
+
+		voters, err := scanVotersFromSQL(ctx, tx, `SELECT voter_id, name, email, revision FROM voters `+where+
+			` ORDER BY `+orderBy+` LIMIT ? OFFSET ?`, append(args, limit, query.Offset)...)
+		if err != nil || len(voters) == 0 {
+			page.Voters = []Voter{}
+			return err
+		}
+
+		ids := make([]any, len(voters))
+		for i, voter := range voters {
+			ids[i] = voter.VoterId
+		}
+		page.Voters = voters
+		return addVoteHistoryFromSQL(ctx, tx, voters, `?`+strings.Repeat(`, ?`, len(ids)-1), ids...)
+	})
+	if err != nil {
+		return VoterPage{}, err
+	}
+
+	return page, nil
+}
+
+func (v *VoterSQL) CountVoters(ctx context.Context) (int, error) {
+	var count int
+	err := v.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM voters`).Scan(&count)
+	return count, err
+}
+
+// DeleteAllVoters takes their vote history with them
+func (v *VoterSQL) DeleteAllVoters(ctx context.Context) {
+	if _, err := v.db.ExecContext(ctx, `DELETE FROM voters`); err != nil {
+		slog.ErrorContext(ctx, "deleting voters from sqlite failed", "err", err)
+	}
+}
+
+func (v *VoterSQL) UpdateVoter(ctx context.Context, voter Voter, voterId uint, ifRevision uint64) (Voter, error) {
+	return updateVoterRow(ctx, &v.sqlStore, voterId, func(_ *sql.Tx, existing *Voter) error {
+		if err := checkRevision(*existing, ifRevision); err != nil {
+			return err
+		}
+		return replaceVoter(existing, voter)
+	})
+}
+
+func (v *VoterSQL) PatchVoter(ctx context.Context, voterId uint, ifRevision uint64, patch VoterPatch) (Voter, error) {
+	return updateVoterRow(ctx, &v.sqlStore, voterId, func(_ *sql.Tx, existing *Voter) error {
+		if err := checkRevision(*existing, ifRevision); err != nil {
+			return err
+		}
+
+		current := *existing
+		current.VoteHistory = copyVoteHistory(existing.VoteHistory)
+		voter, err := patch(current)
+		if err != nil {
+			return err
+		}
+		return replaceVoter(existing, voter)
+	})
+}
+
+// DeleteVoter takes the vote history of the voter with it
+func (v *VoterSQL) DeleteVoter(ctx context.Context, voterId uint, ifRevision uint64) error {
+	return inSQLTx(ctx, v.db, func(tx *sql.Tx) error {
+		voter := Voter{VoterId: voterId}
+		err := tx.QueryRowContext(ctx, `SELECT revision FROM voters WHERE voter_id = ?`, voterId).Scan(&voter.Revision)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrVoterNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkRevision(voter, ifRevision); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM voters WHERE voter_id = ?`, voterId)
+		return err
+	})
+}
+
+func (v *VoterSQL) GetVoterPolls(ctx context.Context, voterId uint) ([]VoterHistory, error) {
+	voter, err := v.GetVoter(ctx, voterId)
+	if err != nil {
+		return nil, err
+	}
+
+	return voter.VoteHistory, nil
+}
+
+// insertVoterPoll adds a history entry, the unique (voter_id, poll_id)
+// constraint refuses a second one for the same poll with alreadyThere
+func insertVoterPoll(ctx context.Context, tx *sql.Tx, voterId uint, voterPoll VoterHistory, alreadyThere error) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO vote_history (voter_id, poll_id, vote_id, vote_date) VALUES (?, ?, ?, ?)`,
+		voterId, voterPoll.PollId, voterPoll.VoteId, voterPoll.VoteDate.Format(sqlTimeFormat))
+	if isSQLConflict(err) {
+		return alreadyThere
+	}
+	return err
+}
+
+// checkPoll fails with ErrPollNotFound when a PollSQL shares the database
+// and pollId is not one of its polls, it runs in the transaction that writes
+// the history so the poll can not go away in between
+func (v *VoterSQL) checkPoll(ctx context.Context, tx *sql.Tx, pollId uint) error {
+	if !v.requirePolls {
+		return nil
+	}
+
+	return checkPollInSQL(ctx, tx, pollId)
+}
+
+// checkPollOption is checkPoll for a ballot, the poll has to have optionId
+// too
+func (v *VoterSQL) checkPollOption(ctx context.Context, tx *sql.Tx, pollId uint, optionId uint) error {
+	if !v.requirePolls {
+		return nil
+	}
+
+	return checkPollOptionInSQL(ctx, tx, pollId, optionId)
+}
+
+func (v *VoterSQL) AddVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint) error {
+	if err := voterPoll.Validate(); err != nil {
+		return err
+	}
+
+	_, err := updateVoterRow(ctx, &v.sqlStore, voterId, func(tx *sql.Tx, _ *Voter) error {
+		if err := v.checkPoll(ctx, tx, voterPoll.PollId); err != nil {
+			return err
+		}
+		return insertVoterPoll(ctx, tx, voterId, voterPoll, ErrPollExists)
+	})
+	return err
+}
+
+func (v *VoterSQL) GetVoterPoll(ctx context.Context, voterId uint, pollId uint) (VoterHistory, error) {
+	voterPolls, err := v.GetVoterPolls(ctx, voterId)
+	if err != nil {
+		return VoterHistory{}, err
+	}
+
+	for _, vh := range voterPolls {
+		if vh.PollId == pollId {
+			return vh, nil
+		}
+	}
+
+	return VoterHistory{}, ErrPollNotFound
+}
+
+func (v *VoterSQL) UpdateVoterPoll(ctx context.Context, voterPoll VoterHistory, voterId uint, pollId uint) error {
+	voterPoll.PollId = pollId
+	if err := voterPoll.Validate(); err != nil {
+		return err
+	}
+
+	_, err := updateVoterRow(ctx, &v.sqlStore, voterId, func(tx *sql.Tx, _ *Voter) error {
+		if err := v.checkPoll(ctx, tx, pollId); err != nil {
+			return err
+		}
+		// the entry a ballot wrote keeps pointing at its vote
+		if err := checkNotRecordedInSQL(ctx, tx, voterId, pollId); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `UPDATE vote_history SET vote_id = ?, vote_date = ? WHERE voter_id = ? AND poll_id = ?`,
+			voterPoll.VoteId, voterPoll.VoteDate.Format(sqlTimeFormat), voterId, pollId)
+		if err != nil {
+			return err
+		}
+		return sqlRowsAffected(result, ErrPollNotFound)
+	})
+	return err
+}
+
+func (v *VoterSQL) DeleteVoterPoll(ctx context.Context, voterId uint, pollId uint) error {
+	_, err := updateVoterRow(ctx, &v.sqlStore, voterId, func(tx *sql.Tx, _ *Voter) error {
+		if err := checkNotRecordedInSQL(ctx, tx, voterId, pollId); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM vote_history WHERE voter_id = ? AND poll_id = ?`, voterId, pollId)
+		if err != nil {
+			return err
+		}
+		return sqlRowsAffected(result, ErrPollNotFound)
+	})
+	return err
+}
+
+// checkNotRecordedInSQL fails with ErrVoteRecorded when the history entry of
+// voterId for pollId was written by casting a vote
+func checkNotRecordedInSQL(ctx context.Context, q sqlQuerier, voterId uint, pollId uint) error {
+	var recorded int
+	err := q.QueryRowContext(ctx, `SELECT 1 FROM vote_history h
+		JOIN votes v ON v.vote_id = h.vote_id AND v.voter_id = h.voter_id AND v.poll_id = h.poll_id
+		WHERE h.voter_id = ? AND h.poll_id = ?`, voterId, pollId).Scan(&recorded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err == nil {
+		return ErrVoteRecorded
+	}
+	return err
+}
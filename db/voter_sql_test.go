@@ -0,0 +1,165 @@
+package db_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestVoterSQL opens a fresh database for a single test
+func newTestVoterSQL(t *testing.T) *db.VoterSQL {
+	voterSQL, err := db.NewWithSQLite(filepath.Join(t.TempDir(), "voters.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	assert.Nil(t, voterSQL.Ping(ctx))
+
+	t.Cleanup(func() { voterSQL.Close() })
+	return voterSQL
+}
+
+func TestVoterSQLConformance(t *testing.T) {
+	testutils.RunVoterStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore) {
+		voterSQL := newTestVoterSQL(t)
+		return voterSQL, db.NewPollSQL(voterSQL)
+	})
+}
+
+func TestPollSQLConformance(t *testing.T) {
+	testutils.RunPollStoreConformance(t, func(t *testing.T) db.PollStore {
+		return db.NewPollSQL(newTestVoterSQL(t))
+	})
+}
+
+func TestVoteSQLConformance(t *testing.T) {
+	testutils.RunVoteStoreConformance(t, func(t *testing.T) (db.VoterStore, db.PollStore, db.VoteStore) {
+		voterSQL := newTestVoterSQL(t)
+		return voterSQL, db.NewPollSQL(voterSQL), db.NewVoteSQL(voterSQL)
+	})
+}
+
+func TestVoterSQLMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "voters.db")
+	voterSQL, err := db.NewWithSQLite(path)
+	assert.Nil(t, err)
+	assert.Nil(t, voterSQL.AddVoter(ctx, testutils.NewRandVoter(1)))
+	voterSQL.Close()
+
+	// reopening applies nothing twice and keeps the data
+	voterSQL, err = db.NewWithSQLite(path)
+	assert.Nil(t, err)
+	_, err = voterSQL.GetVoter(ctx, 1)
+	assert.Nil(t, err)
+	voterSQL.Close()
+
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	var versions int
+	assert.Nil(t, conn.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&versions))
+	assert.Equal(t, 4, versions)
+
+	// a database migrated by a newer build is refused
+	_, err = conn.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (99, '')`)
+	assert.Nil(t, err)
+	conn.Close()
+
+	_, err = db.NewWithSQLite(path)
+	assert.NotNil(t, err)
+}
+
+func TestVoterSQLHistoryIsUniquePerPoll(t *testing.T) {
+	voterSQL := newTestVoterSQL(t)
+	assert.Nil(t, voterSQL.AddVoter(ctx, testutils.NewRandVoter(1)))
+	assert.Nil(t, voterSQL.AddVoterPoll(ctx, testutils.NewRandPollVoteRecord(1), 1))
+
+	err := voterSQL.AddVoterPoll(ctx, testutils.NewRandPollVoteRecord(1), 1)
+	assert.ErrorIs(t, err, db.ErrPollExists)
+
+	// the failed write rolled back with the revision it would have bumped
+	voter, _ := voterSQL.GetVoter(ctx, 1)
+	assert.Equal(t, uint64(2), voter.Revision)
+	assert.Len(t, voter.VoteHistory, 1)
+
+	// deleting the voter takes the history along
+	assert.Nil(t, voterSQL.DeleteVoter(ctx, 1, 0))
+	assert.Nil(t, voterSQL.AddVoter(ctx, testutils.NewRandVoter(1)))
+	voterPolls, err := voterSQL.GetVoterPolls(ctx, 1)
+	assert.Nil(t, err)
+	assert.Empty(t, voterPolls)
+}
+
+func TestVoterSQLQueryByPoll(t *testing.T) {
+	voterSQL := newTestVoterSQL(t)
+	for voterId := uint(1); voterId <= 4; voterId++ {
+		assert.Nil(t, voterSQL.AddVoter(ctx, testutils.NewRandVoter(voterId)))
+	}
+	assert.Nil(t, voterSQL.AddVoterPoll(ctx, testutils.NewRandPollVoteRecord(1), 2))
+	assert.Nil(t, voterSQL.AddVoterPoll(ctx, testutils.NewRandPollVoteRecord(2), 3))
+	assert.Nil(t, voterSQL.AddVoterPoll(ctx, testutils.NewRandPollVoteRecord(1), 4))
+
+	page, err := voterSQL.QueryVoters(ctx, db.VoterQuery{VotedInPoll: 1, Descending: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, page.Total)
+	if assert.Len(t, page.Voters, 2) {
+		assert.Equal(t, uint(4), page.Voters[0].VoterId)
+		assert.Equal(t, uint(2), page.Voters[1].VoterId)
+	}
+}
+
+func TestVoteSQLRebuildTallies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "voters.db")
+	voterSQL, err := db.NewWithSQLite(path)
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	defer voterSQL.Close()
+	voteSQL := db.NewVoteSQL(voterSQL)
+
+	voterSQL.AddVoter(ctx, testutils.NewRandVoter(1))
+	voterSQL.AddVoter(ctx, testutils.NewRandVoter(2))
+	voteSQL.CastVote(ctx, db.Vote{VoterId: 1, PollId: 1, OptionId: 1})
+	voteSQL.CastVote(ctx, db.Vote{VoterId: 2, PollId: 1, OptionId: 2})
+
+	// tallies knocked out of step with the votes
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	defer conn.Close()
+	_, err = conn.Exec(`UPDATE tallies SET count = count + 5 WHERE poll_id = 1 AND option_id = 2`)
+	assert.Nil(t, err)
+	_, err = conn.Exec(`INSERT INTO tallies (poll_id, option_id, count) VALUES (7, 1, 1)`)
+	assert.Nil(t, err)
+
+	drifts, err := voteSQL.RebuildTallies(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []db.TallyDrift{
+		{
+			PollId:  1,
+			Stored:  db.Tally{PollId: 1, Counts: map[uint]int{1: 1, 2: 6}, Total: 7},
+			Rebuilt: db.Tally{PollId: 1, Counts: map[uint]int{1: 1, 2: 1}, Total: 2},
+		},
+		{
+			PollId:  7,
+			Stored:  db.Tally{PollId: 7, Counts: map[uint]int{1: 1}, Total: 1},
+			Rebuilt: db.Tally{PollId: 7, Counts: map[uint]int{}},
+		},
+	}, drifts)
+
+	tally, err := voteSQL.GetTally(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, db.Tally{PollId: 1, Counts: map[uint]int{1: 1, 2: 1}, Total: 2}, tally)
+	tally, err = voteSQL.GetTally(ctx, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, tally.Total)
+
+	drifts, err = voteSQL.RebuildTallies(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, drifts)
+}
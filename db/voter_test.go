@@ -1,6 +1,7 @@
 package db_test
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/abhi2687/voter-api/db"
@@ -24,17 +25,17 @@ func TestAddVoter(t *testing.T) {
 	voter2 := testutils.NewRandVoter(2)
 
 	// Test adding a new voter
-	err := voterList.AddVoter(voter1)
+	err := voterList.AddVoter(ctx, voter1)
 	assert.Nil(t, err)
-	assert.Equal(t, voter1, voterList.Voters[voter1.VoterId])
+	assert.Equal(t, testutils.AsAdded(voter1), voterList.Voters[voter1.VoterId])
 
 	// Test adding another new voter
-	err = voterList.AddVoter(voter2)
+	err = voterList.AddVoter(ctx, voter2)
 	assert.Nil(t, err)
-	assert.Equal(t, voter2, voterList.Voters[voter2.VoterId])
+	assert.Equal(t, testutils.AsAdded(voter2), voterList.Voters[voter2.VoterId])
 
 	// Test adding an existing voter
-	err = voterList.AddVoter(voter1)
+	err = voterList.AddVoter(ctx, voter1)
 	assert.NotNil(t, err)
 	assert.Equal(t, "voter already exists", err.Error())
 }
@@ -48,17 +49,17 @@ func TestGetVoter(t *testing.T) {
 	voter2 := testutils.NewRandVoter(2)
 
 	// Test getting a non-existent voter
-	_, err := voterList.GetVoter(voter1.VoterId)
+	_, err := voterList.GetVoter(ctx, voter1.VoterId)
 	assert.NotNil(t, err)
 	assert.Equal(t, "voter does not exist", err.Error())
 
 	// Test getting an existing voter
-	voterList.AddVoter(voter1)
-	voterList.AddVoter(voter2)
+	voterList.AddVoter(ctx, voter1)
+	voterList.AddVoter(ctx, voter2)
 
-	voter, err := voterList.GetVoter(voter1.VoterId)
+	voter, err := voterList.GetVoter(ctx, voter1.VoterId)
 	assert.Nil(t, err)
-	assert.Equal(t, voter1, voter)
+	assert.Equal(t, testutils.AsAdded(voter1), voter)
 }
 
 func TestGetAllVoters(t *testing.T) {
@@ -70,13 +71,13 @@ func TestGetAllVoters(t *testing.T) {
 	voter2 := testutils.NewRandVoter(2)
 
 	// Test getting all voters
-	voterList.AddVoter(voter1)
-	voterList.AddVoter(voter2)
+	voterList.AddVoter(ctx, voter1)
+	voterList.AddVoter(ctx, voter2)
 
-	voters := voterList.GetAllVoters()
+	voters := voterList.GetAllVoters(ctx)
 	assert.Equal(t, 2, len(voters))
-	assert.Contains(t, voters, voter1)
-	assert.Contains(t, voters, voter2)
+	assert.Contains(t, voters, testutils.AsAdded(voter1))
+	assert.Contains(t, voters, testutils.AsAdded(voter2))
 }
 
 func TestDeleteAllVoters(t *testing.T) {
@@ -88,10 +89,10 @@ func TestDeleteAllVoters(t *testing.T) {
 	voter2 := testutils.NewRandVoter(2)
 
 	// Test deleting all voters
-	voterList.AddVoter(voter1)
-	voterList.AddVoter(voter2)
+	voterList.AddVoter(ctx, voter1)
+	voterList.AddVoter(ctx, voter2)
 
-	voterList.DeleteAllVoters()
+	voterList.DeleteAllVoters(ctx)
 	assert.Equal(t, 0, len(voterList.Voters))
 }
 
@@ -104,13 +105,19 @@ func TestUpdateVoter(t *testing.T) {
 	voter2 := testutils.NewRandVoter(2)
 
 	// Test updating a non-existent voter
-	err := voterList.UpdateVoter(voter1, voter1.VoterId)
+	_, err := voterList.UpdateVoter(ctx, voter1, voter1.VoterId, 0)
 	assert.NotNil(t, err)
 	assert.Equal(t, "voter does not exist", err.Error())
 
+	// Test updating an existing voter with the body of another voter
+	voterList.AddVoter(ctx, voter1)
+	_, err = voterList.UpdateVoter(ctx, voter2, voter1.VoterId, 0)
+	assert.ErrorIs(t, err, db.ErrVoterIdMismatch)
+	assert.Equal(t, testutils.AsAdded(voter1), voterList.Voters[voter1.VoterId])
+
 	// Test updating an existing voter
-	voterList.AddVoter(voter1)
-	err = voterList.UpdateVoter(voter2, voter1.VoterId)
+	voter2.VoterId = voter1.VoterId
+	_, err = voterList.UpdateVoter(ctx, voter2, voter1.VoterId, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, voter2.Name, voterList.Voters[voter1.VoterId].Name)
 	assert.Equal(t, voter2.Email, voterList.Voters[voter1.VoterId].Email)
@@ -125,14 +132,14 @@ func TestDeleteVoter(t *testing.T) {
 	voter2 := testutils.NewRandVoter(2)
 
 	// Test deleting a non-existent voter
-	err := voterList.DeleteVoter(voter1.VoterId)
+	err := voterList.DeleteVoter(ctx, voter1.VoterId, 0)
 	assert.NotNil(t, err)
 	assert.Equal(t, "voter does not exist", err.Error())
 
 	// Test deleting an existing voter
-	voterList.AddVoter(voter1)
-	voterList.AddVoter(voter2)
-	err = voterList.DeleteVoter(voter1.VoterId)
+	voterList.AddVoter(ctx, voter1)
+	voterList.AddVoter(ctx, voter2)
+	err = voterList.DeleteVoter(ctx, voter1.VoterId, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(voterList.Voters))
 	assert.NotContains(t, voterList.Voters, voter1.VoterId)
@@ -147,19 +154,19 @@ func TestAddVoterPoll(t *testing.T) {
 	poll1 := testutils.NewRandPollVoteRecord(1)
 
 	// Test adding a poll to a non-existent voter
-	err := voterList.AddVoterPoll(poll1, voter1.VoterId)
+	err := voterList.AddVoterPoll(ctx, poll1, voter1.VoterId)
 	assert.NotNil(t, err)
 	assert.Equal(t, "voter does not exist", err.Error())
 
 	// Test adding a poll to an existing voter
-	voterList.AddVoter(voter1)
-	err = voterList.AddVoterPoll(poll1, voter1.VoterId)
+	voterList.AddVoter(ctx, voter1)
+	err = voterList.AddVoterPoll(ctx, poll1, voter1.VoterId)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(voterList.Voters[voter1.VoterId].VoteHistory))
 	assert.Contains(t, voterList.Voters[voter1.VoterId].VoteHistory, poll1)
 
 	// Test adding same poll to an existing voter with existing polls
-	err = voterList.AddVoterPoll(poll1, voter1.VoterId)
+	err = voterList.AddVoterPoll(ctx, poll1, voter1.VoterId)
 	assert.NotNil(t, err)
 	assert.Equal(t, "poll already exists", err.Error())
 }
@@ -173,20 +180,20 @@ func TestGetVoterPoll(t *testing.T) {
 	poll1 := testutils.NewRandPollVoteRecord(1)
 
 	// Test getting a poll for a non-existent voter
-	_, err := voterList.GetVoterPoll(poll1.PollId, voter1.VoterId)
+	_, err := voterList.GetVoterPoll(ctx, poll1.PollId, voter1.VoterId)
 	assert.NotNil(t, err)
 	assert.Equal(t, "voter does not exist", err.Error())
 
 	// Test getting a poll for an existing voter with no polls
-	voterList.AddVoter(voter1)
-	_, err = voterList.GetVoterPoll(poll1.PollId, voter1.VoterId)
+	voterList.AddVoter(ctx, voter1)
+	_, err = voterList.GetVoterPoll(ctx, poll1.PollId, voter1.VoterId)
 	assert.NotNil(t, err)
 	assert.Equal(t, "poll does not exist", err.Error())
 
 	// test getting a poll for an existing voter with polls
-	voterList.AddVoterPoll(poll1, voter1.VoterId)
+	voterList.AddVoterPoll(ctx, poll1, voter1.VoterId)
 
-	voterPoll, err := voterList.GetVoterPoll(poll1.PollId, voter1.VoterId)
+	voterPoll, err := voterList.GetVoterPoll(ctx, poll1.PollId, voter1.VoterId)
 	assert.Nil(t, err)
 	assert.Equal(t, poll1, voterPoll)
 }
@@ -200,15 +207,15 @@ func TestGetVoterPolls(t *testing.T) {
 	poll1 := testutils.NewRandPollVoteRecord(1)
 
 	// Test getting polls for a non-existent voter
-	_, err := voterList.GetVoterPolls(voter1.VoterId)
+	_, err := voterList.GetVoterPolls(ctx, voter1.VoterId)
 	assert.NotNil(t, err)
 	assert.Equal(t, "voter does not exist", err.Error())
 
 	// Test getting polls for an existing voter
-	voterList.AddVoter(voter1)
-	voterList.AddVoterPoll(poll1, voter1.VoterId)
+	voterList.AddVoter(ctx, voter1)
+	voterList.AddVoterPoll(ctx, poll1, voter1.VoterId)
 
-	voterPolls, err := voterList.GetVoterPolls(voter1.VoterId)
+	voterPolls, err := voterList.GetVoterPolls(ctx, voter1.VoterId)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(voterPolls))
 	assert.Contains(t, voterPolls, poll1)
@@ -223,19 +230,19 @@ func TestDeleteVoterPoll(t *testing.T) {
 	poll1 := testutils.NewRandPollVoteRecord(1)
 
 	// Test deleting polls for a non-existent voter
-	err := voterList.DeleteVoterPoll(poll1.PollId, voter1.VoterId)
+	err := voterList.DeleteVoterPoll(ctx, poll1.PollId, voter1.VoterId)
 	assert.NotNil(t, err)
 	assert.Equal(t, "voter does not exist", err.Error())
 
 	// Test deleting polls for an existing voter with no polls
-	voterList.AddVoter(voter1)
-	err = voterList.DeleteVoterPoll(poll1.PollId, voter1.VoterId)
+	voterList.AddVoter(ctx, voter1)
+	err = voterList.DeleteVoterPoll(ctx, poll1.PollId, voter1.VoterId)
 	assert.NotNil(t, err)
 	assert.Equal(t, "poll does not exist", err.Error())
 
 	// test deleting polls for an existing voter with polls
-	voterList.AddVoterPoll(poll1, voter1.VoterId)
-	err = voterList.DeleteVoterPoll(poll1.PollId, voter1.VoterId)
+	voterList.AddVoterPoll(ctx, poll1, voter1.VoterId)
+	err = voterList.DeleteVoterPoll(ctx, poll1.PollId, voter1.VoterId)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(voterList.Voters[voter1.VoterId].VoteHistory))
 }
@@ -250,21 +257,104 @@ func TestUpdateVoterPoll(t *testing.T) {
 	poll2 := testutils.NewRandPollVoteRecord(2)
 
 	// Test updating polls for a non-existent voter
-	err := voterList.UpdateVoterPoll(poll1, voter1.VoterId, poll1.PollId)
+	err := voterList.UpdateVoterPoll(ctx, poll1, voter1.VoterId, poll1.PollId)
 	assert.NotNil(t, err)
 	assert.Equal(t, "voter does not exist", err.Error())
 
 	// Test updating polls for an existing voter with no polls
-	voterList.AddVoter(voter1)
-	err = voterList.UpdateVoterPoll(poll1, voter1.VoterId, poll1.PollId)
+	voterList.AddVoter(ctx, voter1)
+	err = voterList.UpdateVoterPoll(ctx, poll1, voter1.VoterId, poll1.PollId)
 	assert.NotNil(t, err)
 	assert.Equal(t, "poll does not exist", err.Error())
 
 	// test updating polls for an existing voter with polls
-	voterList.AddVoterPoll(poll1, voter1.VoterId)
-	err = voterList.UpdateVoterPoll(poll2, voter1.VoterId, poll1.PollId)
+	voterList.AddVoterPoll(ctx, poll1, voter1.VoterId)
+	err = voterList.UpdateVoterPoll(ctx, poll2, voter1.VoterId, poll1.PollId)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(voterList.Voters[voter1.VoterId].VoteHistory))
 	assert.Equal(t, voterList.Voters[voter1.VoterId].VoteHistory[0].VoteId, poll2.VoteId)
 	assert.Equal(t, voterList.Voters[voter1.VoterId].VoteHistory[0].VoteDate, poll2.VoteDate)
 }
+
+func TestConcurrentVoterPolls(t *testing.T) {
+	voterList, _ := db.New()
+
+	const voters, polls = 8, 50
+	for voterId := uint(1); voterId <= voters; voterId++ {
+		voterList.AddVoter(ctx, testutils.NewRandVoter(voterId))
+	}
+
+	// every voter gets its polls added and updated from many goroutines while
+	// other goroutines keep reading
+	var wg sync.WaitGroup
+	for voterId := uint(1); voterId <= voters; voterId++ {
+		for pollId := uint(1); pollId <= polls; pollId++ {
+			wg.Add(3)
+			go func(voterId, pollId uint) {
+				defer wg.Done()
+				assert.Nil(t, voterList.AddVoterPoll(ctx, testutils.NewRandPollVoteRecord(pollId), voterId))
+			}(voterId, pollId)
+			go func(voterId, pollId uint) {
+				defer wg.Done()
+				// the poll may not be added yet
+				voterList.UpdateVoterPoll(ctx, testutils.NewRandPollVoteRecord(pollId), voterId, pollId)
+			}(voterId, pollId)
+			go func(voterId uint) {
+				defer wg.Done()
+				voterList.GetVoterPolls(ctx, voterId)
+				voterList.GetAllVoters(ctx)
+			}(voterId)
+		}
+	}
+	wg.Wait()
+
+	for voterId := uint(1); voterId <= voters; voterId++ {
+		voterPolls, err := voterList.GetVoterPolls(ctx, voterId)
+		assert.Nil(t, err)
+		assert.Equal(t, polls, len(voterPolls))
+	}
+}
+
+func TestConcurrentAddVoter(t *testing.T) {
+	voterList, _ := db.New()
+
+	// only one of the goroutines adding the same voter can win
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	added := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if voterList.AddVoter(ctx, testutils.NewRandVoter(1)) == nil {
+				mu.Lock()
+				added++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, added)
+}
+
+func TestVoteHistoryIsNotAliased(t *testing.T) {
+	voterList, _ := db.New()
+
+	voter1 := testutils.NewRandVoter(1)
+	poll1 := testutils.NewRandPollVoteRecord(1)
+	voterList.AddVoter(ctx, voter1)
+	voterList.AddVoterPoll(ctx, poll1, voter1.VoterId)
+
+	// changing the slices handed out by the getters does not change the store
+	voter, _ := voterList.GetVoter(ctx, voter1.VoterId)
+	voter.VoteHistory[0].VoteId++
+	voterPolls, _ := voterList.GetVoterPolls(ctx, voter1.VoterId)
+	voterPolls[0].VoteId++
+	voters := voterList.GetAllVoters(ctx)
+	voters[0].VoteHistory[0].VoteId++
+
+	voterPoll, err := voterList.GetVoterPoll(ctx, voter1.VoterId, poll1.PollId)
+	assert.Nil(t, err)
+	assert.Equal(t, poll1, voterPoll)
+}
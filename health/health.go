@@ -0,0 +1,192 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultTimeout bounds how long a readiness check may take before its
+// dependency is reported down
+const DefaultTimeout = time.Second
+
+// Statuses of a dependency and of the replica
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+
+	StatusOK       = "ok"
+	StatusReady    = "ready"
+	StatusNotReady = "not-ready"
+	StatusDraining = "draining"
+)
+
+// Check reports whether a dependency can be used, it should give up once
+// ctx is done. An error wrapped with Degraded leaves the replica ready.
+type Check func(ctx context.Context) error
+
+// degradedError is a failed check the replica can still serve around
+type degradedError struct {
+	err error
+}
+
+func (e degradedError) Error() string { return e.err.Error() }
+func (e degradedError) Unwrap() error { return e.err }
+
+// Degraded marks err as a failure the replica can keep serving through,
+// like a store that is down while reads are answered from a snapshot
+func Degraded(err error) error {
+	if err == nil {
+		return nil
+	}
+	return degradedError{err: err}
+}
+
+// Dependency is the outcome of a check
+type Dependency struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Took is how long the check ran in milliseconds
+	Took float64 `json:"took"`
+}
+
+// Report is the body of both probes, Checks is only filled in by readiness
+type Report struct {
+	Status  string                `json:"status"`
+	Version string                `json:"version"`
+	Commit  string                `json:"commit"`
+	Uptime  float64               `json:"uptime"`
+	Checks  map[string]Dependency `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Probes answers the liveness and readiness probes of a replica, it is safe
+// for concurrent use
+type Probes struct {
+	version  string
+	commit   string
+	timeout  time.Duration
+	started  time.Time
+	draining atomic.Bool
+
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+// New returns probes for a build of version and commit whose readiness
+// checks give up after timeout, 0 uses DefaultTimeout
+func New(version string, commit string, timeout time.Duration) *Probes {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Probes{
+		version: version,
+		commit:  commit,
+		timeout: timeout,
+		started: time.Now(),
+	}
+}
+
+// AddCheck makes readiness depend on check, reported under name
+func (p *Probes) AddCheck(name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.checks = append(p.checks, namedCheck{name: name, check: check})
+}
+
+// Drain reports the replica not ready from now on so it is taken out of
+// rotation while its requests finish
+func (p *Probes) Drain() {
+	p.draining.Store(true)
+}
+
+// Live answers 200 as long as the process serves requests at all
+func (p *Probes) Live(c *fiber.Ctx) error {
+	return c.JSON(p.report(StatusOK))
+}
+
+// Ready runs every check at once and answers 200 when all dependencies are
+// up or degraded, otherwise and while draining it answers 503
+func (p *Probes) Ready(c *fiber.Ctx) error {
+	report := p.report(StatusReady)
+	report.Checks = p.runChecks(c.UserContext())
+
+	for _, dependency := range report.Checks {
+		if dependency.Status == StatusDown {
+			report.Status = StatusNotReady
+		}
+	}
+	if p.draining.Load() {
+		report.Status = StatusDraining
+	}
+
+	if report.Status != StatusReady {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(report)
+	}
+	return c.JSON(report)
+}
+
+func (p *Probes) report(status string) Report {
+	return Report{
+		Status:  status,
+		Version: p.version,
+		Commit:  p.commit,
+		Uptime:  time.Since(p.started).Seconds(),
+	}
+}
+
+// runChecks runs the checks concurrently, each with its own timeout
+func (p *Probes) runChecks(ctx context.Context) map[string]Dependency {
+	p.mu.RLock()
+	checks := p.checks
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	dependencies := make([]Dependency, len(checks))
+	for i, named := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			dependencies[i] = p.runCheck(ctx, check)
+		}(i, named.check)
+	}
+	wg.Wait()
+
+	report := make(map[string]Dependency, len(checks))
+	for i, named := range checks {
+		report[named.name] = dependencies[i]
+	}
+	return report
+}
+
+func (p *Probes) runCheck(ctx context.Context, check Check) Dependency {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	dependency := Dependency{Status: StatusUp, Took: float64(time.Since(start).Microseconds()) / 1000}
+
+	var degraded degradedError
+	switch {
+	case err == nil:
+	case errors.As(err, &degraded):
+		dependency.Status = StatusDegraded
+		dependency.Error = err.Error()
+	default:
+		dependency.Status = StatusDown
+		dependency.Error = err.Error()
+	}
+	return dependency
+}
@@ -0,0 +1,166 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abhi2687/voter-api/health"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestApp serves the probes the way main does
+func newTestApp(probes *health.Probes) *fiber.App {
+	app := fiber.New()
+	app.Get("/livez", probes.Live)
+	app.Get("/readyz", probes.Ready)
+	return app
+}
+
+// probe serves path and decodes the report in the response
+func probe(t *testing.T, app *fiber.App, path string) (int, health.Report) {
+	resp, err := app.Test(httptest.NewRequest("GET", path, nil), -1)
+	if err != nil {
+		t.Fatalf("Failed to serve request: %v", err)
+	}
+
+	var report health.Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	return resp.StatusCode, report
+}
+
+func upCheck(ctx context.Context) error {
+	return nil
+}
+
+func downCheck(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+// hangingCheck only returns once its timeout is up
+func hangingCheck(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestLive(t *testing.T) {
+	probes := health.New("v1.2.0", "abc1234", 0)
+	probes.AddCheck("store", downCheck)
+	app := newTestApp(probes)
+
+	// liveness does not depend on the store
+	status, report := probe(t, app, "/livez")
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Equal(t, "v1.2.0", report.Version)
+	assert.Equal(t, "abc1234", report.Commit)
+	assert.Empty(t, report.Checks)
+}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     map[string]health.Check
+		wantStatus int
+		wantReport string
+		wantChecks map[string]string
+	}{
+		{
+			name:       "NoDependencies",
+			wantStatus: fiber.StatusOK,
+			wantReport: health.StatusReady,
+			wantChecks: map[string]string{},
+		},
+		{
+			name:       "Up",
+			checks:     map[string]health.Check{"redis": upCheck},
+			wantStatus: fiber.StatusOK,
+			wantReport: health.StatusReady,
+			wantChecks: map[string]string{"redis": health.StatusUp},
+		},
+		{
+			name:       "Down",
+			checks:     map[string]health.Check{"redis": downCheck, "sqlite": upCheck},
+			wantStatus: fiber.StatusServiceUnavailable,
+			wantReport: health.StatusNotReady,
+			wantChecks: map[string]string{"redis": health.StatusDown, "sqlite": health.StatusUp},
+		},
+		{
+			name: "Degraded",
+			checks: map[string]health.Check{"redis": func(ctx context.Context) error {
+				return health.Degraded(downCheck(ctx))
+			}},
+			wantStatus: fiber.StatusOK,
+			wantReport: health.StatusReady,
+			wantChecks: map[string]string{"redis": health.StatusDegraded},
+		},
+		{
+			name:       "TimedOut",
+			checks:     map[string]health.Check{"redis": hangingCheck},
+			wantStatus: fiber.StatusServiceUnavailable,
+			wantReport: health.StatusNotReady,
+			wantChecks: map[string]string{"redis": health.StatusDown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes := health.New("dev", "unknown", 50*time.Millisecond)
+			for name, check := range tt.checks {
+				probes.AddCheck(name, check)
+			}
+
+			status, report := probe(t, newTestApp(probes), "/readyz")
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantReport, report.Status)
+
+			checks := map[string]string{}
+			for name, dependency := range report.Checks {
+				checks[name] = dependency.Status
+				if dependency.Status == health.StatusUp {
+					assert.Empty(t, dependency.Error)
+				} else {
+					assert.NotEmpty(t, dependency.Error)
+				}
+			}
+			assert.Equal(t, tt.wantChecks, checks)
+		})
+	}
+}
+
+func TestReadyChecksRunConcurrently(t *testing.T) {
+	probes := health.New("dev", "unknown", 100*time.Millisecond)
+	probes.AddCheck("redis", hangingCheck)
+	probes.AddCheck("sqlite", hangingCheck)
+	probes.AddCheck("journal", hangingCheck)
+
+	start := time.Now()
+	status, _ := probe(t, newTestApp(probes), "/readyz")
+	assert.Equal(t, fiber.StatusServiceUnavailable, status)
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+}
+
+func TestReadyWhileDraining(t *testing.T) {
+	probes := health.New("dev", "unknown", 0)
+	probes.AddCheck("redis", upCheck)
+	app := newTestApp(probes)
+
+	status, _ := probe(t, app, "/readyz")
+	assert.Equal(t, fiber.StatusOK, status)
+
+	probes.Drain()
+	status, report := probe(t, app, "/readyz")
+	assert.Equal(t, fiber.StatusServiceUnavailable, status)
+	assert.Equal(t, health.StatusDraining, report.Status)
+	assert.Equal(t, health.StatusUp, report.Checks["redis"].Status)
+
+	// a draining replica is still alive
+	status, _ = probe(t, app, "/livez")
+	assert.Equal(t, fiber.StatusOK, status)
+}
@@ -0,0 +1,140 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Formats log lines are written in
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// RequestIDKey is the attribute the X-Request-ID of a request is logged
+// under, like the requestId of problem responses
+const RequestIDKey = "requestId"
+
+// RedactedValue replaces the value of redacted attributes
+const RedactedValue = "[REDACTED]"
+
+// redactedKeys are the attributes that hold personal data of voters, they
+// are redacted at any depth
+var redactedKeys = map[string]bool{
+	"name":  true,
+	"email": true,
+}
+
+// Options configure New, the zero value writes JSON at info with nothing
+// redacted
+type Options struct {
+	Level  slog.Leveler
+	Format string
+	// Redact replaces the name and email attributes with RedactedValue,
+	// structs have to implement slog.LogValuer to have theirs found
+	Redact bool
+}
+
+// New returns a logger writing to w whose lines carry the request id of the
+// context they are logged with
+func New(w io.Writer, options Options) *slog.Logger {
+	handlerOptions := &slog.HandlerOptions{Level: options.Level}
+	if options.Redact {
+		handlerOptions.ReplaceAttr = redact
+	}
+
+	var handler slog.Handler
+	if options.Format == FormatText {
+		handler = slog.NewTextHandler(w, handlerOptions)
+	} else {
+		handler = slog.NewJSONHandler(w, handlerOptions)
+	}
+	return slog.New(requestIDHandler{handler})
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if redactedKeys[a.Key] {
+		return slog.String(a.Key, RedactedValue)
+	}
+	return a
+}
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns ctx carrying the request id lines are logged with
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestID returns the request id ctx carries, empty when there is none
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// requestIDHandler adds the request id of the context to every line
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String(RequestIDKey, requestID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// Middleware puts the X-Request-ID the requestid middleware set into the
+// context of the request and logs every request once it was answered, at
+// error for 5xx. It has to come after the requestid middleware and before
+// any that look at the status, errors are answered here with the error
+// handler of the app. The query string is not logged since it may hold
+// voter names and emails.
+func Middleware(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		middleware := c.Route()
+		ctx := WithRequestID(c.UserContext(), c.GetRespHeader(fiber.HeaderXRequestID))
+		c.SetUserContext(ctx)
+
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		// the route is still this middleware when no handler matched
+		route := c.Route().Path
+		if c.Route() == middleware {
+			route = ""
+		}
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(ctx, level, "request",
+			slog.String("method", c.Method()),
+			slog.String("path", c.Path()),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Duration("took", time.Since(start)),
+			slog.Int("bytes", len(c.Response().Body())),
+			slog.String("ip", c.IP()),
+			slog.String("userAgent", c.Get(fiber.HeaderUserAgent)),
+		)
+		return nil
+	}
+}
@@ -0,0 +1,183 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abhi2687/voter-api/api"
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/logging"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+// logLines decodes the JSON lines written to out
+func logLines(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var decoded map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+			t.Fatalf("Failed to unmarshal log line %q: %v", line, err)
+		}
+		lines = append(lines, decoded)
+	}
+	return lines
+}
+
+func TestRedact(t *testing.T) {
+	voter := testutils.NewRandVoter(1)
+
+	tests := []struct {
+		name   string
+		redact bool
+		want   string
+	}{
+		{"Redacted", true, logging.RedactedValue},
+		{"Plain", false, voter.Email},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logging.New(&out, logging.Options{Redact: tt.redact})
+			logger.Info("adding voter", "voter", voter, "email", voter.Email)
+
+			lines := logLines(t, &out)
+			if assert.Len(t, lines, 1) {
+				logged := lines[0]["voter"].(map[string]interface{})
+				assert.Equal(t, float64(voter.VoterId), logged["voterId"])
+				assert.Equal(t, tt.want, logged["email"])
+				assert.Equal(t, tt.want, lines[0]["email"])
+				if tt.redact {
+					assert.Equal(t, logging.RedactedValue, logged["name"])
+					assert.NotContains(t, out.String(), voter.Email)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestIDInContext(t *testing.T) {
+	var out bytes.Buffer
+	logger := logging.New(&out, logging.Options{Level: slog.LevelDebug})
+
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	assert.Equal(t, "req-1", logging.RequestID(ctx))
+	assert.Equal(t, "", logging.RequestID(context.Background()))
+
+	logger.DebugContext(ctx, "store call", "store", "voters")
+	logger.With("component", "journal").WarnContext(ctx, "dropping a torn journal record")
+	logger.Info("starting server")
+
+	lines := logLines(t, &out)
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, "req-1", lines[0][logging.RequestIDKey])
+		assert.Equal(t, "req-1", lines[1][logging.RequestIDKey])
+		assert.Equal(t, "journal", lines[1]["component"])
+		assert.NotContains(t, lines[2], logging.RequestIDKey)
+	}
+}
+
+// newTestApp serves routes behind the middlewares the way main does, the
+// handlers log with the request context
+func newTestApp(logger *slog.Logger) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Use(requestid.New())
+	app.Use(logging.Middleware(logger))
+	app.Get("/voters/:id", func(c *fiber.Ctx) error {
+		logger.InfoContext(c.UserContext(), "getting voter")
+		if c.Params("id") != "1" {
+			return db.ErrVoterNotFound
+		}
+		return c.SendString("voter 1")
+	})
+	app.Get("/broken", func(c *fiber.Ctx) error {
+		return errors.New("store is gone")
+	})
+	return app
+}
+
+func TestMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	app := newTestApp(logging.New(&out, logging.Options{}))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/voters/1?name=Jane", nil))
+	assert.Nil(t, err)
+	requestID := resp.Header.Get(fiber.HeaderXRequestID)
+	assert.NotEmpty(t, requestID)
+
+	lines := logLines(t, &out)
+	if assert.Len(t, lines, 2) {
+		// the handler line and the access log line carry the id
+		assert.Equal(t, "getting voter", lines[0]["msg"])
+		assert.Equal(t, requestID, lines[0][logging.RequestIDKey])
+
+		access := lines[1]
+		assert.Equal(t, "request", access["msg"])
+		assert.Equal(t, "INFO", access["level"])
+		assert.Equal(t, requestID, access[logging.RequestIDKey])
+		assert.Equal(t, "GET", access["method"])
+		assert.Equal(t, "/voters/1", access["path"])
+		assert.Equal(t, "/voters/:id", access["route"])
+		assert.Equal(t, float64(fiber.StatusOK), access["status"])
+		assert.Contains(t, access, "took")
+	}
+	assert.NotContains(t, out.String(), "Jane")
+}
+
+func TestMiddlewareStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		wantLevel string
+		wantRoute string
+		status    int
+	}{
+		{"NotFound", "/voters/2", "INFO", "/voters/:id", fiber.StatusNotFound},
+		{"ServerError", "/broken", "ERROR", "/broken", fiber.StatusInternalServerError},
+		{"Unmatched", "/nowhere", "INFO", "", fiber.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			app := newTestApp(logging.New(&out, logging.Options{}))
+
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode)
+
+			lines := logLines(t, &out)
+			access := lines[len(lines)-1]
+			assert.Equal(t, tt.wantLevel, access["level"])
+			assert.Equal(t, tt.wantRoute, access["route"])
+			assert.Equal(t, float64(tt.status), access["status"])
+		})
+	}
+}
+
+func TestMiddlewareKeepsRequestID(t *testing.T) {
+	var out bytes.Buffer
+	app := newTestApp(logging.New(&out, logging.Options{}))
+
+	req := httptest.NewRequest("GET", "/voters/1", nil)
+	req.Header.Set(fiber.HeaderXRequestID, "upstream-42")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "upstream-42", resp.Header.Get(fiber.HeaderXRequestID))
+
+	for _, line := range logLines(t, &out) {
+		assert.Equal(t, "upstream-42", line[logging.RequestIDKey])
+	}
+}
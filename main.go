@@ -1,107 +1,539 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/abhi2687/voter-api/api"
+	"github.com/abhi2687/voter-api/config"
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/health"
+	"github.com/abhi2687/voter-api/logging"
+	"github.com/abhi2687/voter-api/metrics"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
+// version and commit are set when the binary is linked, e.g.
+// go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD)"
 var (
-	hostFlag           string
-	portFlag           uint
-	app                *fiber.App
-	voterHandler       *api.VoterAPI
-	err                error
-	startTime          = time.Now()
-	successfulRequests = 0
-	failedRequests     = 0
+	version = "dev"
+	commit  = "unknown"
+)
+
+var (
+	cfg      config.Config
+	journal  *db.Journal
+	voterLRU *db.VoterLRU
+	// requests derive their context from serverContext, abandonRequests
+	// cancels whatever is still in flight once the drain timed out
+	serverContext, abandonRequests = context.WithCancel(context.Background())
+	sqlVoters                      *db.VoterSQL
+	stopDegradedRefresh            func()
+	stopWatchingVoters             func() error
+	redisVoters                    *db.VoterCache
+	degraded                       *db.Degraded
+	app                            *fiber.App
+	voterHandler                   *api.VoterAPI
+	pollHandler                    *api.PollAPI
+	voteHandler                    *api.VoteAPI
+	err                            error
+	startTime                      = time.Now()
+	apiMetrics                     = metrics.New()
+	probes                         *health.Probes
 )
 
 func main() {
-	processCommandLineFlag()
+	args := loadConfig()
+	initializeLogging()
+	if len(args) > 0 {
+		switch args[0] {
+		case "rebuild-tallies":
+			rebuildTallies()
+			return
+		case "migrate":
+			migrate(args[1:])
+			return
+		case "config":
+			configCommand(args[1:])
+			return
+		}
+	}
+
 	initializeAppUsingFiber()
 	initializeVoterAPIHandler()
+	initializeProbes()
 	registerHandlers()
 	StartServer()
 }
 
-// Middleware function to count successful requests
-func countSuccessfulRequests(c *fiber.Ctx) error {
-	err := c.Next()
-	if err == nil {
-		successfulRequests++
+func initializeVoterAPIHandler() {
+	voterStore, pollStore, voteStore := newStores()
+	voterStore, pollStore, voteStore = degradeStores(voterStore, pollStore, voteStore)
+	voterStore, pollStore, voteStore = db.ObserveStores(voterStore, pollStore, voteStore, observeStore)
+	voterStore, voteStore = cacheVoters(voterStore, voteStore)
+	apiMetrics.RegisterCounts(voterStore, voteStore)
+	if redisVoters != nil {
+		apiMetrics.RegisterRedisPool(redisVoters.PoolStats)
+	}
+
+	voterHandler, err = api.NewWithStore(voterStore)
+	if err != nil {
+		slog.Error("creating voter handler failed", "err", err)
+		os.Exit(1)
+	}
+
+	pollHandler, err = api.NewPollAPI(pollStore)
+	if err != nil {
+		slog.Error("creating poll handler failed", "err", err)
+		os.Exit(1)
+	}
+
+	voteHandler, err = api.NewVoteAPI(voteStore, pollStore, voterStore)
+	if err != nil {
+		slog.Error("creating vote handler failed", "err", err)
+		os.Exit(1)
 	}
-	return err
 }
 
-// Middleware function to count failed requests
-func countFailedRequests(c *fiber.Ctx) error {
-	err := c.Next()
+// observeStore times store calls for the metrics and logs them at debug
+// with the request they were made for
+func observeStore(ctx context.Context, store string, operation string, took time.Duration, err error) {
+	apiMetrics.ObserveStore(ctx, store, operation, took, err)
 	if err != nil {
-		failedRequests++
+		slog.DebugContext(ctx, "store call failed", "store", store, "operation", operation, "took", took, "err", err)
+	} else {
+		slog.DebugContext(ctx, "store call", "store", store, "operation", operation, "took", took)
 	}
-	return err
 }
 
-func initializeVoterAPIHandler() {
-	voterHandler, err = api.New()
+// initializeProbes makes readiness depend on the store newStores picked,
+// the in-memory stores have nothing to check
+func initializeProbes() {
+	probes = health.New(version, commit, cfg.Timeouts.Ready)
+	if redisVoters != nil {
+		probes.AddCheck("redis", func(ctx context.Context) error {
+			err := redisVoters.Ping(ctx)
+			if err != nil && degraded != nil && !degraded.Status().SnapshotAt.IsZero() {
+				return health.Degraded(err)
+			}
+			return err
+		})
+	}
+	if sqlVoters != nil {
+		probes.AddCheck("sqlite", sqlVoters.Ping)
+	}
+}
+
+// newStores opens the stores of the configured backend, journaled in-memory
+// stores when it is journal
+func newStores() (db.VoterStore, db.PollStore, db.VoteStore) {
+	switch cfg.Store.Backend {
+	case config.BackendSQLite:
+		slog.Info("using sqlite voter store", "path", cfg.Store.SQLite)
+		sqlVoters, err = db.NewWithSQLite(cfg.Store.SQLite)
+		if err != nil {
+			slog.Error("opening sqlite failed", "err", err)
+			os.Exit(1)
+		}
+		return sqlVoters, db.NewPollSQL(sqlVoters), db.NewVoteSQL(sqlVoters)
+
+	case config.BackendJournal:
+		slog.Info("using in-memory voter store with a journal", "dir", cfg.Store.DataDir, "fsync", cfg.Store.Fsync)
+		fsync, err := db.ParseFsyncPolicy(cfg.Store.Fsync)
+		if err != nil {
+			slog.Error("reading fsync policy failed", "err", err)
+			os.Exit(1)
+		}
+		journal, err = db.OpenJournal(cfg.Store.DataDir, fsync)
+		if err != nil {
+			slog.Error("opening journal failed", "err", err)
+			os.Exit(1)
+		}
+		return journal.Stores()
+
+	case config.BackendRedis:
+		slog.Info("using redis voter store", "addr", cfg.Redis.Addr, "db", cfg.Redis.DB, "tls", cfg.Redis.TLS)
+		redisVoters, err = db.NewWithRedisConfig(redisConfig())
+		if err != nil {
+			slog.Error("creating voter store failed", "err", err)
+			os.Exit(1)
+		}
+		return redisVoters, db.NewPollCache(redisVoters), db.NewVoteCache(redisVoters)
+	}
+
+	slog.Info("using in-memory voter store")
+	voterList, err := db.New()
+	if err != nil {
+		slog.Error("creating voter store failed", "err", err)
+		os.Exit(1)
+	}
+	pollList, err := db.NewPollList(voterList)
+	if err != nil {
+		slog.Error("creating poll store failed", "err", err)
+		os.Exit(1)
+	}
+	voteList, err := db.NewVoteList(voterList)
+	if err != nil {
+		slog.Error("creating vote store failed", "err", err)
+		os.Exit(1)
+	}
+	return voterList, pollList, voteList
+}
+
+// redisConfig is how the redis stores connect, with TLS the certificate is
+// checked against the host of the address
+func redisConfig() db.RedisConfig {
+	redisConfig := db.RedisConfig{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+		PoolSize: cfg.Redis.PoolSize,
+	}
+	if cfg.Redis.TLS {
+		host, _, err := net.SplitHostPort(cfg.Redis.Addr)
+		if err != nil {
+			host = cfg.Redis.Addr
+		}
+		redisConfig.TLS = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	}
+	return redisConfig
+}
+
+// degradeStores snapshots redis every redis.degradedRefresh and answers reads
+// from the snapshot while redis is down, other stores are kept as they are
+func degradeStores(voterStore db.VoterStore, pollStore db.PollStore, voteStore db.VoteStore) (db.VoterStore, db.PollStore, db.VoteStore) {
+	if redisVoters == nil || cfg.Redis.DegradedRefresh <= 0 {
+		return voterStore, pollStore, voteStore
+	}
+
+	slog.Info("snapshotting redis for reads while it is down", "every", cfg.Redis.DegradedRefresh)
+	degraded = db.NewDegraded(redisVoters)
+	stopDegradedRefresh = degraded.RefreshEvery(cfg.Redis.DegradedRefresh, func(err error) {
+		slog.Warn("refreshing the redis snapshot failed, keeping the last one", "err", err)
+	})
+
+	return degraded.Stores()
+}
+
+// watchVoterChangesRetry is how long cacheVoters waits before it tries to
+// subscribe to voter changes again
+const watchVoterChangesRetry = 5 * time.Second
+
+// cacheVoters puts a VoterLRU in front of voterStore when cache.size is set.
+// With redis and features.watchVoterChanges every replica drops the voters
+// the others changed through keyspace notifications.
+func cacheVoters(voterStore db.VoterStore, voteStore db.VoteStore) (db.VoterStore, db.VoteStore) {
+	if cfg.Cache.Size <= 0 {
+		return voterStore, voteStore
+	}
+
+	slog.Info("caching voters", "size", cfg.Cache.Size, "ttl", cfg.Cache.TTL)
+	voterLRU = db.NewVoterLRU(voterStore, cfg.Cache.Size, cfg.Cache.TTL)
+	if redisVoters != nil && cfg.Features.WatchVoterChanges {
+		// until the changes of other replicas are watched the cache could
+		// serve voters they changed, so it is left out until then
+		voterLRU.SetBypassed(true)
+		stopWatchingVoters = redisVoters.KeepWatchingVoterChanges(watchVoterChangesRetry, voterLRU.Invalidate, func() {
+			slog.Warn("voter changes may have been missed while redis was disconnected, dropping the cached voters")
+			voterLRU.Purge()
+		}, func() {
+			slog.Info("watching voter changes")
+			voterLRU.SetBypassed(false)
+		}, func(err error) {
+			slog.Warn("watching voter changes failed, voters are not cached until it works", "err", err, "retryIn", watchVoterChangesRetry)
+		})
+	}
+
+	return voterLRU, voterLRU.WrapVoteStore(voteStore)
+}
+
+// rebuildTallies recounts every poll tally from the stored votes and lists
+// the polls whose tally had drifted, run as `voter-api -r <addr> rebuild-tallies`
+func rebuildTallies() {
+	_, _, voteStore := newStores()
+
+	drifts, err := voteStore.RebuildTallies(context.Background())
+	if err != nil {
+		fmt.Printf("Error rebuilding tallies: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, drift := range drifts {
+		fmt.Printf("poll %d: stored %d ballots %v, rebuilt %d ballots %v\n",
+			drift.PollId, drift.Stored.Total, drift.Stored.Counts, drift.Rebuilt.Total, drift.Rebuilt.Counts)
+	}
+	fmt.Printf("Rebuilt tallies, %d polls had drifted\n", len(drifts))
+	if err := closeStores(); err != nil {
+		fmt.Printf("Error closing stores: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// migrate upgrades every voter document in redis to the current schema
+// version, run as `voter-api -r <addr> migrate [-dry-run]`
+func migrate(args []string) {
+	migrateFlags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := migrateFlags.Bool("dry-run", false, "Only count the documents that would be upgraded")
+	migrateFlags.Parse(args)
+
+	if cfg.Store.Backend != config.BackendRedis {
+		fmt.Println("migrate upgrades redis documents, pass the redis address with -r or VOTER_API_REDIS_ADDR")
+		os.Exit(1)
+	}
+	voterCache, err := db.NewWithRedisConfig(redisConfig())
+	if err != nil {
+		fmt.Printf("Error creating voter store: %v\n", err)
+		os.Exit(1)
+	}
+	defer voterCache.Close()
+
+	verb := "upgraded"
+	if *dryRun {
+		verb = "would upgrade"
+	}
+	report, err := voterCache.MigrateVoters(context.Background(), *dryRun, func(progress db.MigrationProgress) {
+		fmt.Printf("scanned %d of about %d voters, %s %d, %d failed\n",
+			progress.Scanned, progress.Total, verb, progress.Upgraded, progress.Failed)
+	})
 	if err != nil {
-		fmt.Printf("Error creating voter handler: %v\n", err)
+		fmt.Printf("Error migrating voters: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Voters are at schema version %d: scanned %d, %s %d, %d failed\n",
+		db.VoterSchemaVersion, report.Scanned, verb, report.Upgraded, report.Failed)
+	if report.Failed > 0 {
 		os.Exit(1)
 	}
 }
 
 func registerHandlers() {
+	app.Get("/livez", probes.Live)
+	app.Get("/readyz", probes.Ready)
 	app.Get("/voters/health", HealthCheck)
+	if cfg.Features.Metrics {
+		app.Get("/metrics", apiMetrics.Handler())
+	}
 	app.Post("/voters", voterHandler.AddVoter)
 	app.Delete("/voters", voterHandler.DeleteAllVoters)
-	app.Get("/voters/:id", voterHandler.GetVoter)
-	app.Get("/voters", voterHandler.GetAllVoters)
+	app.Get("/voters/:id", voterHandler.GetVoter).Name(api.RouteVoter)
+	app.Get("/voters", voterHandler.GetAllVoters).Name(api.RouteVoters)
 	app.Put("/voters/:id", voterHandler.UpdateVoter)
+	app.Patch("/voters/:id", voterHandler.PatchVoter)
 	app.Delete("/voters/:id", voterHandler.DeleteVoter)
-	app.Get("/voters/:id/polls", voterHandler.GetVoterPolls)
+	app.Get("/voters/:id/polls", voterHandler.GetVoterPolls).Name(api.RouteVoterPolls)
+	app.Get("/voters/:id/history", voterHandler.GetVoterPolls).Name(api.RouteVoterHistory)
 	app.Post("/voters/:id/polls", voterHandler.AddVoterPoll)
-	app.Get("/voters/:id/polls/:pollid", voterHandler.GetVoterPoll)
+	app.Get("/voters/:id/polls/:pollid", voterHandler.GetVoterPoll).Name(api.RouteVoterPoll)
 	app.Put("/voters/:id/polls/:pollid", voterHandler.UpdateVoterPoll)
 	app.Delete("/voters/:id/polls/:pollid", voterHandler.DeleteVoterPoll)
+	app.Post("/voters/:id/vote", voteHandler.CastVoterVote).Name(api.RouteVoterVote)
+
+	app.Post("/polls", pollHandler.AddPoll)
+	app.Delete("/polls", pollHandler.DeleteAllPolls)
+	app.Get("/polls/:id", pollHandler.GetPoll).Name(api.RoutePoll)
+	app.Get("/polls", pollHandler.GetAllPolls).Name(api.RoutePolls)
+	app.Put("/polls/:id", pollHandler.UpdatePoll)
+	app.Delete("/polls/:id", pollHandler.DeletePoll)
+	app.Get("/polls/:id/options", pollHandler.GetPollOptions).Name(api.RoutePollOptions)
+	app.Post("/polls/:id/options", pollHandler.AddPollOption)
+	app.Get("/polls/:id/options/:optionid", pollHandler.GetPollOption).Name(api.RoutePollOption)
+	app.Delete("/polls/:id/options/:optionid", pollHandler.DeletePollOption)
+	app.Get("/polls/:id/results", voteHandler.GetPollResults).Name(api.RoutePollResults)
+
+	app.Post("/votes", voteHandler.CastVote)
+	app.Delete("/votes", voteHandler.DeleteAllVotes)
+	app.Get("/votes/:id", voteHandler.GetVote).Name(api.RouteVote)
+	app.Get("/votes", voteHandler.GetAllVotes).Name(api.RouteVotes)
 }
 
 func initializeAppUsingFiber() {
-	app = fiber.New()
-	app.Use(cors.New())
+	// the server logs its own start, the banner is not a log line
+	app = fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler, DisableStartupMessage: true})
+	app.Use(requestid.New())
+	app.Use(api.RequestDeadline(serverContext, cfg.Timeouts.Request))
+	// outside recover so panics are logged and counted as the 500 they are
+	// answered with
+	app.Use(logging.Middleware(slog.Default()))
+	app.Use(apiMetrics.Middleware())
+	app.Use(cors.New(cors.Config{AllowOrigins: strings.Join(cfg.CORS.Origins, ",")}))
 	app.Use(recover.New())
-	app.Use(countSuccessfulRequests, countFailedRequests)
 }
 
-func processCommandLineFlag() {
-	flag.StringVar(&hostFlag, "h", "0.0.0.0", "Listen on all interfaces")
-	flag.UintVar(&portFlag, "p", 1080, "Default Port")
-	flag.Parse()
+// loadConfig loads the config from the file, environment and flags and
+// returns the arguments left after the flags, an invalid config ends the
+// process with every problem listed
+func loadConfig() []string {
+	var args []string
+	cfg, args, err = config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Printf("Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	return args
+}
+
+// initializeLogging writes log lines at log.level or above to stderr as
+// log.format, lines of the log package are written at info
+func initializeLogging() {
+	level, _ := cfg.Log.SlogLevel()
+	slog.SetDefault(logging.New(os.Stderr, logging.Options{
+		Level:  level,
+		Format: cfg.Log.Format,
+		Redact: cfg.Log.Redact,
+	}))
 }
 
+// configCommand prints the config the server would run with as YAML with its
+// secrets redacted, run as `voter-api [flags] config print`
+func configCommand(args []string) {
+	if len(args) != 1 || args[0] != "print" {
+		fmt.Println("usage: voter-api [flags] config print")
+		os.Exit(2)
+	}
+
+	out, err := cfg.Redact().YAML()
+	if err != nil {
+		fmt.Printf("Error printing config: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(out)
+}
+
+// Exit codes of the server
+const (
+	exitOK = 0
+	// exitServeFailed is used when the server could not listen or stopped
+	// serving by itself
+	exitServeFailed = 1
+	// exitUnclean is used when requests had to be abandoned or a store could
+	// not be flushed and closed on shutdown
+	exitUnclean = 2
+)
+
+// StartServer serves until SIGINT or SIGTERM, then reports not ready for
+// timeouts.drainDelay, stops taking connections, gives requests in flight
+// timeouts.shutdown to finish and closes the stores before it exits. A
+// second signal during the shutdown kills the process.
 func StartServer() {
-	// Start the server
-	serverPath := fmt.Sprintf("%s:%d", hostFlag, portFlag)
-	log.Println("Starting server on ", serverPath)
-	app.Listen(serverPath)
+	serverPath := net.JoinHostPort(cfg.Host, strconv.FormatUint(uint64(cfg.Port), 10))
+	slog.Info("starting server", "addr", serverPath, "version", version, "commit", commit)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- app.Listen(serverPath)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-served:
+		slog.Error("serving failed", "err", err)
+		if err := closeStores(); err != nil {
+			slog.Error("closing stores failed", "err", err)
+		}
+		os.Exit(exitServeFailed)
+	case sig := <-signals:
+		slog.Info("draining requests", "signal", sig.String(), "timeout", cfg.Timeouts.Shutdown)
+	}
+	signal.Stop(signals)
+
+	// load balancers stop sending requests once readiness fails, the ones
+	// still arriving meanwhile are served
+	probes.Drain()
+	if cfg.Timeouts.DrainDelay > 0 {
+		slog.Info("reporting not ready before draining", "delay", cfg.Timeouts.DrainDelay)
+		time.Sleep(cfg.Timeouts.DrainDelay)
+	}
+
+	code := exitOK
+	if err := app.ShutdownWithTimeout(cfg.Timeouts.Shutdown); err != nil {
+		slog.Error("draining requests failed, abandoning the rest", "err", err)
+		code = exitUnclean
+	}
+	abandonRequests()
+
+	if err := closeStores(); err != nil {
+		slog.Error("closing stores failed", "err", err)
+		code = exitUnclean
+	}
+	slog.Info("server stopped", "exitCode", code)
+	os.Exit(code)
+}
+
+// closeStores stops the background work on the stores, flushes the journal
+// and closes the connections newStores opened
+func closeStores() error {
+	var errs []error
+	if stopDegradedRefresh != nil {
+		stopDegradedRefresh()
+	}
+	if stopWatchingVoters != nil {
+		errs = append(errs, stopWatchingVoters())
+	}
+	if journal != nil {
+		errs = append(errs, journal.Close())
+	}
+	if sqlVoters != nil {
+		errs = append(errs, sqlVoters.Close())
+	}
+	if redisVoters != nil {
+		errs = append(errs, redisVoters.Close())
+	}
+
+	return errors.Join(errs...)
 }
 
 func HealthCheck(c *fiber.Ctx) error {
 	uptime := time.Since(startTime).Seconds()
-	return c.Status(http.StatusOK).
-		JSON(fiber.Map{
-			"status":             "ok",
-			"version":            "1.0.0",
-			"uptime":             uptime,
-			"successfulRequests": successfulRequests,
-			"failedRequest":      failedRequests,
-		})
+	successfulRequests, failedRequests := apiMetrics.Requests()
+	health := fiber.Map{
+		"status":             "ok",
+		"version":            version,
+		"commit":             commit,
+		"uptime":             uptime,
+		"successfulRequests": successfulRequests,
+		"failedRequest":      failedRequests,
+	}
+	if voterLRU != nil {
+		health["voterCache"] = voterLRU.Stats()
+	}
+
+	// while redis is down the replica is only of use with a snapshot to
+	// answer reads from
+	status := http.StatusOK
+	if redisVoters != nil {
+		if err := redisVoters.Ping(c.UserContext()); err != nil {
+			health["status"] = "unavailable"
+			status = http.StatusServiceUnavailable
+			if degraded != nil && !degraded.Status().SnapshotAt.IsZero() {
+				health["status"] = "degraded"
+				status = http.StatusOK
+			}
+		}
+		health["redis"] = redisVoters.BreakerState()
+	}
+	if degraded != nil {
+		health["snapshot"] = degraded.Status()
+	}
+
+	return c.Status(status).JSON(health)
 }
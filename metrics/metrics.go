@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+)
+
+// Namespace prefixes the name of every metric
+const Namespace = "voterapi"
+
+// UnmatchedRoute is the route label of requests no route was registered
+// for, unknown paths do not get a series each
+const UnmatchedRoute = "unmatched"
+
+// CountTimeout bounds how long a scrape waits on the stores for the voter
+// and vote counts
+const CountTimeout = 2 * time.Second
+
+// Metrics are the Prometheus metrics of the api, kept in a registry of their
+// own and safe for concurrent use
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	storeDuration   *prometheus.HistogramVec
+
+	succeeded atomic.Uint64
+	failed    atomic.Uint64
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "http_requests_total",
+			Help:      "Requests answered, by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "How long requests took to answer, by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "store_operation_duration_seconds",
+			Help:      "How long store calls took, by store, operation and whether they failed.",
+			Buckets:   []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"store", "operation", "result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.storeDuration,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// Middleware counts and times every request. Handlers return errors before
+// their status is known, so an error is answered here with the error handler
+// of the app and not passed on; the middleware has to come before any that
+// look at the status.
+func (m *Metrics) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		middleware := c.Route()
+
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		// the route is still this middleware when no handler matched
+		route := c.Route().Path
+		if c.Route() == middleware {
+			route = UnmatchedRoute
+		}
+		status := c.Response().StatusCode()
+		labels := prometheus.Labels{"route": route, "method": c.Method(), "status": strconv.Itoa(status)}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+
+		if status < fiber.StatusBadRequest {
+			m.succeeded.Add(1)
+		} else {
+			m.failed.Add(1)
+		}
+		return nil
+	}
+}
+
+// Requests returns how many requests were answered with a status below 400
+// and how many with an error status
+func (m *Metrics) Requests() (succeeded uint64, failed uint64) {
+	return m.succeeded.Load(), m.failed.Load()
+}
+
+// ObserveStore records a store call, it is a db.StoreObserver
+func (m *Metrics) ObserveStore(ctx context.Context, store string, operation string, took time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.storeDuration.WithLabelValues(store, operation, result).Observe(took.Seconds())
+}
+
+// RegisterRedisPool reports the connection pool stats of a redis client
+func (m *Metrics) RegisterRedisPool(poolStats func() *redis.PoolStats) {
+	counter := func(name string, help string, value func(stats *redis.PoolStats) uint32) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "redis_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(poolStats())) })
+	}
+	gauge := func(name string, help string, value func(stats *redis.PoolStats) uint32) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "redis_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(poolStats())) })
+	}
+
+	m.registry.MustRegister(
+		counter("hits_total", "Connections taken from the pool that were free.",
+			func(stats *redis.PoolStats) uint32 { return stats.Hits }),
+		counter("misses_total", "Connections the pool had to open.",
+			func(stats *redis.PoolStats) uint32 { return stats.Misses }),
+		counter("timeouts_total", "Waits for a free connection that timed out.",
+			func(stats *redis.PoolStats) uint32 { return stats.Timeouts }),
+		counter("stale_connections_total", "Connections removed from the pool as stale.",
+			func(stats *redis.PoolStats) uint32 { return stats.StaleConns }),
+		gauge("connections", "Connections in the pool.",
+			func(stats *redis.PoolStats) uint32 { return stats.TotalConns }),
+		gauge("idle_connections", "Idle connections in the pool.",
+			func(stats *redis.PoolStats) uint32 { return stats.IdleConns }),
+	)
+}
+
+// RegisterCounts reports how many voters are registered and votes were cast,
+// both are counted from the stores on every scrape
+func (m *Metrics) RegisterCounts(voters db.VoterStore, votes db.VoteStore) {
+	m.registry.MustRegister(&countCollector{voters: voters, votes: votes})
+}
+
+// countCollector leaves a count out of the scrape when its store fails
+type countCollector struct {
+	voters db.VoterStore
+	votes  db.VoteStore
+}
+
+var (
+	votersDesc = prometheus.NewDesc(Namespace+"_voters_registered", "Voters registered.", nil, nil)
+	votesDesc  = prometheus.NewDesc(Namespace+"_votes_cast", "Votes cast.", nil, nil)
+)
+
+func (c *countCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- votersDesc
+	descs <- votesDesc
+}
+
+func (c *countCollector) Collect(metrics chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), CountTimeout)
+	defer cancel()
+
+	if count, err := c.voters.CountVoters(ctx); err == nil {
+		metrics <- prometheus.MustNewConstMetric(votersDesc, prometheus.GaugeValue, float64(count))
+	}
+	if count, err := c.votes.CountVotes(ctx); err == nil {
+		metrics <- prometheus.MustNewConstMetric(votesDesc, prometheus.GaugeValue, float64(count))
+	}
+}
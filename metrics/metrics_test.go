@@ -0,0 +1,180 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abhi2687/voter-api/api"
+	"github.com/abhi2687/voter-api/db"
+	"github.com/abhi2687/voter-api/metrics"
+	"github.com/abhi2687/voter-api/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestApp serves a route that succeeds, one that fails with a store error
+// and one that panics behind the metrics middleware
+func newTestApp(m *metrics.Metrics) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Use(m.Middleware())
+	app.Use(recover.New())
+	app.Get("/metrics", m.Handler())
+	app.Get("/voters/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") != "1" {
+			return db.ErrVoterNotFound
+		}
+		return c.SendString("voter 1")
+	})
+	app.Get("/panic", func(c *fiber.Ctx) error {
+		panic("handler bug")
+	})
+	return app
+}
+
+// scrape returns the metrics served by app
+func scrape(t *testing.T, app *fiber.App) string {
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	if err != nil {
+		t.Fatalf("Failed to scrape metrics: %v", err)
+	}
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+	return string(body)
+}
+
+func TestRequestMetrics(t *testing.T) {
+	m := metrics.New()
+	app := newTestApp(m)
+
+	for _, path := range []string{"/voters/1", "/voters/1", "/voters/2", "/panic", "/nowhere"} {
+		_, err := app.Test(httptest.NewRequest("GET", path, nil))
+		assert.Nil(t, err)
+	}
+
+	succeeded, failed := m.Requests()
+	assert.Equal(t, uint64(2), succeeded)
+	assert.Equal(t, uint64(3), failed)
+
+	body := scrape(t, app)
+	for _, series := range []string{
+		`voterapi_http_requests_total{method="GET",route="/voters/:id",status="200"} 2`,
+		`voterapi_http_requests_total{method="GET",route="/voters/:id",status="404"} 1`,
+		`voterapi_http_requests_total{method="GET",route="/panic",status="500"} 1`,
+		`voterapi_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`voterapi_http_request_duration_seconds_count{method="GET",route="/voters/:id",status="200"} 2`,
+		`go_goroutines`,
+	} {
+		assert.Contains(t, body, series)
+	}
+	assert.NotContains(t, body, `route="/nowhere"`)
+}
+
+func TestStoreMetrics(t *testing.T) {
+	ctx := context.Background()
+	m := metrics.New()
+	m.ObserveStore(ctx, "voters", "GetVoter", time.Millisecond, nil)
+	m.ObserveStore(ctx, "voters", "GetVoter", time.Millisecond, db.ErrVoterNotFound)
+	m.ObserveStore(ctx, "votes", "CastVote", time.Millisecond, nil)
+
+	body := scrape(t, newTestApp(m))
+	for _, series := range []string{
+		`voterapi_store_operation_duration_seconds_count{operation="GetVoter",result="ok",store="voters"} 1`,
+		`voterapi_store_operation_duration_seconds_count{operation="GetVoter",result="error",store="voters"} 1`,
+		`voterapi_store_operation_duration_seconds_count{operation="CastVote",result="ok",store="votes"} 1`,
+	} {
+		assert.Contains(t, body, series)
+	}
+}
+
+// failingVotes is a VoteStore whose count always fails
+type failingVotes struct {
+	db.VoteStore
+}
+
+func (failingVotes) CountVotes(ctx context.Context) (int, error) {
+	return 0, errors.New("votes are gone")
+}
+
+// countOnlyVoters is a VoterStore that can be counted but not queried, a
+// scrape must not walk the voters
+type countOnlyVoters struct {
+	db.VoterStore
+}
+
+func (countOnlyVoters) QueryVoters(ctx context.Context, query db.VoterQuery) (db.VoterPage, error) {
+	return db.VoterPage{}, errors.New("voters were walked")
+}
+
+func TestCountMetrics(t *testing.T) {
+	ctx := context.Background()
+	voterList, _ := db.New()
+	voteList, _ := db.NewVoteList(voterList)
+	for id := uint(1); id <= 3; id++ {
+		assert.Nil(t, voterList.AddVoter(ctx, testutils.NewRandVoter(id)))
+	}
+	_, err := voteList.CastVote(ctx, db.Vote{VoterId: 1, PollId: 1, OptionId: 1})
+	assert.Nil(t, err)
+
+	m := metrics.New()
+	m.RegisterCounts(countOnlyVoters{voterList}, voteList)
+	body := scrape(t, newTestApp(m))
+	assert.Contains(t, body, "voterapi_voters_registered 3")
+	assert.Contains(t, body, "voterapi_votes_cast 1")
+
+	// a count that fails is left out instead of failing the scrape
+	m = metrics.New()
+	m.RegisterCounts(voterList, failingVotes{voteList})
+	body = scrape(t, newTestApp(m))
+	assert.Contains(t, body, "voterapi_voters_registered 3")
+	assert.NotContains(t, body, "voterapi_votes_cast")
+}
+
+func TestRedisPoolMetrics(t *testing.T) {
+	m := metrics.New()
+	m.RegisterRedisPool(func() *redis.PoolStats {
+		return &redis.PoolStats{Hits: 7, Misses: 2, TotalConns: 3, IdleConns: 1}
+	})
+
+	body := scrape(t, newTestApp(m))
+	for _, series := range []string{
+		"voterapi_redis_pool_hits_total 7",
+		"voterapi_redis_pool_misses_total 2",
+		"voterapi_redis_pool_timeouts_total 0",
+		"voterapi_redis_pool_connections 3",
+		"voterapi_redis_pool_idle_connections 1",
+	} {
+		assert.Contains(t, body, series)
+	}
+}
+
+func TestRequestsAreSafeForConcurrentUse(t *testing.T) {
+	m := metrics.New()
+	app := newTestApp(m)
+
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 25; j++ {
+				_, _ = app.Test(httptest.NewRequest("GET", "/voters/1", nil))
+			}
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+
+	succeeded, failed := m.Requests()
+	assert.Equal(t, uint64(200), succeeded)
+	assert.Equal(t, uint64(0), failed)
+}
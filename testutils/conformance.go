@@ -0,0 +1,607 @@
+package testutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// ctx is what the conformance cases call the stores with
+var ctx = context.Background()
+
+// StoreFactory returns an empty VoterStore for a single conformance case
+// together with the PollStore the polls of its vote history live in
+type StoreFactory func(t *testing.T) (db.VoterStore, db.PollStore)
+
+// conformancePollIds are the polls the cases name in vote history, they are
+// added to every fresh PollStore
+var conformancePollIds = []uint{1, 2, 3, 4, 101}
+
+// RunVoterStoreConformance checks that a VoterStore backend behaves like every
+// other backend. Each case gets fresh stores from newStore.
+func RunVoterStoreConformance(t *testing.T, newStore StoreFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store db.VoterStore)
+	}{
+		{"AddAndGetVoter", conformAddAndGetVoter},
+		{"DuplicateVoter", conformDuplicateVoter},
+		{"VoterDoesNotExist", conformVoterDoesNotExist},
+		{"GetAllVoters", conformGetAllVoters},
+		{"DeleteAllVoters", conformDeleteAllVoters},
+		{"DeleteVoter", conformDeleteVoter},
+		{"UpdateVoterPreservesHistory", conformUpdateVoterPreservesHistory},
+		{"UpdateVoterIdMismatch", conformUpdateVoterIdMismatch},
+		{"PatchVoter", conformPatchVoter},
+		{"Revisions", conformRevisions},
+		{"DuplicatePoll", conformDuplicatePoll},
+		{"PollDoesNotExist", conformPollDoesNotExist},
+		{"UpdateVoterPollKeepsPollId", conformUpdateVoterPollKeepsPollId},
+		{"DeleteVoterPollKeepsOrder", conformDeleteVoterPollKeepsOrder},
+		{"QueryVoters", conformQueryVoters},
+		{"InvalidVoter", conformInvalidVoter},
+		{"InvalidVoterPoll", conformInvalidVoterPoll},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			voters, _ := newConformanceStores(t, newStore)
+			tt.run(t, voters)
+		})
+	}
+
+	t.Run("HistoryNeedsPoll", func(t *testing.T) {
+		voters, polls := newConformanceStores(t, newStore)
+		conformHistoryNeedsPoll(t, voters, polls)
+	})
+}
+
+// newConformanceStores returns fresh stores from newStore with the
+// conformancePollIds added
+func newConformanceStores(t *testing.T, newStore StoreFactory) (db.VoterStore, db.PollStore) {
+	voters, polls := newStore(t)
+	for _, pollId := range conformancePollIds {
+		if err := polls.AddPoll(ctx, NewRandPoll(pollId, 1)); err != nil {
+			t.Fatalf("failed to add poll %d: %v", pollId, err)
+		}
+	}
+
+	return voters, polls
+}
+
+func conformHistoryNeedsPoll(t *testing.T, voters db.VoterStore, polls db.PollStore) {
+	voter1 := NewRandVoter(1)
+	assert.Nil(t, voters.AddVoter(ctx, voter1))
+
+	err := voters.AddVoterPoll(ctx, NewRandPollVoteRecord(9), voter1.VoterId)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "poll does not exist", err.Error())
+		assert.ErrorIs(t, err, db.ErrPollNotFound)
+	}
+
+	// an entry whose poll was deleted can not be changed any more
+	assert.Nil(t, voters.AddVoterPoll(ctx, NewRandPollVoteRecord(1), voter1.VoterId))
+	assert.Nil(t, polls.DeletePoll(ctx, 1))
+	err = voters.UpdateVoterPoll(ctx, NewRandPollVoteRecord(1), voter1.VoterId, 1)
+	assert.ErrorIs(t, err, db.ErrPollNotFound)
+
+	voter, err := voters.GetVoter(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Len(t, voter.VoteHistory, 1)
+	assert.Equal(t, uint64(2), voter.Revision)
+}
+
+func conformAddAndGetVoter(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+
+	assert.Nil(t, store.AddVoter(ctx, voter1))
+
+	voter, err := store.GetVoter(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, AsAdded(voter1), voter)
+}
+
+func conformDuplicateVoter(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+	assert.Nil(t, store.AddVoter(ctx, voter1))
+
+	// the second add must fail and leave the first voter untouched
+	duplicate := NewRandVoter(1)
+	err := store.AddVoter(ctx, duplicate)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "voter already exists", err.Error())
+		assert.ErrorIs(t, err, db.ErrVoterExists)
+	}
+
+	voter, err := store.GetVoter(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, AsAdded(voter1), voter)
+}
+
+func conformVoterDoesNotExist(t *testing.T, store db.VoterStore) {
+	voterId := uint(1)
+	poll1 := NewRandPollVoteRecord(1)
+
+	calls := map[string]func() error{
+		"GetVoter": func() error {
+			_, err := store.GetVoter(ctx, voterId)
+			return err
+		},
+		"UpdateVoter": func() error {
+			_, err := store.UpdateVoter(ctx, NewRandVoter(voterId), voterId, 0)
+			return err
+		},
+		"DeleteVoter": func() error {
+			return store.DeleteVoter(ctx, voterId, 0)
+		},
+		"GetVoterPolls": func() error {
+			_, err := store.GetVoterPolls(ctx, voterId)
+			return err
+		},
+		"AddVoterPoll": func() error {
+			return store.AddVoterPoll(ctx, poll1, voterId)
+		},
+		"GetVoterPoll": func() error {
+			_, err := store.GetVoterPoll(ctx, voterId, poll1.PollId)
+			return err
+		},
+		"UpdateVoterPoll": func() error {
+			return store.UpdateVoterPoll(ctx, poll1, voterId, poll1.PollId)
+		},
+		"DeleteVoterPoll": func() error {
+			return store.DeleteVoterPoll(ctx, voterId, poll1.PollId)
+		},
+	}
+
+	for name, call := range calls {
+		err := call()
+		if assert.NotNil(t, err, name) {
+			assert.Equal(t, "voter does not exist", err.Error(), name)
+			assert.ErrorIs(t, err, db.ErrVoterNotFound, name)
+		}
+	}
+}
+
+func conformGetAllVoters(t *testing.T, store db.VoterStore) {
+	assert.Empty(t, store.GetAllVoters(ctx))
+	count, err := store.CountVoters(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	voter1 := NewRandVoter(1)
+	voter2 := NewRandVoter(2)
+	store.AddVoter(ctx, voter1)
+	store.AddVoter(ctx, voter2)
+
+	voters := store.GetAllVoters(ctx)
+	assert.Equal(t, 2, len(voters))
+	assert.Contains(t, voters, AsAdded(voter1))
+	assert.Contains(t, voters, AsAdded(voter2))
+	count, err = store.CountVoters(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func conformDeleteAllVoters(t *testing.T, store db.VoterStore) {
+	store.AddVoter(ctx, NewRandVoter(1))
+	store.AddVoter(ctx, NewRandVoter(2))
+
+	store.DeleteAllVoters(ctx)
+	assert.Empty(t, store.GetAllVoters(ctx))
+}
+
+func conformDeleteVoter(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+	voter2 := NewRandVoter(2)
+	store.AddVoter(ctx, voter1)
+	store.AddVoter(ctx, voter2)
+
+	assert.Nil(t, store.DeleteVoter(ctx, voter1.VoterId, 0))
+
+	_, err := store.GetVoter(ctx, voter1.VoterId)
+	assert.NotNil(t, err)
+	assert.Equal(t, []db.Voter{AsAdded(voter2)}, store.GetAllVoters(ctx))
+}
+
+func conformUpdateVoterPreservesHistory(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+	poll1 := NewRandPollVoteRecord(1)
+	store.AddVoter(ctx, voter1)
+	store.AddVoterPoll(ctx, poll1, voter1.VoterId)
+
+	// the update body carries no history and leaves the id out
+	update := NewRandVoter(0)
+	updated, err := store.UpdateVoter(ctx, update, voter1.VoterId, 0)
+	assert.Nil(t, err)
+
+	// the updated voter is answered as it was stored
+	voter, err := store.GetVoter(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, voter, updated)
+	assert.Equal(t, db.FirstRevision+2, updated.Revision)
+	assert.Equal(t, voter1.VoterId, voter.VoterId)
+	assert.Equal(t, update.Name, voter.Name)
+	assert.Equal(t, update.Email, voter.Email)
+	assert.Equal(t, []db.VoterHistory{poll1}, voter.VoteHistory)
+
+	// history in the body does not replace the stored one either
+	update = NewRandVoter(voter1.VoterId)
+	update.VoteHistory = []db.VoterHistory{NewRandPollVoteRecord(2)}
+	_, err = store.UpdateVoter(ctx, update, voter1.VoterId, 0)
+	assert.Nil(t, err)
+
+	voter, err = store.GetVoter(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, update.Name, voter.Name)
+	assert.Equal(t, []db.VoterHistory{poll1}, voter.VoteHistory)
+}
+
+func conformUpdateVoterIdMismatch(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+	store.AddVoter(ctx, voter1)
+
+	// a body naming another voter is refused instead of updating either
+	_, err := store.UpdateVoter(ctx, NewRandVoter(2), voter1.VoterId, 0)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "voterId does not match the path", err.Error())
+		assert.ErrorIs(t, err, db.ErrVoterIdMismatch)
+	}
+
+	voter, err := store.GetVoter(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, AsAdded(voter1), voter)
+
+	_, err = store.GetVoter(ctx, 2)
+	assert.ErrorIs(t, err, db.ErrVoterNotFound)
+}
+
+func conformPatchVoter(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+	poll1 := NewRandPollVoteRecord(1)
+	store.AddVoter(ctx, voter1)
+	store.AddVoterPoll(ctx, poll1, voter1.VoterId)
+
+	// the patch sees the stored voter and may only change name and email
+	newName := NewRandVoter(0).Name
+	voter, err := store.PatchVoter(ctx, voter1.VoterId, 0, func(voter db.Voter) (db.Voter, error) {
+		assert.Equal(t, voter1.Email, voter.Email)
+		assert.Equal(t, []db.VoterHistory{poll1}, voter.VoteHistory)
+		voter.Name = newName
+		voter.VoteHistory = nil
+		return voter, nil
+	})
+	assert.Nil(t, err)
+
+	// added, history recorded, patched
+	expected := voter1
+	expected.Name = newName
+	expected.VoteHistory = []db.VoterHistory{poll1}
+	expected.Revision = 3
+	assert.Equal(t, expected, voter)
+	voter, _ = store.GetVoter(ctx, voter1.VoterId)
+	assert.Equal(t, expected, voter)
+
+	failed := errors.New("patch failed")
+	rejected := map[string]struct {
+		patch db.VoterPatch
+		err   error
+	}{
+		"Error": {func(voter db.Voter) (db.Voter, error) {
+			return db.Voter{}, failed
+		}, failed},
+		"VoterId": {func(voter db.Voter) (db.Voter, error) {
+			voter.VoterId = 2
+			return voter, nil
+		}, db.ErrVoterIdMismatch},
+		"Invalid": {func(voter db.Voter) (db.Voter, error) {
+			voter.Email = "not-an-email"
+			return voter, nil
+		}, db.ErrValidation},
+	}
+	for name, tt := range rejected {
+		_, err := store.PatchVoter(ctx, voter1.VoterId, 0, tt.patch)
+		assert.ErrorIs(t, err, tt.err, name)
+	}
+
+	voter, _ = store.GetVoter(ctx, voter1.VoterId)
+	assert.Equal(t, expected, voter)
+
+	_, err = store.PatchVoter(ctx, 2, 0, func(voter db.Voter) (db.Voter, error) {
+		return voter, nil
+	})
+	assert.ErrorIs(t, err, db.ErrVoterNotFound)
+}
+
+func conformDuplicatePoll(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+	poll1 := NewRandPollVoteRecord(1)
+	store.AddVoter(ctx, voter1)
+
+	assert.Nil(t, store.AddVoterPoll(ctx, poll1, voter1.VoterId))
+
+	err := store.AddVoterPoll(ctx, NewRandPollVoteRecord(1), voter1.VoterId)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "poll already exists", err.Error())
+		assert.ErrorIs(t, err, db.ErrPollExists)
+	}
+
+	voterPolls, err := store.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, []db.VoterHistory{poll1}, voterPolls)
+}
+
+func conformPollDoesNotExist(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+	poll1 := NewRandPollVoteRecord(1)
+	poll2 := NewRandPollVoteRecord(2)
+	store.AddVoter(ctx, voter1)
+	store.AddVoterPoll(ctx, poll1, voter1.VoterId)
+
+	calls := map[string]func() error{
+		"GetVoterPoll": func() error {
+			_, err := store.GetVoterPoll(ctx, voter1.VoterId, poll2.PollId)
+			return err
+		},
+		"UpdateVoterPoll": func() error {
+			return store.UpdateVoterPoll(ctx, poll2, voter1.VoterId, poll2.PollId)
+		},
+		"DeleteVoterPoll": func() error {
+			return store.DeleteVoterPoll(ctx, voter1.VoterId, poll2.PollId)
+		},
+	}
+
+	for name, call := range calls {
+		err := call()
+		if assert.NotNil(t, err, name) {
+			assert.Equal(t, "poll does not exist", err.Error(), name)
+			assert.ErrorIs(t, err, db.ErrPollNotFound, name)
+		}
+	}
+}
+
+func conformUpdateVoterPollKeepsPollId(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+	poll1 := NewRandPollVoteRecord(1)
+	store.AddVoter(ctx, voter1)
+	store.AddVoterPoll(ctx, poll1, voter1.VoterId)
+
+	// the path pollId wins over the one in the body
+	update := NewRandPollVoteRecord(2)
+	assert.Nil(t, store.UpdateVoterPoll(ctx, update, voter1.VoterId, poll1.PollId))
+
+	update.PollId = poll1.PollId
+	voterPoll, err := store.GetVoterPoll(ctx, voter1.VoterId, poll1.PollId)
+	assert.Nil(t, err)
+	assert.Equal(t, update, voterPoll)
+
+	voterPolls, _ := store.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Equal(t, []db.VoterHistory{update}, voterPolls)
+}
+
+func conformDeleteVoterPollKeepsOrder(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+	store.AddVoter(ctx, voter1)
+
+	var polls []db.VoterHistory
+	for pollId := uint(1); pollId <= 4; pollId++ {
+		poll := NewRandPollVoteRecord(pollId)
+		polls = append(polls, poll)
+		store.AddVoterPoll(ctx, poll, voter1.VoterId)
+	}
+
+	// removing from the middle, the end and the start keeps the rest in order
+	for _, pollId := range []uint{2, 4, 1} {
+		assert.Nil(t, store.DeleteVoterPoll(ctx, voter1.VoterId, pollId))
+	}
+
+	voterPolls, err := store.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, []db.VoterHistory{polls[2]}, voterPolls)
+
+	// a re-added poll goes to the end
+	store.AddVoterPoll(ctx, polls[0], voter1.VoterId)
+	voterPolls, _ = store.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Equal(t, []db.VoterHistory{polls[2], polls[0]}, voterPolls)
+}
+
+func conformQueryVoters(t *testing.T, store db.VoterStore) {
+	names := []string{"Carol Diaz", "alice Brown", "Bob Carlson", "Dave Brown", "Erin Carter"}
+	for i, name := range names {
+		voter := NewRandVoter(uint(i + 1))
+		voter.Name = name
+		voter.Email = fmt.Sprintf("voter%d@example.com", i+1)
+		store.AddVoter(ctx, voter)
+		if i%2 == 0 {
+			store.AddVoterPoll(ctx, NewRandPollVoteRecord(101), voter.VoterId)
+		}
+	}
+
+	voterIds := func(page db.VoterPage) []uint {
+		ids := []uint{}
+		for _, voter := range page.Voters {
+			ids = append(ids, voter.VoterId)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name  string
+		query db.VoterQuery
+		ids   []uint
+		total int
+	}{
+		{"All", db.VoterQuery{}, []uint{1, 2, 3, 4, 5}, 5},
+		{"FirstPage", db.VoterQuery{Limit: 2}, []uint{1, 2}, 5},
+		{"LastPage", db.VoterQuery{Limit: 2, Offset: 4}, []uint{5}, 5},
+		{"PastTheEnd", db.VoterQuery{Limit: 2, Offset: 10}, []uint{}, 5},
+		{"Descending", db.VoterQuery{Limit: 2, Descending: true}, []uint{5, 4}, 5},
+		{"SortByName", db.VoterQuery{SortBy: db.SortByName}, []uint{2, 3, 1, 4, 5}, 5},
+		{"SortByEmailDescending", db.VoterQuery{SortBy: db.SortByEmail, Descending: true, Limit: 1}, []uint{5}, 5},
+		{"NameContains", db.VoterQuery{NameContains: "brown"}, []uint{2, 4}, 2},
+		{"NameContainsSorted", db.VoterQuery{NameContains: "ar", SortBy: db.SortByName}, []uint{3, 1, 5}, 3},
+		{"Email", db.VoterQuery{Email: "VOTER3@example.com"}, []uint{3}, 1},
+		{"VotedInPoll", db.VoterQuery{VotedInPoll: 101, Limit: 2, Offset: 1}, []uint{3, 5}, 3},
+		{"NoMatch", db.VoterQuery{VotedInPoll: 999}, []uint{}, 0},
+	}
+
+	for _, tt := range tests {
+		page, err := store.QueryVoters(ctx, tt.query)
+		if assert.Nil(t, err, tt.name) {
+			assert.Equal(t, tt.ids, voterIds(page), tt.name)
+			assert.Equal(t, tt.total, page.Total, tt.name)
+		}
+	}
+
+	// a page is a copy of the stored voters
+	page, _ := store.QueryVoters(ctx, db.VoterQuery{VotedInPoll: 101, Limit: 1})
+	page.Voters[0].VoteHistory[0].VoteId++
+	voter, _ := store.GetVoter(ctx, page.Voters[0].VoterId)
+	assert.NotEqual(t, page.Voters[0].VoteHistory, voter.VoteHistory)
+
+	// invalid queries are rejected
+	for _, query := range []db.VoterQuery{{SortBy: "age"}, {Limit: -1}, {Limit: db.MaxVoterQueryLimit + 1}, {Offset: -1}} {
+		_, err := store.QueryVoters(ctx, query)
+		assert.NotNil(t, err)
+	}
+}
+
+func conformRevisions(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+	poll1 := NewRandPollVoteRecord(1)
+	unchanged := func(voter db.Voter) (db.Voter, error) { return voter, nil }
+
+	// every write to the voter moves its revision on
+	assert.Nil(t, store.AddVoter(ctx, voter1))
+	writes := []func(revision uint64) error{
+		func(revision uint64) error {
+			_, err := store.UpdateVoter(ctx, NewRandVoter(1), voter1.VoterId, revision)
+			return err
+		},
+		func(revision uint64) error {
+			_, err := store.PatchVoter(ctx, voter1.VoterId, revision, unchanged)
+			return err
+		},
+		func(uint64) error { return store.AddVoterPoll(ctx, poll1, voter1.VoterId) },
+		func(uint64) error { return store.UpdateVoterPoll(ctx, poll1, voter1.VoterId, poll1.PollId) },
+		func(uint64) error { return store.DeleteVoterPoll(ctx, voter1.VoterId, poll1.PollId) },
+	}
+	for i, write := range writes {
+		revision := db.FirstRevision + uint64(i)
+		voter, _ := store.GetVoter(ctx, voter1.VoterId)
+		assert.Equal(t, revision, voter.Revision)
+
+		assert.Nil(t, write(revision), i)
+	}
+
+	// a stale revision changes nothing
+	voter, _ := store.GetVoter(ctx, voter1.VoterId)
+	stale := voter.Revision - 1
+	_, err := store.UpdateVoter(ctx, NewRandVoter(1), voter1.VoterId, stale)
+	assert.ErrorIs(t, err, db.ErrRevisionMismatch)
+	_, err = store.PatchVoter(ctx, voter1.VoterId, stale, unchanged)
+	assert.ErrorIs(t, err, db.ErrRevisionMismatch)
+	assert.ErrorIs(t, store.DeleteVoter(ctx, voter1.VoterId, stale), db.ErrRevisionMismatch)
+
+	current, err := store.GetVoter(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, voter, current)
+
+	// a missing voter is reported before the revision
+	assert.ErrorIs(t, store.DeleteVoter(ctx, 2, stale), db.ErrVoterNotFound)
+
+	assert.Nil(t, store.DeleteVoter(ctx, voter1.VoterId, voter.Revision))
+	_, err = store.GetVoter(ctx, voter1.VoterId)
+	assert.ErrorIs(t, err, db.ErrVoterNotFound)
+}
+
+// assertInvalid checks err is a validation error for exactly fields
+func assertInvalid(t *testing.T, err error, name string, fields ...string) {
+	var validationErr *db.ValidationError
+	if !assert.True(t, errors.As(err, &validationErr), name) {
+		return
+	}
+	assert.ErrorIs(t, err, db.ErrValidation, name)
+
+	var failed []string
+	for _, field := range validationErr.Fields {
+		failed = append(failed, field.Field)
+	}
+	assert.Equal(t, fields, failed, name)
+}
+
+func conformInvalidVoter(t *testing.T, store db.VoterStore) {
+	tests := []struct {
+		name   string
+		update func(voter *db.Voter)
+		fields []string
+	}{
+		{"ZeroVoterId", func(voter *db.Voter) { voter.VoterId = 0 }, []string{"voterId"}},
+		{"EmptyName", func(voter *db.Voter) { voter.Name = " " }, []string{"name"}},
+		{"LongName", func(voter *db.Voter) { voter.Name = strings.Repeat("a", 101) }, []string{"name"}},
+		{"BadEmail", func(voter *db.Voter) { voter.Email = "not-an-email" }, []string{"email"}},
+		{"EmailWithName", func(voter *db.Voter) { voter.Email = "Jo <jo@example.com>" }, []string{"email"}},
+		{"WithHistory", func(voter *db.Voter) {
+			voter.VoteHistory = []db.VoterHistory{NewRandPollVoteRecord(1)}
+		}, []string{"voteHistory"}},
+		{"Empty", func(voter *db.Voter) { *voter = db.Voter{} }, []string{"voterId", "name", "email"}},
+	}
+
+	for _, tt := range tests {
+		voter := NewRandVoter(1)
+		tt.update(&voter)
+		assertInvalid(t, store.AddVoter(ctx, voter), tt.name, tt.fields...)
+	}
+	assert.Empty(t, store.GetAllVoters(ctx))
+
+	// updates are held to the same rules, the id comes from the path
+	voter1 := NewRandVoter(1)
+	assert.Nil(t, store.AddVoter(ctx, voter1))
+	update := NewRandVoter(0)
+	update.Email = "not-an-email"
+	_, err := store.UpdateVoter(ctx, update, voter1.VoterId, 0)
+	assertInvalid(t, err, "UpdateVoter", "email")
+
+	voter, err := store.GetVoter(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, AsAdded(voter1), voter)
+}
+
+func conformInvalidVoterPoll(t *testing.T, store db.VoterStore) {
+	voter1 := NewRandVoter(1)
+	poll1 := NewRandPollVoteRecord(1)
+	store.AddVoter(ctx, voter1)
+	store.AddVoterPoll(ctx, poll1, voter1.VoterId)
+
+	tests := []struct {
+		name   string
+		update func(voterPoll *db.VoterHistory)
+		fields []string
+	}{
+		{"ZeroPollId", func(voterPoll *db.VoterHistory) { voterPoll.PollId = 0 }, []string{"pollId"}},
+		{"ZeroVoteDate", func(voterPoll *db.VoterHistory) { voterPoll.VoteDate = time.Time{} }, []string{"voteDate"}},
+		{"FutureVoteDate", func(voterPoll *db.VoterHistory) {
+			voterPoll.VoteDate = time.Now().Add(time.Hour)
+		}, []string{"voteDate"}},
+	}
+
+	for _, tt := range tests {
+		voterPoll := NewRandPollVoteRecord(2)
+		tt.update(&voterPoll)
+		assertInvalid(t, store.AddVoterPoll(ctx, voterPoll, voter1.VoterId), "AddVoterPoll"+tt.name, tt.fields...)
+	}
+
+	// the pollId of an update comes from the path
+	update := NewRandPollVoteRecord(0)
+	update.VoteDate = time.Time{}
+	assertInvalid(t, store.UpdateVoterPoll(ctx, update, voter1.VoterId, poll1.PollId), "UpdateVoterPoll", "voteDate")
+
+	voterPolls, err := store.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Nil(t, err)
+	assert.Equal(t, []db.VoterHistory{poll1}, voterPolls)
+}
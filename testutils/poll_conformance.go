@@ -0,0 +1,234 @@
+package testutils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// PollStoreFactory returns an empty PollStore for a single conformance case
+type PollStoreFactory func(t *testing.T) db.PollStore
+
+// RunPollStoreConformance checks that a PollStore backend behaves like every
+// other backend. Each case gets a fresh store from newStore.
+func RunPollStoreConformance(t *testing.T, newStore PollStoreFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store db.PollStore)
+	}{
+		{"AddAndGetPoll", conformAddAndGetPoll},
+		{"DuplicatePoll", conformDuplicatePollResource},
+		{"DuplicateOptionOnCreate", conformDuplicateOptionOnCreate},
+		{"PollDoesNotExist", conformPollResourceDoesNotExist},
+		{"GetAllPolls", conformGetAllPolls},
+		{"UpdatePollKeepsOptions", conformUpdatePollKeepsOptions},
+		{"DeletePoll", conformDeletePoll},
+		{"PollOptions", conformPollOptions},
+		{"InvalidPoll", conformInvalidPoll},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+func conformAddAndGetPoll(t *testing.T, store db.PollStore) {
+	poll1 := NewRandPoll(1, 1, 2)
+
+	assert.Nil(t, store.AddPoll(ctx, poll1))
+
+	poll, err := store.GetPoll(ctx, poll1.PollId)
+	assert.Nil(t, err)
+	assert.Equal(t, poll1, poll)
+}
+
+func conformDuplicatePollResource(t *testing.T, store db.PollStore) {
+	poll1 := NewRandPoll(1)
+	assert.Nil(t, store.AddPoll(ctx, poll1))
+
+	err := store.AddPoll(ctx, NewRandPoll(1))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "poll already exists", err.Error())
+		assert.ErrorIs(t, err, db.ErrPollExists)
+	}
+
+	poll, _ := store.GetPoll(ctx, poll1.PollId)
+	assert.Equal(t, poll1, poll)
+}
+
+func conformDuplicateOptionOnCreate(t *testing.T, store db.PollStore) {
+	err := store.AddPoll(ctx, NewRandPoll(1, 1, 1))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "option already exists", err.Error())
+		assert.ErrorIs(t, err, db.ErrOptionExists)
+	}
+
+	_, err = store.GetPoll(ctx, 1)
+	assert.NotNil(t, err)
+}
+
+func conformPollResourceDoesNotExist(t *testing.T, store db.PollStore) {
+	pollId := uint(1)
+
+	calls := map[string]func() error{
+		"GetPoll": func() error {
+			_, err := store.GetPoll(ctx, pollId)
+			return err
+		},
+		"UpdatePoll": func() error {
+			return store.UpdatePoll(ctx, NewRandPoll(pollId), pollId)
+		},
+		"DeletePoll": func() error {
+			return store.DeletePoll(ctx, pollId)
+		},
+		"GetPollOptions": func() error {
+			_, err := store.GetPollOptions(ctx, pollId)
+			return err
+		},
+		"AddPollOption": func() error {
+			return store.AddPollOption(ctx, NewRandPollOption(1), pollId)
+		},
+		"GetPollOption": func() error {
+			_, err := store.GetPollOption(ctx, pollId, 1)
+			return err
+		},
+		"DeletePollOption": func() error {
+			return store.DeletePollOption(ctx, pollId, 1)
+		},
+	}
+
+	for name, call := range calls {
+		err := call()
+		if assert.NotNil(t, err, name) {
+			assert.Equal(t, "poll does not exist", err.Error(), name)
+			assert.ErrorIs(t, err, db.ErrPollNotFound, name)
+		}
+	}
+}
+
+func conformGetAllPolls(t *testing.T, store db.PollStore) {
+	assert.Empty(t, store.GetAllPolls(ctx))
+
+	poll1 := NewRandPoll(1)
+	poll2 := NewRandPoll(2, 1)
+	store.AddPoll(ctx, poll2)
+	store.AddPoll(ctx, poll1)
+
+	assert.Equal(t, []db.Poll{poll1, poll2}, store.GetAllPolls(ctx))
+
+	store.DeleteAllPolls(ctx)
+	assert.Empty(t, store.GetAllPolls(ctx))
+}
+
+func conformUpdatePollKeepsOptions(t *testing.T, store db.PollStore) {
+	poll1 := NewRandPoll(1, 1, 2)
+	store.AddPoll(ctx, poll1)
+
+	// options and id in the body are ignored
+	update := NewRandPoll(2, 3)
+	assert.Nil(t, store.UpdatePoll(ctx, update, poll1.PollId))
+
+	poll, err := store.GetPoll(ctx, poll1.PollId)
+	assert.Nil(t, err)
+	assert.Equal(t, poll1.PollId, poll.PollId)
+	assert.Equal(t, update.Title, poll.Title)
+	assert.Equal(t, update.Question, poll.Question)
+	assert.Equal(t, poll1.Options, poll.Options)
+}
+
+func conformDeletePoll(t *testing.T, store db.PollStore) {
+	poll1 := NewRandPoll(1)
+	poll2 := NewRandPoll(2)
+	store.AddPoll(ctx, poll1)
+	store.AddPoll(ctx, poll2)
+
+	assert.Nil(t, store.DeletePoll(ctx, poll1.PollId))
+
+	_, err := store.GetPoll(ctx, poll1.PollId)
+	assert.NotNil(t, err)
+	assert.Equal(t, []db.Poll{poll2}, store.GetAllPolls(ctx))
+}
+
+func conformPollOptions(t *testing.T, store db.PollStore) {
+	poll1 := NewRandPoll(1, 1)
+	store.AddPoll(ctx, poll1)
+
+	// adding
+	option2 := NewRandPollOption(2)
+	option3 := NewRandPollOption(3)
+	assert.Nil(t, store.AddPollOption(ctx, option2, poll1.PollId))
+	assert.Nil(t, store.AddPollOption(ctx, option3, poll1.PollId))
+
+	err := store.AddPollOption(ctx, NewRandPollOption(2), poll1.PollId)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "option already exists", err.Error())
+		assert.ErrorIs(t, err, db.ErrOptionExists)
+	}
+
+	options, err := store.GetPollOptions(ctx, poll1.PollId)
+	assert.Nil(t, err)
+	assert.Equal(t, []db.PollOption{poll1.Options[0], option2, option3}, options)
+
+	// getting
+	option, err := store.GetPollOption(ctx, poll1.PollId, option2.OptionId)
+	assert.Nil(t, err)
+	assert.Equal(t, option2, option)
+
+	_, err = store.GetPollOption(ctx, poll1.PollId, 9)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "option does not exist", err.Error())
+		assert.ErrorIs(t, err, db.ErrOptionNotFound)
+	}
+
+	// deleting keeps the order of the rest
+	assert.Nil(t, store.DeletePollOption(ctx, poll1.PollId, option2.OptionId))
+	err = store.DeletePollOption(ctx, poll1.PollId, option2.OptionId)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "option does not exist", err.Error())
+		assert.ErrorIs(t, err, db.ErrOptionNotFound)
+	}
+
+	options, _ = store.GetPollOptions(ctx, poll1.PollId)
+	assert.Equal(t, []db.PollOption{poll1.Options[0], option3}, options)
+}
+
+func conformInvalidPoll(t *testing.T, store db.PollStore) {
+	tests := []struct {
+		name   string
+		update func(poll *db.Poll)
+		fields []string
+	}{
+		{"ZeroPollId", func(poll *db.Poll) { poll.PollId = 0 }, []string{"pollId"}},
+		{"EmptyTitle", func(poll *db.Poll) { poll.Title = " " }, []string{"title"}},
+		{"LongTitle", func(poll *db.Poll) { poll.Title = strings.Repeat("a", 201) }, []string{"title"}},
+		{"EmptyQuestion", func(poll *db.Poll) { poll.Question = "" }, []string{"question"}},
+		{"ZeroOptionId", func(poll *db.Poll) { poll.Options[1].OptionId = 0 }, []string{"options[1].optionId"}},
+		{"EmptyOptionText", func(poll *db.Poll) { poll.Options[0].Text = "" }, []string{"options[0].text"}},
+		{"Empty", func(poll *db.Poll) { *poll = db.Poll{} }, []string{"pollId", "title", "question"}},
+	}
+
+	for _, tt := range tests {
+		poll := NewRandPoll(1, 1, 2)
+		tt.update(&poll)
+		assertInvalid(t, store.AddPoll(ctx, poll), "AddPoll"+tt.name, tt.fields...)
+	}
+	assert.Empty(t, store.GetAllPolls(ctx))
+
+	// updates are held to the same rules, the id comes from the path
+	poll1 := NewRandPoll(1, 1)
+	assert.Nil(t, store.AddPoll(ctx, poll1))
+	update := NewRandPoll(0)
+	update.Title = ""
+	assertInvalid(t, store.UpdatePoll(ctx, update, poll1.PollId), "UpdatePoll", "title")
+
+	assertInvalid(t, store.AddPollOption(ctx, db.PollOption{Text: "Cats"}, poll1.PollId), "AddPollOptionZeroId", "optionId")
+	assertInvalid(t, store.AddPollOption(ctx, db.PollOption{OptionId: 2}, poll1.PollId), "AddPollOptionEmptyText", "text")
+
+	poll, err := store.GetPoll(ctx, poll1.PollId)
+	assert.Nil(t, err)
+	assert.Equal(t, poll1, poll)
+}
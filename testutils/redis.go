@@ -0,0 +1,93 @@
+package testutils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// NewRedisStandIn starts an in-process redis server for the duration of the
+// test and returns its address. miniredis has no ReJSON module, so JSON.GET,
+// JSON.SET and JSON.MGET on the root path are served as plain GET, SET and
+// MGET of the document, which is enough for the voter store.
+func NewRedisStandIn(t *testing.T) string {
+	t.Helper()
+
+	return StartRedisStandIn(t).Addr()
+}
+
+// RedisStandIn is the server behind NewRedisStandIn, for tests that take it
+// down with Close and bring it back with Restart
+type RedisStandIn struct {
+	*miniredis.Miniredis
+	t *testing.T
+}
+
+func StartRedisStandIn(t *testing.T) *RedisStandIn {
+	t.Helper()
+
+	standIn := &RedisStandIn{Miniredis: miniredis.RunT(t), t: t}
+	standIn.registerJSONCommands()
+	return standIn
+}
+
+// Restart starts the server again on the same address with the same data
+func (r *RedisStandIn) Restart() {
+	r.t.Helper()
+
+	if err := r.Miniredis.Restart(); err != nil {
+		r.t.Fatalf("failed to restart redis stand-in: %v", err)
+	}
+	r.registerJSONCommands()
+}
+
+func (r *RedisStandIn) registerJSONCommands() {
+	t := r.t
+	t.Helper()
+	srv := r.Server()
+
+	isRoot := func(path string) bool {
+		return path == "." || path == "$"
+	}
+
+	// each alias returns the plain command to run, or nil when the call is
+	// not supported
+	jsonCommands := map[string]func(args []string) []string{
+		"JSON.GET": func(args []string) []string {
+			if len(args) < 2 || !isRoot(args[1]) {
+				return nil
+			}
+			return []string{"GET", args[0]}
+		},
+		"JSON.SET": func(args []string) []string {
+			if len(args) < 3 || !isRoot(args[1]) {
+				return nil
+			}
+			return append([]string{"SET", args[0], args[2]}, args[3:]...)
+		},
+		"JSON.MGET": func(args []string) []string {
+			if len(args) < 2 || !isRoot(args[len(args)-1]) {
+				return nil
+			}
+			return append([]string{"MGET"}, args[:len(args)-1]...)
+		},
+	}
+
+	for name, toCommand := range jsonCommands {
+		toCommand := toCommand
+		err := srv.Register(name, func(c *server.Peer, cmd string, args []string) {
+			command := toCommand(args)
+			if command == nil {
+				c.WriteError("ERR redis stand-in only supports " + strings.ToLower(cmd) + " on the root path")
+				return
+			}
+			// dispatching on the same peer keeps MULTI and lua semantics
+			srv.Dispatch(c, command)
+		})
+		if err != nil {
+			t.Fatalf("failed to register %s on redis stand-in: %v", name, err)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package testutils
 
 import (
+	"time"
+
 	"github.com/abhi2687/voter-api/db"
 	fake "github.com/brianvoe/gofakeit/v6"
 )
@@ -13,10 +15,35 @@ func NewRandVoter(id uint) db.Voter {
 	}
 }
 
+// AsAdded returns voter the way a store keeps it once it was added
+func AsAdded(voter db.Voter) db.Voter {
+	voter.Revision = db.FirstRevision
+	return voter
+}
+
 func NewRandPollVoteRecord(pollId uint) db.VoterHistory {
 	return db.VoterHistory{
 		PollId:   pollId,
 		VoteId:   fake.UintRange(1, 100),
-		VoteDate: fake.Date(),
+		VoteDate: fake.DateRange(time.Now().AddDate(-5, 0, 0), time.Now()),
+	}
+}
+
+func NewRandPoll(id uint, options ...uint) db.Poll {
+	poll := db.Poll{
+		PollId:   id,
+		Title:    fake.Sentence(3),
+		Question: fake.Question(),
+	}
+	for _, optionId := range options {
+		poll.Options = append(poll.Options, NewRandPollOption(optionId))
+	}
+	return poll
+}
+
+func NewRandPollOption(id uint) db.PollOption {
+	return db.PollOption{
+		OptionId: id,
+		Text:     fake.Word(),
 	}
 }
@@ -0,0 +1,258 @@
+package testutils
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/abhi2687/voter-api/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// VoteStoreFactory returns an empty VoteStore for a single conformance case
+// together with the VoterStore it records vote history in and the PollStore
+// ballots are checked against
+type VoteStoreFactory func(t *testing.T) (db.VoterStore, db.PollStore, db.VoteStore)
+
+// conformanceVotePollIds are the polls the cases cast ballots in, each with
+// options 1 and 2
+var conformanceVotePollIds = []uint{1, 2}
+
+// RunVoteStoreConformance checks that a VoteStore backend behaves like every
+// other backend. Each case gets fresh stores from newStores with the
+// conformanceVotePollIds added.
+func RunVoteStoreConformance(t *testing.T, newStores VoteStoreFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, voters db.VoterStore, votes db.VoteStore)
+	}{
+		{"CastVote", conformCastVote},
+		{"AlreadyVoted", conformAlreadyVoted},
+		{"VoterDoesNotExist", conformVoteVoterDoesNotExist},
+		{"InvalidVote", conformInvalidVote},
+		{"VoteNeedsPollOption", conformVoteNeedsPollOption},
+		{"VoteDoesNotExist", conformVoteDoesNotExist},
+		{"GetAllVotes", conformGetAllVotes},
+		{"ConcurrentVotes", conformConcurrentVotes},
+		{"Tallies", conformTallies},
+		{"RecordedHistory", conformRecordedHistory},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			voters, polls, votes := newStores(t)
+			for _, pollId := range conformanceVotePollIds {
+				if err := polls.AddPoll(ctx, NewRandPoll(pollId, 1, 2)); err != nil {
+					t.Fatalf("failed to add poll %d: %v", pollId, err)
+				}
+			}
+			tt.run(t, voters, votes)
+		})
+	}
+}
+
+func conformCastVote(t *testing.T, voters db.VoterStore, votes db.VoteStore) {
+	voter1 := NewRandVoter(1)
+	voters.AddVoter(ctx, voter1)
+
+	vote, err := votes.CastVote(ctx, db.Vote{VoterId: voter1.VoterId, PollId: 1, OptionId: 2, Value: "yes"})
+	assert.Nil(t, err)
+	assert.NotZero(t, vote.VoteId)
+	assert.False(t, vote.VoteDate.IsZero())
+	assert.Equal(t, voter1.VoterId, vote.VoterId)
+	assert.Equal(t, uint(1), vote.PollId)
+	assert.Equal(t, uint(2), vote.OptionId)
+	assert.Equal(t, "yes", vote.Value)
+
+	storedVote, err := votes.GetVote(ctx, vote.VoteId)
+	assert.Nil(t, err)
+	assert.Equal(t, vote, storedVote)
+
+	// the history entry points at the vote
+	voterPoll, err := voters.GetVoterPoll(ctx, voter1.VoterId, vote.PollId)
+	assert.Nil(t, err)
+	assert.Equal(t, db.VoterHistory{PollId: vote.PollId, VoteId: vote.VoteId, VoteDate: vote.VoteDate}, voterPoll)
+}
+
+func conformAlreadyVoted(t *testing.T, voters db.VoterStore, votes db.VoteStore) {
+	voter1 := NewRandVoter(1)
+	voters.AddVoter(ctx, voter1)
+
+	vote, err := votes.CastVote(ctx, db.Vote{VoterId: voter1.VoterId, PollId: 1, OptionId: 1})
+	assert.Nil(t, err)
+
+	_, err = votes.CastVote(ctx, db.Vote{VoterId: voter1.VoterId, PollId: 1, OptionId: 2})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "voter already voted in this poll", err.Error())
+		assert.ErrorIs(t, err, db.ErrAlreadyVoted)
+	}
+
+	assert.Equal(t, []db.Vote{vote}, votes.GetAllVotes(ctx))
+	voterPolls, _ := voters.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Len(t, voterPolls, 1)
+}
+
+func conformVoteVoterDoesNotExist(t *testing.T, voters db.VoterStore, votes db.VoteStore) {
+	_, err := votes.CastVote(ctx, db.Vote{VoterId: 1, PollId: 1, OptionId: 1})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "voter does not exist", err.Error())
+		assert.ErrorIs(t, err, db.ErrVoterNotFound)
+	}
+
+	assert.Empty(t, votes.GetAllVotes(ctx))
+}
+
+func conformInvalidVote(t *testing.T, voters db.VoterStore, votes db.VoteStore) {
+	voter1 := NewRandVoter(1)
+	voters.AddVoter(ctx, voter1)
+
+	_, err := votes.CastVote(ctx, db.Vote{VoterId: voter1.VoterId, OptionId: 1})
+	assertInvalid(t, err, "ZeroPollId", "pollId")
+	_, err = votes.CastVote(ctx, db.Vote{})
+	assertInvalid(t, err, "Empty", "voterId", "pollId", "optionId")
+
+	assert.Empty(t, votes.GetAllVotes(ctx))
+	voterPolls, _ := voters.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Empty(t, voterPolls)
+}
+
+func conformVoteNeedsPollOption(t *testing.T, voters db.VoterStore, votes db.VoteStore) {
+	voter1 := NewRandVoter(1)
+	voters.AddVoter(ctx, voter1)
+
+	_, err := votes.CastVote(ctx, db.Vote{VoterId: voter1.VoterId, PollId: 99, OptionId: 1})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "poll does not exist", err.Error())
+		assert.ErrorIs(t, err, db.ErrPollNotFound)
+	}
+	_, err = votes.CastVote(ctx, db.Vote{VoterId: voter1.VoterId, PollId: 1, OptionId: 7})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "option does not exist", err.Error())
+		assert.ErrorIs(t, err, db.ErrOptionNotFound)
+	}
+
+	assert.Empty(t, votes.GetAllVotes(ctx))
+	voterPolls, _ := voters.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Empty(t, voterPolls)
+	tally, _ := votes.GetTally(ctx, 1)
+	assert.Equal(t, 0, tally.Total)
+}
+
+func conformVoteDoesNotExist(t *testing.T, voters db.VoterStore, votes db.VoteStore) {
+	_, err := votes.GetVote(ctx, 9)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "vote does not exist", err.Error())
+		assert.ErrorIs(t, err, db.ErrVoteNotFound)
+	}
+}
+
+func conformGetAllVotes(t *testing.T, voters db.VoterStore, votes db.VoteStore) {
+	assert.Empty(t, votes.GetAllVotes(ctx))
+	count, err := votes.CountVotes(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	voters.AddVoter(ctx, NewRandVoter(1))
+	voters.AddVoter(ctx, NewRandVoter(2))
+
+	vote1, _ := votes.CastVote(ctx, db.Vote{VoterId: 2, PollId: 1, OptionId: 1})
+	vote2, _ := votes.CastVote(ctx, db.Vote{VoterId: 1, PollId: 1, OptionId: 2})
+	vote3, _ := votes.CastVote(ctx, db.Vote{VoterId: 1, PollId: 2, OptionId: 1})
+
+	assert.Less(t, vote1.VoteId, vote2.VoteId)
+	assert.Less(t, vote2.VoteId, vote3.VoteId)
+	assert.Equal(t, []db.Vote{vote1, vote2, vote3}, votes.GetAllVotes(ctx))
+	count, err = votes.CountVotes(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+
+	votes.DeleteAllVotes(ctx)
+	assert.Empty(t, votes.GetAllVotes(ctx))
+}
+
+func conformConcurrentVotes(t *testing.T, voters db.VoterStore, votes db.VoteStore) {
+	voter1 := NewRandVoter(1)
+	voters.AddVoter(ctx, voter1)
+
+	// only one ballot per poll gets in however the casts interleave
+	const casts = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < casts; i++ {
+		wg.Add(1)
+		go func(optionId uint) {
+			defer wg.Done()
+			if _, err := votes.CastVote(ctx, db.Vote{VoterId: voter1.VoterId, PollId: 1, OptionId: optionId}); err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}(uint(i))
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, accepted)
+	assert.Len(t, votes.GetAllVotes(ctx), 1)
+	voterPolls, _ := voters.GetVoterPolls(ctx, voter1.VoterId)
+	assert.Len(t, voterPolls, 1)
+}
+
+func conformTallies(t *testing.T, voters db.VoterStore, votes db.VoteStore) {
+	tally, err := votes.GetTally(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, db.Tally{PollId: 1, Counts: map[uint]int{}}, tally)
+
+	for voterId := uint(1); voterId <= 3; voterId++ {
+		voters.AddVoter(ctx, NewRandVoter(voterId))
+	}
+	votes.CastVote(ctx, db.Vote{VoterId: 1, PollId: 1, OptionId: 1})
+	votes.CastVote(ctx, db.Vote{VoterId: 2, PollId: 1, OptionId: 2})
+	votes.CastVote(ctx, db.Vote{VoterId: 3, PollId: 1, OptionId: 2})
+	votes.CastVote(ctx, db.Vote{VoterId: 1, PollId: 2, OptionId: 1})
+	// rejected ballots are not counted
+	votes.CastVote(ctx, db.Vote{VoterId: 1, PollId: 1, OptionId: 1})
+
+	tally, err = votes.GetTally(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, db.Tally{PollId: 1, Counts: map[uint]int{1: 1, 2: 2}, Total: 3}, tally)
+
+	// counting as votes were cast agrees with counting them again
+	drifts, err := votes.RebuildTallies(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, drifts)
+
+	tally, _ = votes.GetTally(ctx, 2)
+	assert.Equal(t, db.Tally{PollId: 2, Counts: map[uint]int{1: 1}, Total: 1}, tally)
+
+	votes.DeleteAllVotes(ctx)
+	tally, _ = votes.GetTally(ctx, 1)
+	assert.Equal(t, 0, tally.Total)
+}
+
+func conformRecordedHistory(t *testing.T, voters db.VoterStore, votes db.VoteStore) {
+	voter1 := NewRandVoter(1)
+	voters.AddVoter(ctx, voter1)
+
+	vote, err := votes.CastVote(ctx, db.Vote{VoterId: voter1.VoterId, PollId: 1, OptionId: 1})
+	assert.Nil(t, err)
+
+	// the entry a ballot wrote stays, or the tally would count a vote the
+	// voter no longer has
+	err = voters.DeleteVoterPoll(ctx, voter1.VoterId, vote.PollId)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "vote history entry records a cast vote", err.Error())
+		assert.ErrorIs(t, err, db.ErrVoteRecorded)
+	}
+
+	// nor replaced by one that no longer points at the vote
+	err = voters.UpdateVoterPoll(ctx, db.VoterHistory{VoteDate: vote.VoteDate}, voter1.VoterId, vote.PollId)
+	assert.ErrorIs(t, err, db.ErrVoteRecorded)
+	err = voters.DeleteVoterPoll(ctx, voter1.VoterId, vote.PollId)
+	assert.ErrorIs(t, err, db.ErrVoteRecorded)
+
+	voterPoll, err := voters.GetVoterPoll(ctx, voter1.VoterId, vote.PollId)
+	assert.Nil(t, err)
+	assert.Equal(t, db.VoterHistory{PollId: vote.PollId, VoteId: vote.VoteId, VoteDate: vote.VoteDate}, voterPoll)
+	tally, _ := votes.GetTally(ctx, vote.PollId)
+	assert.Equal(t, 1, tally.Total)
+}